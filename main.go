@@ -1,28 +1,133 @@
 package main
 
 import (
+	"log"
+	"os"
+
+	"github.com/cativovo/go-demo-auth/pkg/audit"
 	"github.com/cativovo/go-demo-auth/pkg/auth"
 	"github.com/cativovo/go-demo-auth/pkg/http"
+	"github.com/cativovo/go-demo-auth/pkg/idp"
+	"github.com/cativovo/go-demo-auth/pkg/mail"
+	"github.com/cativovo/go-demo-auth/pkg/org"
+	"github.com/cativovo/go-demo-auth/pkg/password"
+	"github.com/cativovo/go-demo-auth/pkg/ratelimit"
+	"github.com/cativovo/go-demo-auth/pkg/rbac"
+	"github.com/cativovo/go-demo-auth/pkg/session"
 	"github.com/cativovo/go-demo-auth/pkg/storage/postgres"
 	"github.com/cativovo/go-demo-auth/pkg/storage/supabase"
 	"github.com/cativovo/go-demo-auth/pkg/user"
 )
 
 func main() {
-	supabaseRepository := supabase.NewSupabaseRepository()
 	pgRepository := postgres.NewPostgresRepository()
-	r := struct {
-		*supabase.SupabaseRepository
-		*postgres.PostgresRepository
-	}{
-		supabaseRepository,
-		pgRepository,
+
+	webAuthn, err := auth.NewWebAuthnFromEnv()
+	if err != nil {
+		log.Fatal("Invalid WebAuthn configuration ", err)
+	}
+
+	appUrl := os.Getenv("APP_URL")
+	if appUrl == "" {
+		appUrl = "http://localhost:3000"
+	}
+
+	mailer := mail.NewMailerFromEnv()
+
+	auditService := audit.NewAuditService(pgRepository)
+
+	passwordPolicy, err := password.NewPolicyFromEnv()
+	if err != nil {
+		log.Fatal("Invalid password policy ", err)
+	}
+
+	opts := []auth.Option{
+		auth.WithAuditor(auditService),
+		auth.WithPasswordPolicy(passwordPolicy),
+		auth.WithWebAuthn(webAuthn),
+		auth.WithMailer(mailer, appUrl),
+		auth.WithOIDCProviders(auth.NewOIDCProvidersFromEnv()...),
+	}
+
+	var authService auth.Service
+	var userService user.Service
+
+	switch os.Getenv("AUTH_PROVIDER") {
+	case "local":
+		localRepository := postgres.NewLocalAuthRepository(pgRepository, mailer)
+		r := struct {
+			*postgres.LocalAuthRepository
+			*postgres.PostgresRepository
+		}{
+			localRepository,
+			pgRepository,
+		}
+
+		// the local tokens carry the session id the session management needs,
+		// GetUserId of the repository only returns the user id
+		opts = append(opts, auth.WithVerifier(auth.NewVerifier(auth.VerifierConfig{
+			Secret:   os.Getenv("JWT_SECRET"),
+			Audience: "authenticated",
+		})))
+
+		authService = auth.NewAuthService(r, opts...)
+		userService = user.NewUserService(
+			r,
+			user.WithAuditor(auditService),
+			user.WithPasswordPolicy(passwordPolicy),
+			user.WithPasswordChecker(authService),
+		)
+	default:
+		supabaseRepository := supabase.NewSupabaseRepository()
+		r := struct {
+			*supabase.SupabaseRepository
+			*postgres.PostgresRepository
+		}{
+			supabaseRepository,
+			pgRepository,
+		}
+
+		if verifier := auth.NewVerifierFromEnv(); verifier != nil {
+			opts = append(opts, auth.WithVerifier(verifier))
+		}
+		if os.Getenv("JWT_REMOTE_FALLBACK") == "true" {
+			opts = append(opts, auth.WithRemoteFallback())
+		}
+
+		authService = auth.NewAuthService(r, opts...)
+		userService = user.NewUserService(
+			r,
+			user.WithAuditor(auditService),
+			user.WithPasswordPolicy(passwordPolicy),
+			user.WithPasswordChecker(authService),
+		)
+	}
+
+	signingKey, err := idp.NewSigningKeyFromEnv()
+	if err != nil {
+		log.Fatal("Invalid IdP signing key ", err)
+	}
+
+	issuer := os.Getenv("IDP_ISSUER")
+	if issuer == "" {
+		issuer = appUrl
 	}
 
-	authService := auth.NewAuthService(supabaseRepository)
-	userService := user.NewUserService(r)
+	idpService := idp.NewIdPService(pgRepository, userService, idp.Config{
+		Issuer:     issuer,
+		SigningKey: signingKey,
+	})
+
+	rateLimits := ratelimit.NewStoreFromEnv(postgres.NewRateLimitStore(pgRepository))
+	sessions := session.NewStoreFromEnv(postgres.NewSessionStore(pgRepository))
+
+	// the first administrator is whoever verifies this email, the others are
+	// appointed by administrators
+	rbacService := rbac.NewRBACService(pgRepository, rbac.WithBootstrapAdmin(os.Getenv("BOOTSTRAP_ADMIN_EMAIL")))
+
+	orgService := org.NewOrgService(pgRepository, org.WithMailer(mailer, appUrl))
 
-	server := http.NewServer(authService, userService)
+	server := http.NewServer(authService, userService, idpService, rateLimits, sessions, rbacService, orgService, auditService)
 
 	server.ListenAndServe("127.0.0.1:3000")
 }
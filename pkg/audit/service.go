@@ -0,0 +1,226 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"time"
+)
+
+var ErrSomethingWentWrong = errors.New("something went wrong")
+
+// The actions recorded by auth.Service and user.Service, the ones starting
+// with "login." are the different ways to log in.
+const (
+	ActionLoginPassword  = "login.password"
+	ActionLoginTOTP      = "login.totp"
+	ActionLoginPasskey   = "login.passkey"
+	ActionLoginMagicLink = "login.magic_link"
+	ActionLoginOIDC      = "login.oidc"
+	ActionLogout         = "logout"
+	ActionRegister       = "register"
+	ActionRegisterOIDC   = "register.oidc"
+	ActionPasswordChange = "password.change"
+	ActionEmailChange    = "email.change"
+	ActionAccountDelete  = "account.delete"
+)
+
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+const (
+	recentEventsLimit = 20
+	eventsPageSize    = 50
+)
+
+// Event is a security relevant thing that happened to an account. UserId is
+// empty when the user isn't known, e.g. a failed login, Email is then what
+// was typed in. Detail is why it failed.
+type Event struct {
+	Id        string
+	UserId    string
+	Email     string
+	Action    string
+	Outcome   string
+	Detail    string
+	IP        string
+	UserAgent string
+	CreatedAt time.Time
+}
+
+// Description is what the account page shows for the event.
+func (e Event) Description() string {
+	var d string
+
+	switch e.Action {
+	case ActionLoginPassword:
+		d = "Login with a password"
+	case ActionLoginTOTP:
+		d = "Two-factor authentication"
+	case ActionLoginPasskey:
+		d = "Login with a passkey"
+	case ActionLoginMagicLink:
+		d = "Login with an email link"
+	case ActionLoginOIDC:
+		d = "Login with an identity provider"
+	case ActionLogout:
+		d = "Logout"
+	case ActionRegister:
+		d = "Account created"
+	case ActionRegisterOIDC:
+		d = "Identity provider linked"
+	case ActionPasswordChange:
+		d = "Password change"
+	case ActionEmailChange:
+		d = "Email change"
+	case ActionAccountDelete:
+		d = "Account deletion"
+	default:
+		d = e.Action
+	}
+
+	if e.Outcome == OutcomeFailure {
+		return d + " failed"
+	}
+
+	return d
+}
+
+// Client is who sent the request that caused the event.
+type Client struct {
+	IP        string
+	UserAgent string
+}
+
+// Filter narrows the events searched by the administrators, the empty
+// fields match every event.
+type Filter struct {
+	UserId string
+	Email  string
+	// Action also matches the actions it is a prefix of, e.g. "login"
+	// matches every way to log in.
+	Action  string
+	Outcome string
+	IP      string
+	Since   *time.Time
+	Until   *time.Time
+}
+
+// EventPage is a page of the events matching a Filter, the most recent first.
+type EventPage struct {
+	Events []Event
+	Filter Filter
+	Page   int
+	Total  int
+}
+
+func (p EventPage) TotalPages() int {
+	return max(1, (p.Total+eventsPageSize-1)/eventsPageSize)
+}
+
+func (p EventPage) HasNext() bool {
+	return p.Page < p.TotalPages()
+}
+
+// Auditor is what the other services record their events with. Recording
+// never fails the caller, the errors are only logged.
+type Auditor interface {
+	Record(ctx context.Context, e Event)
+}
+
+type Service interface {
+	Auditor
+	// GetRecentEvents returns the latest events of the user, along with the
+	// failed logins with their email.
+	GetRecentEvents(ctx context.Context, userId, email string) ([]Event, error)
+	// GetAllEvents is GetRecentEvents without a limit, for the export of
+	// the data of the user.
+	GetAllEvents(ctx context.Context, userId, email string) ([]Event, error)
+	// SearchEvents returns the page of the events matching f, pages start
+	// at 1.
+	SearchEvents(ctx context.Context, f Filter, page int) (EventPage, error)
+}
+
+type Repository interface {
+	AddAuditEvent(ctx context.Context, e Event) error
+	GetAuditEventsByUser(ctx context.Context, userId, email string, limit int) ([]Event, error)
+	SearchAuditEvents(ctx context.Context, f Filter, limit, offset int) ([]Event, int, error)
+}
+
+type service struct {
+	repository Repository
+}
+
+func NewAuditService(r Repository) Service {
+	return &service{
+		repository: r,
+	}
+}
+
+// NewEvent is the event of an action done by c, it failed when err isn't nil.
+func NewEvent(action, userId, email string, c Client, err error) Event {
+	e := Event{
+		UserId:    userId,
+		Email:     email,
+		Action:    action,
+		Outcome:   OutcomeSuccess,
+		IP:        c.IP,
+		UserAgent: c.UserAgent,
+	}
+
+	if err != nil {
+		e.Outcome = OutcomeFailure
+		e.Detail = err.Error()
+	}
+
+	return e
+}
+
+// Record doesn't use the cancelation of ctx, a client that disconnects
+// mid-request must not be able to drop the event.
+func (s *service) Record(ctx context.Context, e Event) {
+	if err := s.repository.AddAuditEvent(context.WithoutCancel(ctx), e); err != nil {
+		log.Println("AuditService Record AddAuditEvent:", err, e)
+	}
+}
+
+func (s *service) GetRecentEvents(ctx context.Context, userId, email string) ([]Event, error) {
+	events, err := s.repository.GetAuditEventsByUser(ctx, userId, email, recentEventsLimit)
+	if err != nil {
+		log.Println("AuditService GetRecentEvents GetAuditEventsByUser:", err)
+		return nil, ErrSomethingWentWrong
+	}
+
+	return events, nil
+}
+
+func (s *service) GetAllEvents(ctx context.Context, userId, email string) ([]Event, error) {
+	events, err := s.repository.GetAuditEventsByUser(ctx, userId, email, math.MaxInt32)
+	if err != nil {
+		log.Println("AuditService GetAllEvents GetAuditEventsByUser:", err)
+		return nil, ErrSomethingWentWrong
+	}
+
+	return events, nil
+}
+
+func (s *service) SearchEvents(ctx context.Context, f Filter, page int) (EventPage, error) {
+	page = max(1, page)
+
+	events, total, err := s.repository.SearchAuditEvents(ctx, f, eventsPageSize, (page-1)*eventsPageSize)
+	if err != nil {
+		log.Println("AuditService SearchEvents SearchAuditEvents:", err)
+		return EventPage{}, ErrSomethingWentWrong
+	}
+
+	return EventPage{
+			Events: events,
+			Filter: f,
+			Page:   page,
+			Total:  total,
+		},
+		nil
+}
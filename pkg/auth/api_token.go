@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"context"
+	"log"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// apiTokenPrefix makes leaked tokens easy to recognize, e.g. by secret scanners.
+	apiTokenPrefix = "gda_"
+
+	maxAPITokenNameLength = 64
+	maxAPITokenLifetime   = 365 * 24 * time.Hour
+
+	APIScopeRead  = "read"
+	APIScopeWrite = "write"
+)
+
+// APIScopes are the scopes an API token can be given. read allows GET
+// requests, write allows the others.
+var APIScopes = []string{APIScopeRead, APIScopeWrite}
+
+// APIToken is a personal access token used by scripts in place of a
+// session. Only the sha256 of the token is stored.
+type APIToken struct {
+	Id         string
+	UserId     string
+	Name       string
+	Scopes     []string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	LastUsedAt *time.Time
+}
+
+func (t APIToken) HasScope(scope string) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+// CreateAPIToken returns the new token, it can't be retrieved afterwards.
+func (s *service) CreateAPIToken(ctx context.Context, userId, name string, scopes []string, lifetime time.Duration) (string, APIToken, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxAPITokenNameLength {
+		return "", APIToken{}, ErrInvalidAPITokenName
+	}
+
+	if len(scopes) == 0 {
+		return "", APIToken{}, ErrInvalidAPITokenScope
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(APIScopes, scope) {
+			return "", APIToken{}, ErrInvalidAPITokenScope
+		}
+	}
+
+	if lifetime <= 0 || lifetime > maxAPITokenLifetime {
+		return "", APIToken{}, ErrInvalidAPITokenLifetime
+	}
+
+	secret, err := randomToken()
+	if err != nil {
+		log.Println("AuthService CreateAPIToken randomToken:", err)
+		return "", APIToken{}, ErrSomethingWentWrong
+	}
+
+	token := apiTokenPrefix + secret
+
+	t, err := s.repository.AddAPIToken(ctx, APIToken{
+		UserId:    userId,
+		Name:      name,
+		Scopes:    scopes,
+		ExpiresAt: time.Now().Add(lifetime),
+	}, hashToken(token))
+	if err != nil {
+		log.Println("AuthService CreateAPIToken AddAPIToken:", err)
+		return "", APIToken{}, ErrSomethingWentWrong
+	}
+
+	return token, t, nil
+}
+
+func (s *service) GetAPITokens(ctx context.Context, userId string) ([]APIToken, error) {
+	tokens, err := s.repository.GetAPITokensByUserId(ctx, userId)
+	if err != nil {
+		log.Println("AuthService GetAPITokens GetAPITokensByUserId:", err)
+		return nil, ErrSomethingWentWrong
+	}
+
+	return tokens, nil
+}
+
+func (s *service) RevokeAPIToken(ctx context.Context, userId, tokenId string) error {
+	deleted, err := s.repository.DeleteAPIToken(ctx, userId, tokenId)
+	if err != nil {
+		log.Println("AuthService RevokeAPIToken DeleteAPIToken:", err)
+		return ErrSomethingWentWrong
+	}
+
+	if !deleted {
+		return ErrAPITokenNotFound
+	}
+
+	return nil
+}
+
+// VerifyAPIToken returns the token if it exists and hasn't expired, and
+// records that it was used.
+func (s *service) VerifyAPIToken(ctx context.Context, token string) (APIToken, error) {
+	if !strings.HasPrefix(token, apiTokenPrefix) {
+		return APIToken{}, ErrInvalidToken
+	}
+
+	t, err := s.repository.GetAPITokenByHash(ctx, hashToken(token))
+	if err != nil || !time.Now().Before(t.ExpiresAt) {
+		return APIToken{}, ErrInvalidToken
+	}
+
+	if err := s.checkDisabled(ctx, t.UserId); err != nil {
+		return APIToken{}, err
+	}
+
+	if err := s.repository.UpdateAPITokenLastUsed(ctx, t.Id); err != nil {
+		log.Println("AuthService VerifyAPIToken UpdateAPITokenLastUsed:", err)
+	}
+
+	return t, nil
+}
@@ -0,0 +1,230 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/cativovo/go-demo-auth/pkg/mail"
+)
+
+// LoginFailures counts the failed logins of an account or an IP address.
+// Key is "account:<email>", "totp:<user id>" for the wrong codes of the
+// second factor or "ip:<address>".
+type LoginFailures struct {
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   *time.Time
+}
+
+// ThrottledError is returned by Login, CheckPassword and
+// CompleteLoginChallenge when they refused to check the password or code.
+// Err is ErrTooManyAttempts, ErrAccountLocked or ErrIPBlocked.
+type ThrottledError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", e.Err, e.RetryAfter)
+}
+
+func (e *ThrottledError) Unwrap() error {
+	return e.Err
+}
+
+// lockoutPolicy slows an attacker down exponentially once backoffAfter
+// failures happened within window, and locks them out for lockFor after
+// lockAfter failures.
+type lockoutPolicy struct {
+	backoffAfter int
+	maxBackoff   time.Duration
+	lockAfter    int
+	lockFor      time.Duration
+	window       time.Duration
+	lockedErr    error
+}
+
+// the IP limits are higher since many users can share an address
+var (
+	accountLockoutPolicy = lockoutPolicy{
+		backoffAfter: 3,
+		maxBackoff:   time.Minute,
+		lockAfter:    10,
+		lockFor:      15 * time.Minute,
+		window:       time.Hour,
+		lockedErr:    ErrAccountLocked,
+	}
+	ipLockoutPolicy = lockoutPolicy{
+		backoffAfter: 20,
+		maxBackoff:   time.Minute,
+		lockAfter:    100,
+		lockFor:      time.Hour,
+		window:       time.Hour,
+		lockedErr:    ErrIPBlocked,
+	}
+)
+
+// WithMailer lets the service email users, e.g. the link unlocking an
+// account locked after too many failed logins.
+func WithMailer(m mail.Mailer, appUrl string) Option {
+	return func(s *service) {
+		s.mailer = m
+		s.appUrl = appUrl
+	}
+}
+
+// UnlockAccount clears the lockout of the account the unlock link was sent for.
+func (s *service) UnlockAccount(ctx context.Context, token string) error {
+	if err := s.repository.UnlockLogin(ctx, hashToken(token)); err != nil {
+		return ErrInvalidToken
+	}
+
+	return nil
+}
+
+// withLockout runs check, which checks the password of email, unless email
+// or ip are locked out. ErrInvalidCredentials from check counts towards
+// both lockouts, a success clears the one of the account.
+func (s *service) withLockout(ctx context.Context, email, ip string, check func() error) error {
+	return s.withAccountLockout(ctx, accountLockoutKey(email), email, ip, check)
+}
+
+// withAccountLockout is withLockout for the failures counted under
+// accountKey, ErrInvalidTOTPCode from check counts too.
+func (s *service) withAccountLockout(ctx context.Context, accountKey, email, ip string, check func() error) error {
+	ipKey := ipLockoutKey(ip)
+
+	if err := s.checkLockout(ctx, ipKey, ipLockoutPolicy); err != nil {
+		return err
+	}
+
+	if err := s.checkLockout(ctx, accountKey, accountLockoutPolicy); err != nil {
+		return err
+	}
+
+	err := check()
+	if errors.Is(err, ErrInvalidCredentials) || errors.Is(err, ErrInvalidTOTPCode) {
+		s.recordLoginFailure(ctx, ipKey, ipLockoutPolicy, "")
+		s.recordLoginFailure(ctx, accountKey, accountLockoutPolicy, email)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	// the ip counter is left alone, otherwise logging into an account of
+	// their own would let an attacker reset it
+	if err := s.repository.ClearLoginFailures(ctx, accountKey); err != nil {
+		log.Println("AuthService withAccountLockout ClearLoginFailures:", err)
+	}
+
+	return nil
+}
+
+// checkLockout returns a ThrottledError when key is locked or still has to
+// wait for its back-off.
+func (s *service) checkLockout(ctx context.Context, key string, p lockoutPolicy) error {
+	f, err := s.repository.GetLoginFailures(ctx, key)
+	if err != nil {
+		// no row means no recent failures
+		return nil
+	}
+
+	now := time.Now()
+
+	if f.LockedUntil != nil && now.Before(*f.LockedUntil) {
+		return &ThrottledError{Err: p.lockedErr, RetryAfter: f.LockedUntil.Sub(now)}
+	}
+
+	if f.Failures < p.backoffAfter || now.Sub(f.LastFailureAt) > p.window {
+		return nil
+	}
+
+	backoff := time.Second << (f.Failures - p.backoffAfter)
+	if backoff > p.maxBackoff || backoff <= 0 {
+		backoff = p.maxBackoff
+	}
+
+	if retryAt := f.LastFailureAt.Add(backoff); now.Before(retryAt) {
+		return &ThrottledError{Err: ErrTooManyAttempts, RetryAfter: retryAt.Sub(now)}
+	}
+
+	return nil
+}
+
+// recordLoginFailure counts a failure against key and locks it once the
+// policy threshold is reached. email is set for account keys so the owner
+// can be told and given an unlock link.
+func (s *service) recordLoginFailure(ctx context.Context, key string, p lockoutPolicy, email string) {
+	f, err := s.repository.RecordLoginFailure(ctx, key, time.Now().Add(-p.window))
+	if err != nil {
+		log.Println("AuthService recordLoginFailure RecordLoginFailure:", err)
+		return
+	}
+
+	if f.Failures < p.lockAfter {
+		return
+	}
+
+	unlockToken, err := randomToken()
+	if err != nil {
+		log.Println("AuthService recordLoginFailure randomToken:", err)
+		return
+	}
+
+	if err := s.repository.LockLogin(ctx, key, time.Now().Add(p.lockFor), hashToken(unlockToken)); err != nil {
+		log.Println("AuthService recordLoginFailure LockLogin:", err)
+		return
+	}
+
+	if email != "" {
+		s.sendUnlockEmail(ctx, email, unlockToken, p.lockFor)
+	}
+}
+
+func (s *service) sendUnlockEmail(ctx context.Context, email, unlockToken string, lockFor time.Duration) {
+	if s.mailer == nil {
+		return
+	}
+
+	// locking unknown emails too keeps them indistinguishable, but they
+	// mustn't turn the login form into a way to spam any address
+	exists, err := s.repository.EmailExists(ctx, email)
+	if err != nil || !exists {
+		return
+	}
+
+	m := mail.Message{
+		To:      email,
+		Subject: "Your account has been locked",
+		Body: fmt.Sprintf(
+			"Someone failed to log into your account too many times, so logins are blocked for %d minutes.\n\nIf it was you, follow this link to unlock it now:\n\n%s/auth/unlock?token=%s\n\nIf it wasn't, consider changing your password.\n",
+			int(lockFor.Minutes()),
+			s.appUrl,
+			unlockToken,
+		),
+	}
+
+	if err := s.mailer.Send(m); err != nil {
+		log.Println("AuthService sendUnlockEmail Send:", err)
+	}
+}
+
+func accountLockoutKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// totpLockoutKey counts apart from the password, a correct password would
+// otherwise clear the wrong codes.
+func totpLockoutKey(userId string) string {
+	return "totp:" + userId
+}
+
+func ipLockoutKey(ip string) string {
+	return "ip:" + ip
+}
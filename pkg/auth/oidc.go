@@ -0,0 +1,263 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/cativovo/go-demo-auth/pkg/audit"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// OIDCProvider is an OpenID Connect identity provider users can sign in
+// with. Name is used in the callback URL, e.g. /auth/oidc/google/callback.
+type OIDCProvider struct {
+	Name         string
+	DisplayName  string
+	Issuer       string
+	ClientId     string
+	ClientSecret string
+	Scopes       []string
+	RedirectURL  string
+	// TrustEmail links a new identity to the existing user with the same
+	// verified email. Only turn it on for providers that own the emails
+	// they assert, otherwise anyone able to claim an email there can take
+	// over the account.
+	TrustEmail bool
+}
+
+// OIDCIdentity is the user as described by the ID token of a provider.
+type OIDCIdentity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	// EmailTrusted is the TrustEmail of the provider.
+	EmailTrusted bool
+}
+
+// OIDCAuthRequest is an authorization request in flight. The browser keeps
+// State, Nonce and Verifier until it comes back to the callback.
+type OIDCAuthRequest struct {
+	URL      string
+	State    string
+	Nonce    string
+	Verifier string
+}
+
+// oidcClient discovers the provider on first use so an unreachable issuer
+// doesn't prevent the server from starting.
+type oidcClient struct {
+	config   OIDCProvider
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+// NewOIDCProvidersFromEnv reads the comma separated OIDC_PROVIDERS names and
+// for each NAME its OIDC_NAME_ISSUER, OIDC_NAME_CLIENT_ID,
+// OIDC_NAME_CLIENT_SECRET, OIDC_NAME_DISPLAY_NAME, OIDC_NAME_SCOPES and
+// OIDC_NAME_TRUST_EMAIL.
+func NewOIDCProvidersFromEnv() []OIDCProvider {
+	appUrl := os.Getenv("APP_URL")
+	if appUrl == "" {
+		appUrl = "http://localhost:3000"
+	}
+
+	var providers []OIDCProvider
+
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+
+		p := OIDCProvider{
+			Name:         name,
+			DisplayName:  os.Getenv(prefix + "DISPLAY_NAME"),
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientId:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+			RedirectURL:  appUrl + "/auth/oidc/" + name + "/callback",
+			TrustEmail:   os.Getenv(prefix+"TRUST_EMAIL") == "true",
+		}
+
+		if p.DisplayName == "" {
+			p.DisplayName = name
+		}
+		if len(p.Scopes) == 0 {
+			p.Scopes = []string{oidc.ScopeOpenID, "email", "profile"}
+		}
+
+		if p.Issuer == "" || p.ClientId == "" {
+			log.Println("NewOIDCProvidersFromEnv: skipping", name, "without issuer or client id")
+			continue
+		}
+
+		providers = append(providers, p)
+	}
+
+	return providers
+}
+
+// WithOIDCProviders enables signing in with the given OpenID Connect providers.
+func WithOIDCProviders(providers ...OIDCProvider) Option {
+	return func(s *service) {
+		for _, p := range providers {
+			s.oidcProviders = append(s.oidcProviders, p)
+			s.oidcClients[p.Name] = &oidcClient{config: p}
+		}
+	}
+}
+
+func (s *service) OIDCProviders() []OIDCProvider {
+	return s.oidcProviders
+}
+
+// BeginOIDCLogin builds the authorization code request with PKCE for provider.
+func (s *service) BeginOIDCLogin(ctx context.Context, provider string) (OIDCAuthRequest, error) {
+	c, ok := s.oidcClients[provider]
+	if !ok {
+		return OIDCAuthRequest{}, ErrUnknownOIDCProvider
+	}
+
+	_, config, err := c.discover(ctx)
+	if err != nil {
+		log.Println("AuthService BeginOIDCLogin discover:", err)
+		return OIDCAuthRequest{}, ErrSomethingWentWrong
+	}
+
+	state, err := randomToken()
+	if err != nil {
+		log.Println("AuthService BeginOIDCLogin randomToken:", err)
+		return OIDCAuthRequest{}, ErrSomethingWentWrong
+	}
+
+	nonce, err := randomToken()
+	if err != nil {
+		log.Println("AuthService BeginOIDCLogin randomToken:", err)
+		return OIDCAuthRequest{}, ErrSomethingWentWrong
+	}
+
+	verifier := oauth2.GenerateVerifier()
+
+	return OIDCAuthRequest{
+			URL:      config.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)),
+			State:    state,
+			Nonce:    nonce,
+			Verifier: verifier,
+		},
+		nil
+}
+
+// FinishOIDCLogin exchanges code for the ID token of the user after checking
+// state against the request started by BeginOIDCLogin.
+func (s *service) FinishOIDCLogin(ctx context.Context, provider, state, code string, req OIDCAuthRequest) (OIDCIdentity, error) {
+	c, ok := s.oidcClients[provider]
+	if !ok {
+		return OIDCIdentity{}, ErrUnknownOIDCProvider
+	}
+
+	if req.State == "" || subtle.ConstantTimeCompare([]byte(state), []byte(req.State)) != 1 {
+		return OIDCIdentity{}, ErrInvalidOIDCResponse
+	}
+
+	p, config, err := c.discover(ctx)
+	if err != nil {
+		log.Println("AuthService FinishOIDCLogin discover:", err)
+		return OIDCIdentity{}, ErrSomethingWentWrong
+	}
+
+	t, err := config.Exchange(ctx, code, oauth2.VerifierOption(req.Verifier))
+	if err != nil {
+		log.Println("AuthService FinishOIDCLogin Exchange:", err)
+		return OIDCIdentity{}, ErrInvalidOIDCResponse
+	}
+
+	rawIdToken, ok := t.Extra("id_token").(string)
+	if !ok {
+		log.Println("AuthService FinishOIDCLogin: no id_token in the token response of", provider)
+		return OIDCIdentity{}, ErrInvalidOIDCResponse
+	}
+
+	idToken, err := p.Verifier(&oidc.Config{ClientID: c.config.ClientId}).Verify(ctx, rawIdToken)
+	if err != nil {
+		log.Println("AuthService FinishOIDCLogin Verify:", err)
+		return OIDCIdentity{}, ErrInvalidOIDCResponse
+	}
+
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(req.Nonce)) != 1 {
+		return OIDCIdentity{}, ErrInvalidOIDCResponse
+	}
+
+	claims := struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		Name          string `json:"name"`
+	}{}
+
+	if err := idToken.Claims(&claims); err != nil {
+		log.Println("AuthService FinishOIDCLogin Claims:", err)
+		return OIDCIdentity{}, ErrInvalidOIDCResponse
+	}
+
+	return OIDCIdentity{
+			Provider:      provider,
+			Subject:       idToken.Subject,
+			Email:         claims.Email,
+			EmailVerified: claims.EmailVerified,
+			Name:          claims.Name,
+			EmailTrusted:  c.config.TrustEmail,
+		},
+		nil
+}
+
+// LoginWithOIDC starts a session for the user linked to i, it returns
+// ErrOIDCIdentityNotLinked when the identity hasn't been seen before.
+func (s *service) LoginWithOIDC(ctx context.Context, i OIDCIdentity, c audit.Client) (Token, error) {
+	userId, err := s.repository.GetOIDCIdentityUserId(ctx, i.Provider, i.Subject)
+	if errors.Is(err, ErrOIDCIdentityNotLinked) {
+		// not a failure, user.Service registers or links the identity
+		return Token{}, err
+	}
+	if err != nil {
+		log.Println("AuthService LoginWithOIDC GetOIDCIdentityUserId:", err)
+		return Token{}, ErrSomethingWentWrong
+	}
+
+	t, err := s.issueToken(ctx, userId)
+	s.record(ctx, audit.NewEvent(audit.ActionLoginOIDC, userId, i.Email, c, err))
+
+	return t, err
+}
+
+// helpers
+func (c *oidcClient) discover(ctx context.Context) (*oidc.Provider, *oauth2.Config, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.provider == nil {
+		p, err := oidc.NewProvider(ctx, c.config.Issuer)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		c.provider = p
+	}
+
+	return c.provider, &oauth2.Config{
+		ClientID:     c.config.ClientId,
+		ClientSecret: c.config.ClientSecret,
+		Endpoint:     c.provider.Endpoint(),
+		RedirectURL:  c.config.RedirectURL,
+		Scopes:       c.config.Scopes,
+	}, nil
+}
@@ -0,0 +1,255 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cativovo/go-demo-auth/pkg/audit"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+const passkeySessionLifetime = 5 * time.Minute
+
+type Passkey struct {
+	UserId     string
+	Credential webauthn.Credential
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+}
+
+// passkeyUser adapts a user id and its passkeys to webauthn.User. The user
+// handle is the user id, which is what discoverable logins hand back to us.
+type passkeyUser struct {
+	id          string
+	name        string
+	displayName string
+	credentials []webauthn.Credential
+}
+
+func (u *passkeyUser) WebAuthnID() []byte {
+	return []byte(u.id)
+}
+
+func (u *passkeyUser) WebAuthnName() string {
+	return u.name
+}
+
+func (u *passkeyUser) WebAuthnDisplayName() string {
+	return u.displayName
+}
+
+func (u *passkeyUser) WebAuthnIcon() string {
+	return ""
+}
+
+func (u *passkeyUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
+
+// NewWebAuthnFromEnv configures the relying party from WEBAUTHN_RP_ID and the
+// comma separated WEBAUTHN_RP_ORIGINS.
+func NewWebAuthnFromEnv() (*webauthn.WebAuthn, error) {
+	rpId := os.Getenv("WEBAUTHN_RP_ID")
+	if rpId == "" {
+		rpId = "localhost"
+	}
+
+	origins := strings.Split(os.Getenv("WEBAUTHN_RP_ORIGINS"), ",")
+	if origins[0] == "" {
+		origins = []string{"http://localhost:3000"}
+	}
+
+	return webauthn.New(&webauthn.Config{
+		RPID:          rpId,
+		RPDisplayName: totpIssuer,
+		RPOrigins:     origins,
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementRequired,
+			UserVerification: protocol.VerificationRequired,
+		},
+	})
+}
+
+func (s *service) GetPasskeys(ctx context.Context, userId string) ([]Passkey, error) {
+	return s.repository.GetPasskeysByUserId(ctx, userId)
+}
+
+// BeginPasskeyRegistration returns the JSON creation options for
+// navigator.credentials.create and the id of the ceremony.
+func (s *service) BeginPasskeyRegistration(ctx context.Context, userId, name, displayName string) ([]byte, string, error) {
+	if s.webAuthn == nil {
+		return nil, "", ErrPasskeysDisabled
+	}
+
+	u, err := s.passkeyUser(ctx, userId, name, displayName)
+	if err != nil {
+		return nil, "", err
+	}
+
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(u.credentials))
+	for _, c := range u.credentials {
+		exclusions = append(exclusions, c.Descriptor())
+	}
+
+	creation, session, err := s.webAuthn.BeginRegistration(u, webauthn.WithExclusions(exclusions))
+	if err != nil {
+		log.Println("AuthService BeginPasskeyRegistration BeginRegistration:", err)
+		return nil, "", ErrSomethingWentWrong
+	}
+
+	return s.startPasskeyCeremony(ctx, creation, session)
+}
+
+func (s *service) FinishPasskeyRegistration(ctx context.Context, userId, name, displayName, ceremonyId string, body io.Reader) error {
+	if s.webAuthn == nil {
+		return ErrPasskeysDisabled
+	}
+
+	session, err := s.repository.TakeWebAuthnSession(ctx, hashToken(ceremonyId))
+	if err != nil {
+		return ErrInvalidChallenge
+	}
+
+	u, err := s.passkeyUser(ctx, userId, name, displayName)
+	if err != nil {
+		return err
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(body)
+	if err != nil {
+		log.Println("AuthService FinishPasskeyRegistration ParseCredentialCreationResponseBody:", err)
+		return ErrInvalidPasskey
+	}
+
+	credential, err := s.webAuthn.CreateCredential(u, session, parsed)
+	if err != nil {
+		log.Println("AuthService FinishPasskeyRegistration CreateCredential:", err)
+		return ErrInvalidPasskey
+	}
+
+	p := Passkey{
+		UserId:     userId,
+		Credential: *credential,
+	}
+
+	if err := s.repository.AddPasskey(ctx, p); err != nil {
+		log.Println("AuthService FinishPasskeyRegistration AddPasskey:", err)
+		return ErrSomethingWentWrong
+	}
+
+	return nil
+}
+
+// BeginPasskeyLogin starts a discoverable login, the authenticator picks
+// the account so the user doesn't have to type an email.
+func (s *service) BeginPasskeyLogin(ctx context.Context) ([]byte, string, error) {
+	if s.webAuthn == nil {
+		return nil, "", ErrPasskeysDisabled
+	}
+
+	assertion, session, err := s.webAuthn.BeginDiscoverableLogin()
+	if err != nil {
+		log.Println("AuthService BeginPasskeyLogin BeginDiscoverableLogin:", err)
+		return nil, "", ErrSomethingWentWrong
+	}
+
+	return s.startPasskeyCeremony(ctx, assertion, session)
+}
+
+func (s *service) FinishPasskeyLogin(ctx context.Context, ceremonyId string, body io.Reader, c audit.Client) (Token, error) {
+	t, err := s.finishPasskeyLogin(ctx, ceremonyId, body)
+	s.record(ctx, audit.NewEvent(audit.ActionLoginPasskey, t.UserId, "", c, err))
+
+	return t, err
+}
+
+func (s *service) finishPasskeyLogin(ctx context.Context, ceremonyId string, body io.Reader) (Token, error) {
+	if s.webAuthn == nil {
+		return Token{}, ErrPasskeysDisabled
+	}
+
+	session, err := s.repository.TakeWebAuthnSession(ctx, hashToken(ceremonyId))
+	if err != nil {
+		return Token{}, ErrInvalidChallenge
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(body)
+	if err != nil {
+		log.Println("AuthService FinishPasskeyLogin ParseCredentialRequestResponseBody:", err)
+		return Token{}, ErrInvalidPasskey
+	}
+
+	var userId string
+
+	handler := func(rawId, userHandle []byte) (webauthn.User, error) {
+		userId = string(userHandle)
+		return s.passkeyUser(ctx, userId, "", "")
+	}
+
+	credential, err := s.webAuthn.ValidateDiscoverableLogin(handler, session, parsed)
+	if err != nil {
+		log.Println("AuthService FinishPasskeyLogin ValidateDiscoverableLogin:", err)
+		return Token{}, ErrInvalidPasskey
+	}
+
+	if credential.Authenticator.CloneWarning {
+		log.Println("AuthService FinishPasskeyLogin: possible cloned authenticator for user", userId)
+		return Token{}, ErrInvalidPasskey
+	}
+
+	if err := s.repository.UpdatePasskey(ctx, *credential); err != nil {
+		log.Println("AuthService FinishPasskeyLogin UpdatePasskey:", err)
+	}
+
+	return s.issueToken(ctx, userId)
+}
+
+// helpers
+func (s *service) passkeyUser(ctx context.Context, userId, name, displayName string) (*passkeyUser, error) {
+	passkeys, err := s.repository.GetPasskeysByUserId(ctx, userId)
+	if err != nil {
+		log.Println("AuthService passkeyUser GetPasskeysByUserId:", err)
+		return nil, ErrSomethingWentWrong
+	}
+
+	credentials := make([]webauthn.Credential, 0, len(passkeys))
+	for _, p := range passkeys {
+		credentials = append(credentials, p.Credential)
+	}
+
+	return &passkeyUser{
+		id:          userId,
+		name:        name,
+		displayName: displayName,
+		credentials: credentials,
+	}, nil
+}
+
+// startPasskeyCeremony stores the session data server-side and returns the
+// options for the browser together with the id it has to send back.
+func (s *service) startPasskeyCeremony(ctx context.Context, options any, session *webauthn.SessionData) ([]byte, string, error) {
+	payload, err := json.Marshal(options)
+	if err != nil {
+		log.Println("AuthService startPasskeyCeremony Marshal:", err)
+		return nil, "", ErrSomethingWentWrong
+	}
+
+	id, err := randomToken()
+	if err != nil {
+		log.Println("AuthService startPasskeyCeremony randomToken:", err)
+		return nil, "", ErrSomethingWentWrong
+	}
+
+	if err := s.repository.AddWebAuthnSession(ctx, hashToken(id), *session, time.Now().Add(passkeySessionLifetime)); err != nil {
+		log.Println("AuthService startPasskeyCeremony AddWebAuthnSession:", err)
+		return nil, "", ErrSomethingWentWrong
+	}
+
+	return payload, id, nil
+}
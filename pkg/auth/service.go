@@ -1,12 +1,52 @@
 package auth
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"io"
+	"log"
+	"time"
+
+	"github.com/cativovo/go-demo-auth/pkg/audit"
+	"github.com/cativovo/go-demo-auth/pkg/mail"
+	"github.com/cativovo/go-demo-auth/pkg/password"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/golang-jwt/jwt/v5"
 )
 
 var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
 	ErrSomethingWentWrong = errors.New("something went wrong")
+	ErrInvalidToken       = errors.New("invalid token")
+	ErrInvalidTOTPCode    = errors.New("invalid authentication code")
+	ErrTOTPNotEnrolled    = errors.New("two-factor authentication is not enrolled")
+	ErrTOTPAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrInvalidChallenge   = errors.New("login challenge is invalid or expired")
+	ErrPasskeysDisabled   = errors.New("passkeys are not enabled")
+	ErrInvalidPasskey     = errors.New("invalid passkey")
+	ErrPasswordTooShort   = password.ErrTooShort
+	ErrEmailNotVerified   = errors.New("email is not verified")
+	ErrAccountDisabled    = errors.New("account is disabled")
+
+	ErrUnknownOIDCProvider   = errors.New("unknown identity provider")
+	ErrInvalidOIDCResponse   = errors.New("invalid response from the identity provider")
+	ErrOIDCIdentityNotLinked = errors.New("identity is not linked to a user")
+
+	ErrTooManyAttempts = errors.New("too many failed login attempts")
+	ErrAccountLocked   = errors.New("account is temporarily locked")
+	ErrIPBlocked       = errors.New("too many failed login attempts from this address")
+
+	ErrSessionRevoked  = errors.New("session has been signed out")
+	ErrSessionNotFound = errors.New("session not found")
+
+	ErrInvalidAPITokenName     = errors.New("token name is required and must be at most 64 characters")
+	ErrInvalidAPITokenScope    = errors.New("invalid token scope")
+	ErrInvalidAPITokenLifetime = errors.New("token must expire within a year")
+	ErrAPITokenNotFound        = errors.New("token not found")
 )
 
 type Token struct {
@@ -18,35 +58,377 @@ type Token struct {
 }
 
 type Service interface {
-	Login(email, password string) (Token, error)
-	Logout(token string) error
-	GetUserId(token string) (string, error)
+	// Login returns a ThrottledError instead of checking the password when
+	// the account or ip of c failed to log in too many times.
+	Login(ctx context.Context, email, password string, c audit.Client) (Token, error)
+	// CheckPassword asks a signed in user for their password again before a
+	// sensitive change, it is throttled and locked out like Login.
+	CheckPassword(ctx context.Context, userId, email, password string, c audit.Client) error
+	Logout(ctx context.Context, token string, c audit.Client) error
+	GetUserId(ctx context.Context, token string) (string, error)
+	VerifyToken(ctx context.Context, token string) (Claims, error)
+	Refresh(ctx context.Context, refreshToken string) (Token, error)
+	EnrollTOTP(ctx context.Context, userId, account string) (TOTPEnrollment, error)
+	ConfirmTOTP(ctx context.Context, userId, code string) error
+	DisableTOTP(ctx context.Context, userId, code string) error
+	IsTOTPEnabled(ctx context.Context, userId string) (bool, error)
+	StartLoginChallenge(ctx context.Context, t Token) (string, error)
+	// CompleteLoginChallenge returns a ThrottledError instead of checking
+	// the code when the user typed too many wrong codes, whichever
+	// challenges they were typed into.
+	CompleteLoginChallenge(ctx context.Context, challengeId, code string, c audit.Client) (Token, error)
+	GetPasskeys(ctx context.Context, userId string) ([]Passkey, error)
+	BeginPasskeyRegistration(ctx context.Context, userId, name, displayName string) ([]byte, string, error)
+	FinishPasskeyRegistration(ctx context.Context, userId, name, displayName, ceremonyId string, body io.Reader) error
+	BeginPasskeyLogin(ctx context.Context) ([]byte, string, error)
+	FinishPasskeyLogin(ctx context.Context, ceremonyId string, body io.Reader, c audit.Client) (Token, error)
+	SendMagicLink(ctx context.Context, email string) error
+	LoginWithMagicLink(ctx context.Context, token string, c audit.Client) (Token, error)
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, password string) error
+	OIDCProviders() []OIDCProvider
+	BeginOIDCLogin(ctx context.Context, provider string) (OIDCAuthRequest, error)
+	FinishOIDCLogin(ctx context.Context, provider, state, code string, req OIDCAuthRequest) (OIDCIdentity, error)
+	LoginWithOIDC(ctx context.Context, i OIDCIdentity, c audit.Client) (Token, error)
+	UnlockAccount(ctx context.Context, token string) error
+	TouchSession(ctx context.Context, c Claims, userAgent, ip string) error
+	GetSessions(ctx context.Context, userId, currentSessionId string) ([]Session, error)
+	RevokeSession(ctx context.Context, userId, sessionId string) error
+	RevokeOtherSessions(ctx context.Context, token string) error
+	CreateAPIToken(ctx context.Context, userId, name string, scopes []string, lifetime time.Duration) (string, APIToken, error)
+	GetAPITokens(ctx context.Context, userId string) ([]APIToken, error)
+	RevokeAPIToken(ctx context.Context, userId, tokenId string) error
+	VerifyAPIToken(ctx context.Context, token string) (APIToken, error)
 }
 
 type Repository interface {
-	Login(email, password string) (Token, error)
-	Logout(token string) error
-	GetUserId(token string) (string, error)
+	Login(ctx context.Context, email, password string) (Token, error)
+	// VerifyPassword returns ErrInvalidCredentials when password isn't the
+	// one of the user.
+	VerifyPassword(ctx context.Context, userId, email, password string) error
+	Logout(ctx context.Context, token string) error
+	GetUserId(ctx context.Context, token string) (string, error)
+	Refresh(ctx context.Context, refreshToken string) (Token, error)
+	// IssueToken starts a session for a user who authenticated without a
+	// password, e.g. with a passkey.
+	IssueToken(ctx context.Context, userId string) (Token, error)
+	// SendMagicLink emails a single-use sign-in link, unknown emails are
+	// silently ignored.
+	SendMagicLink(ctx context.Context, email string) error
+	VerifyMagicLink(ctx context.Context, token string) (Token, error)
+	// RequestPasswordReset emails a single-use reset link, unknown emails
+	// are silently ignored.
+	RequestPasswordReset(ctx context.Context, email string) error
+	// ResetPassword sets the new password and ends the sessions of the
+	// user at the provider, it returns the id of the user.
+	ResetPassword(ctx context.Context, token, password string) (string, error)
+	SaveTOTPSecret(ctx context.Context, userId, secret string) error
+	GetTOTPSecret(ctx context.Context, userId string) (TOTPSecret, error)
+	ConfirmTOTPSecret(ctx context.Context, userId string) error
+	// UpdateTOTPLastUsedStep returns false when step isn't after the last
+	// used one, e.g. when a concurrent request used the same code.
+	UpdateTOTPLastUsedStep(ctx context.Context, userId string, step int64) (bool, error)
+	DeleteTOTPSecret(ctx context.Context, userId string) error
+	AddLoginChallenge(ctx context.Context, c LoginChallenge) error
+	GetLoginChallenge(ctx context.Context, idHash string) (LoginChallenge, error)
+	IncrementLoginChallengeAttempts(ctx context.Context, idHash string) error
+	DeleteLoginChallenge(ctx context.Context, idHash string) error
+	AddPasskey(ctx context.Context, p Passkey) error
+	GetPasskeysByUserId(ctx context.Context, userId string) ([]Passkey, error)
+	UpdatePasskey(ctx context.Context, c webauthn.Credential) error
+	AddWebAuthnSession(ctx context.Context, idHash string, s webauthn.SessionData, expiresAt time.Time) error
+	TakeWebAuthnSession(ctx context.Context, idHash string) (webauthn.SessionData, error)
+	// GetOIDCIdentityUserId returns ErrOIDCIdentityNotLinked for an identity
+	// that hasn't been seen before.
+	GetOIDCIdentityUserId(ctx context.Context, provider, subject string) (string, error)
+	GetLoginFailures(ctx context.Context, key string) (LoginFailures, error)
+	// RecordLoginFailure increments the failures of key, starting over
+	// when the last one happened before resetBefore.
+	RecordLoginFailure(ctx context.Context, key string, resetBefore time.Time) (LoginFailures, error)
+	LockLogin(ctx context.Context, key string, until time.Time, unlockTokenHash string) error
+	ClearLoginFailures(ctx context.Context, key string) error
+	UnlockLogin(ctx context.Context, unlockTokenHash string) error
+	EmailExists(ctx context.Context, email string) (bool, error)
+	GetUserEmail(ctx context.Context, userId string) (string, error)
+	IsUserDisabled(ctx context.Context, userId string) (bool, error)
+	// TouchSession creates or updates the session, it returns false when
+	// the session was revoked.
+	TouchSession(ctx context.Context, s Session) (bool, error)
+	GetActiveSessions(ctx context.Context, userId string, seenAfter time.Time) ([]Session, error)
+	RevokeSession(ctx context.Context, userId, sessionId string) (bool, error)
+	RevokeOtherSessions(ctx context.Context, userId, currentSessionId string) error
+	RevokeAllSessions(ctx context.Context, userId string) error
+	// LogoutSession ends the session at the provider, if it can be ended
+	// by id.
+	LogoutSession(ctx context.Context, userId, sessionId string) error
+	// LogoutOthers ends every session of the user but the one of token.
+	LogoutOthers(ctx context.Context, token string) error
+	AddAPIToken(ctx context.Context, t APIToken, tokenHash string) (APIToken, error)
+	GetAPITokenByHash(ctx context.Context, tokenHash string) (APIToken, error)
+	GetAPITokensByUserId(ctx context.Context, userId string) ([]APIToken, error)
+	UpdateAPITokenLastUsed(ctx context.Context, id string) error
+	DeleteAPIToken(ctx context.Context, userId, id string) (bool, error)
 }
 
 type service struct {
-	repository Repository
+	repository     Repository
+	verifier       *Verifier
+	remoteFallback bool
+	webAuthn       *webauthn.WebAuthn
+	oidcProviders  []OIDCProvider
+	oidcClients    map[string]*oidcClient
+	mailer         mail.Mailer
+	appUrl         string
+	auditor        audit.Auditor
+	passwordPolicy password.Policy
+}
+
+type Option func(*service)
+
+// WithVerifier makes the service verify access tokens locally instead of
+// asking the repository on every call.
+func WithVerifier(v *Verifier) Option {
+	return func(s *service) {
+		s.verifier = v
+	}
+}
+
+// WithRemoteFallback asks the repository when a token can't be verified
+// locally, e.g. when the signing key is unknown or the JWKS is unreachable.
+func WithRemoteFallback() Option {
+	return func(s *service) {
+		s.remoteFallback = true
+	}
+}
+
+// WithWebAuthn enables passkey registration and login.
+func WithWebAuthn(w *webauthn.WebAuthn) Option {
+	return func(s *service) {
+		s.webAuthn = w
+	}
+}
+
+// WithPasswordPolicy replaces password.DefaultPolicy for the password
+// resets.
+func WithPasswordPolicy(p password.Policy) Option {
+	return func(s *service) {
+		s.passwordPolicy = p
+	}
+}
+
+// WithAuditor records the logins and logouts.
+func WithAuditor(a audit.Auditor) Option {
+	return func(s *service) {
+		s.auditor = a
+	}
+}
+
+func NewAuthService(r Repository, opts ...Option) Service {
+	s := &service{
+		repository:     r,
+		oidcClients:    map[string]*oidcClient{},
+		passwordPolicy: password.DefaultPolicy(),
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+func (s *service) Login(ctx context.Context, email, password string, c audit.Client) (Token, error) {
+	t, err := s.login(ctx, email, password, c.IP)
+	s.record(ctx, audit.NewEvent(audit.ActionLoginPassword, t.UserId, email, c, err))
+
+	return t, err
+}
+
+func (s *service) login(ctx context.Context, email, password, ip string) (Token, error) {
+	var t Token
+
+	err := s.withLockout(ctx, email, ip, func() error {
+		var err error
+
+		t, err = s.repository.Login(ctx, email, password)
+		if err != nil {
+			return err
+		}
+
+		return s.checkIssuedToken(ctx, t)
+	})
+	if err != nil {
+		return Token{}, err
+	}
+
+	return t, nil
+}
+
+func (s *service) CheckPassword(ctx context.Context, userId, email, password string, c audit.Client) error {
+	return s.withLockout(ctx, email, c.IP, func() error {
+		return s.repository.VerifyPassword(ctx, userId, email, password)
+	})
+}
+
+func (s *service) Logout(ctx context.Context, token string, c audit.Client) error {
+	claims, err := s.VerifyToken(ctx, token)
+	if err == nil && claims.SessionId != "" {
+		if _, err := s.repository.RevokeSession(ctx, claims.Subject, claims.SessionId); err != nil {
+			log.Println("AuthService Logout RevokeSession:", err)
+		}
+	}
+
+	err = s.repository.Logout(ctx, token)
+	s.record(ctx, audit.NewEvent(audit.ActionLogout, claims.Subject, claims.Email, c, err))
+
+	return err
+}
+
+func (s *service) GetUserId(ctx context.Context, token string) (string, error) {
+	claims, err := s.VerifyToken(ctx, token)
+	if err != nil {
+		return "", err
+	}
+
+	return claims.Subject, nil
+}
+
+func (s *service) VerifyToken(ctx context.Context, token string) (Claims, error) {
+	if s.verifier != nil {
+		claims, err := s.verifier.Verify(token)
+		if err == nil || !s.remoteFallback || errors.Is(err, ErrInvalidToken) {
+			return claims, err
+		}
+	}
+
+	userId, err := s.repository.GetUserId(ctx, token)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	// the provider vouched for the token, its other claims are read without
+	// checking the signature again, the sessions need its session id
+	c := Claims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, &c); err != nil {
+		log.Println("AuthService VerifyToken ParseUnverified:", err)
+	}
+	c.Subject = userId
+
+	return c, nil
+}
+
+func (s *service) Refresh(ctx context.Context, refreshToken string) (Token, error) {
+	t, err := s.repository.Refresh(ctx, refreshToken)
+	if err != nil {
+		return Token{}, err
+	}
+
+	if err := s.checkDisabled(ctx, t.UserId); err != nil {
+		return Token{}, err
+	}
+
+	return t, nil
 }
 
-func NewAuthService(r Repository) Service {
-	return &service{
-		repository: r,
+func (s *service) SendMagicLink(ctx context.Context, email string) error {
+	return s.repository.SendMagicLink(ctx, email)
+}
+
+func (s *service) LoginWithMagicLink(ctx context.Context, token string, c audit.Client) (Token, error) {
+	t, err := s.repository.VerifyMagicLink(ctx, token)
+	if err == nil {
+		err = s.checkIssuedToken(ctx, t)
+	}
+	s.record(ctx, audit.NewEvent(audit.ActionLoginMagicLink, t.UserId, "", c, err))
+
+	if err != nil {
+		return Token{}, err
 	}
+
+	return t, nil
 }
 
-func (s *service) Login(email, password string) (Token, error) {
-	return s.repository.Login(email, password)
+func (s *service) RequestPasswordReset(ctx context.Context, email string) error {
+	return s.repository.RequestPasswordReset(ctx, email)
 }
 
-func (s *service) Logout(token string) error {
-	return s.repository.Logout(token)
+// ResetPassword can't ban the email and name of the user, the token is
+// only read by the repository. Every session of the user is revoked since
+// the old password may have been compromised.
+func (s *service) ResetPassword(ctx context.Context, token, newPassword string) error {
+	if err := s.passwordPolicy.Check(newPassword); err != nil {
+		return err
+	}
+
+	userId, err := s.repository.ResetPassword(ctx, token, newPassword)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repository.RevokeAllSessions(ctx, userId); err != nil {
+		log.Println("AuthService ResetPassword RevokeAllSessions:", err)
+		return ErrSomethingWentWrong
+	}
+
+	return nil
+}
+
+// helpers
+func (s *service) record(ctx context.Context, e audit.Event) {
+	if s.auditor != nil {
+		s.auditor.Record(ctx, e)
+	}
+}
+
+// checkDisabled returns ErrAccountDisabled when an administrator disabled
+// the user.
+func (s *service) checkDisabled(ctx context.Context, userId string) error {
+	disabled, err := s.repository.IsUserDisabled(ctx, userId)
+	if err != nil {
+		log.Println("AuthService checkDisabled IsUserDisabled:", err)
+		return ErrSomethingWentWrong
+	}
+
+	if disabled {
+		return ErrAccountDisabled
+	}
+
+	return nil
+}
+
+// issueToken starts a session for a user who authenticated without a
+// password, unless they are disabled.
+func (s *service) issueToken(ctx context.Context, userId string) (Token, error) {
+	if err := s.checkDisabled(ctx, userId); err != nil {
+		return Token{}, err
+	}
+
+	return s.repository.IssueToken(ctx, userId)
+}
+
+// checkIssuedToken ends the session of t when its user is disabled, for
+// the logins where the repository issues the token.
+func (s *service) checkIssuedToken(ctx context.Context, t Token) error {
+	if err := s.checkDisabled(ctx, t.UserId); err != nil {
+		if err := s.repository.Logout(ctx, t.AccessToken); err != nil {
+			log.Println("AuthService checkIssuedToken Logout:", err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
 }
 
-func (s *service) GetUserId(token string) (string, error) {
-	return s.repository.GetUserId(token)
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+)
+
+// sessionIdleTimeout matches the lifetime of refresh tokens, sessions not
+// seen for longer can't be used anymore and aren't listed.
+const sessionIdleTimeout = 30 * 24 * time.Hour
+
+// Session is a signed in device. Id is the session_id claim of its access
+// tokens.
+type Session struct {
+	Id         string
+	UserId     string
+	UserAgent  string
+	IP         string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	// Current is set by GetSessions for the session making the request.
+	Current bool
+}
+
+// Device describes the browser and the operating system of the session,
+// e.g. "Firefox on Linux".
+func (s Session) Device() string {
+	browser := matchUserAgent(s.UserAgent, [][2]string{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	})
+	platform := matchUserAgent(s.UserAgent, [][2]string{
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	})
+
+	switch {
+	case browser != "" && platform != "":
+		return browser + " on " + platform
+	case browser != "":
+		return browser
+	case platform != "":
+		return platform
+	default:
+		return "Unknown device"
+	}
+}
+
+// TouchSession records that the session of c is being used from userAgent
+// and ip, it returns ErrSessionRevoked once the session was signed out,
+// ErrAccountDisabled once the user was disabled and ErrSessionNotFound when
+// c has no session id.
+func (s *service) TouchSession(ctx context.Context, c Claims, userAgent, ip string) error {
+	if err := s.checkDisabled(ctx, c.Subject); err != nil {
+		return err
+	}
+
+	// a session that can't be tracked couldn't be signed out either
+	if c.SessionId == "" {
+		log.Println("AuthService TouchSession: no session id in the token of", c.Subject)
+		return ErrSessionNotFound
+	}
+
+	active, err := s.repository.TouchSession(ctx, Session{
+		Id:        c.SessionId,
+		UserId:    c.Subject,
+		UserAgent: userAgent,
+		IP:        ip,
+	})
+	if err != nil {
+		log.Println("AuthService TouchSession TouchSession:", err)
+		return ErrSomethingWentWrong
+	}
+
+	if !active {
+		return ErrSessionRevoked
+	}
+
+	return nil
+}
+
+func (s *service) GetSessions(ctx context.Context, userId, currentSessionId string) ([]Session, error) {
+	sessions, err := s.repository.GetActiveSessions(ctx, userId, time.Now().Add(-sessionIdleTimeout))
+	if err != nil {
+		log.Println("AuthService GetSessions GetActiveSessions:", err)
+		return nil, ErrSomethingWentWrong
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].Id == currentSessionId
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession signs the device of sessionId out, the provider is asked to
+// end the session too when it supports it.
+func (s *service) RevokeSession(ctx context.Context, userId, sessionId string) error {
+	revoked, err := s.repository.RevokeSession(ctx, userId, sessionId)
+	if err != nil {
+		log.Println("AuthService RevokeSession RevokeSession:", err)
+		return ErrSomethingWentWrong
+	}
+
+	if !revoked {
+		return ErrSessionNotFound
+	}
+
+	return s.repository.LogoutSession(ctx, userId, sessionId)
+}
+
+// RevokeOtherSessions signs out every device but the one token belongs to.
+func (s *service) RevokeOtherSessions(ctx context.Context, token string) error {
+	claims, err := s.VerifyToken(ctx, token)
+	if err != nil {
+		return err
+	}
+
+	if claims.SessionId == "" {
+		return ErrSessionNotFound
+	}
+
+	if err := s.repository.RevokeOtherSessions(ctx, claims.Subject, claims.SessionId); err != nil {
+		log.Println("AuthService RevokeOtherSessions RevokeOtherSessions:", err)
+		return ErrSomethingWentWrong
+	}
+
+	return s.repository.LogoutOthers(ctx, token)
+}
+
+// helpers
+func matchUserAgent(userAgent string, names [][2]string) string {
+	for _, n := range names {
+		if strings.Contains(userAgent, n[0]) {
+			return n[1]
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,304 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/cativovo/go-demo-auth/pkg/audit"
+)
+
+// RFC 6238 defaults, these are the only parameters most authenticator apps support.
+const (
+	totpPeriod = 30
+	totpDigits = 6
+	// totpSkew is how many periods before and after the current one are accepted.
+	totpSkew = 1
+
+	totpIssuer = "Go Demo Auth"
+
+	loginChallengeLifetime    = 5 * time.Minute
+	maxLoginChallengeAttempts = 5
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type TOTPSecret struct {
+	UserId       string
+	Secret       string
+	Confirmed    bool
+	LastUsedStep int64
+}
+
+type TOTPEnrollment struct {
+	Secret string
+	URI    string
+}
+
+// LoginChallenge holds the token of a password login until the second factor
+// is verified. IdHash is the sha256 of the id handed to the browser.
+type LoginChallenge struct {
+	IdHash    string
+	Token     Token
+	Attempts  int
+	ExpiresAt time.Time
+}
+
+func (s *service) EnrollTOTP(ctx context.Context, userId, account string) (TOTPEnrollment, error) {
+	existing, err := s.repository.GetTOTPSecret(ctx, userId)
+	if err == nil && existing.Confirmed {
+		return TOTPEnrollment{}, ErrTOTPAlreadyEnabled
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		log.Println("AuthService EnrollTOTP generateTOTPSecret:", err)
+		return TOTPEnrollment{}, ErrSomethingWentWrong
+	}
+
+	if err := s.repository.SaveTOTPSecret(ctx, userId, secret); err != nil {
+		log.Println("AuthService EnrollTOTP SaveTOTPSecret:", err)
+		return TOTPEnrollment{}, ErrSomethingWentWrong
+	}
+
+	return TOTPEnrollment{
+		Secret: secret,
+		URI:    totpURI(totpIssuer, account, secret),
+	}, nil
+}
+
+func (s *service) ConfirmTOTP(ctx context.Context, userId, code string) error {
+	secret, err := s.repository.GetTOTPSecret(ctx, userId)
+	if err != nil {
+		return ErrTOTPNotEnrolled
+	}
+
+	if secret.Confirmed {
+		return ErrTOTPAlreadyEnabled
+	}
+
+	if err := s.useTOTPCode(ctx, secret, code); err != nil {
+		return err
+	}
+
+	if err := s.repository.ConfirmTOTPSecret(ctx, userId); err != nil {
+		log.Println("AuthService ConfirmTOTP ConfirmTOTPSecret:", err)
+		return ErrSomethingWentWrong
+	}
+
+	return nil
+}
+
+func (s *service) DisableTOTP(ctx context.Context, userId, code string) error {
+	secret, err := s.repository.GetTOTPSecret(ctx, userId)
+	if err != nil || !secret.Confirmed {
+		return ErrTOTPNotEnrolled
+	}
+
+	if err := s.useTOTPCode(ctx, secret, code); err != nil {
+		return err
+	}
+
+	if err := s.repository.DeleteTOTPSecret(ctx, userId); err != nil {
+		log.Println("AuthService DisableTOTP DeleteTOTPSecret:", err)
+		return ErrSomethingWentWrong
+	}
+
+	return nil
+}
+
+func (s *service) IsTOTPEnabled(ctx context.Context, userId string) (bool, error) {
+	secret, err := s.repository.GetTOTPSecret(ctx, userId)
+	if err != nil {
+		// no row means the user never enrolled
+		return false, nil
+	}
+
+	return secret.Confirmed, nil
+}
+
+// StartLoginChallenge parks t server-side and returns the id the browser
+// presents together with the TOTP code to get it back.
+func (s *service) StartLoginChallenge(ctx context.Context, t Token) (string, error) {
+	id, err := randomToken()
+	if err != nil {
+		log.Println("AuthService StartLoginChallenge randomToken:", err)
+		return "", ErrSomethingWentWrong
+	}
+
+	c := LoginChallenge{
+		IdHash:    hashToken(id),
+		Token:     t,
+		ExpiresAt: time.Now().Add(loginChallengeLifetime),
+	}
+
+	if err := s.repository.AddLoginChallenge(ctx, c); err != nil {
+		log.Println("AuthService StartLoginChallenge AddLoginChallenge:", err)
+		return "", ErrSomethingWentWrong
+	}
+
+	return id, nil
+}
+
+func (s *service) CompleteLoginChallenge(ctx context.Context, challengeId, code string, client audit.Client) (Token, error) {
+	idHash := hashToken(challengeId)
+
+	c, err := s.repository.GetLoginChallenge(ctx, idHash)
+	if err != nil {
+		return Token{}, ErrInvalidChallenge
+	}
+
+	if time.Now().After(c.ExpiresAt) {
+		s.endLoginChallenge(ctx, idHash, c.Token)
+		return Token{}, ErrInvalidChallenge
+	}
+
+	secret, err := s.repository.GetTOTPSecret(ctx, c.Token.UserId)
+	if err != nil || !secret.Confirmed {
+		return Token{}, ErrInvalidChallenge
+	}
+
+	// the owner is told when the wrong codes lock the account, whoever
+	// typed them knows the password
+	email, err := s.repository.GetUserEmail(ctx, c.Token.UserId)
+	if err != nil {
+		log.Println("AuthService CompleteLoginChallenge GetUserEmail:", err)
+	}
+
+	err = s.withAccountLockout(ctx, totpLockoutKey(c.Token.UserId), email, client.IP, func() error {
+		return s.useTOTPCode(ctx, secret, code)
+	})
+	if err != nil {
+		if !errors.Is(err, ErrInvalidTOTPCode) {
+			return Token{}, err
+		}
+
+		// whoever typed the code knows the password
+		s.record(ctx, audit.NewEvent(audit.ActionLoginTOTP, c.Token.UserId, "", client, err))
+
+		if c.Attempts+1 >= maxLoginChallengeAttempts {
+			s.endLoginChallenge(ctx, idHash, c.Token)
+			return Token{}, ErrInvalidChallenge
+		}
+
+		if err := s.repository.IncrementLoginChallengeAttempts(ctx, idHash); err != nil {
+			log.Println("AuthService CompleteLoginChallenge IncrementLoginChallengeAttempts:", err)
+		}
+
+		return Token{}, err
+	}
+
+	if err := s.repository.DeleteLoginChallenge(ctx, idHash); err != nil {
+		log.Println("AuthService CompleteLoginChallenge DeleteLoginChallenge:", err)
+		return Token{}, ErrSomethingWentWrong
+	}
+
+	s.record(ctx, audit.NewEvent(audit.ActionLoginTOTP, c.Token.UserId, "", client, nil))
+
+	return c.Token, nil
+}
+
+// endLoginChallenge drops a challenge that can't be completed anymore and
+// signs out the token it was holding, nobody is ever handed that token.
+func (s *service) endLoginChallenge(ctx context.Context, idHash string, t Token) {
+	if err := s.repository.DeleteLoginChallenge(ctx, idHash); err != nil {
+		log.Println("AuthService endLoginChallenge DeleteLoginChallenge:", err)
+	}
+
+	if err := s.repository.Logout(ctx, t.AccessToken); err != nil {
+		log.Println("AuthService endLoginChallenge Logout:", err)
+	}
+}
+
+// useTOTPCode validates code and records its time step so it can't be replayed.
+func (s *service) useTOTPCode(ctx context.Context, secret TOTPSecret, code string) error {
+	step, ok := validateTOTP(secret.Secret, code, time.Now())
+	if !ok || step <= secret.LastUsedStep {
+		return ErrInvalidTOTPCode
+	}
+
+	// checked again by the update, two requests with the same code could
+	// both pass the check above
+	used, err := s.repository.UpdateTOTPLastUsedStep(ctx, secret.UserId, step)
+	if err != nil {
+		log.Println("AuthService useTOTPCode UpdateTOTPLastUsedStep:", err)
+		return ErrSomethingWentWrong
+	}
+	if !used {
+		return ErrInvalidTOTPCode
+	}
+
+	return nil
+}
+
+func generateTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return totpEncoding.EncodeToString(b), nil
+}
+
+// totpURI builds the otpauth:// URI understood by authenticator apps.
+func totpURI(issuer, account, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(totpDigits))
+	v.Set("period", fmt.Sprint(totpPeriod))
+
+	label := url.PathEscape(issuer + ":" + account)
+
+	return fmt.Sprintf("otpauth://totp/%s?%s", label, v.Encode())
+}
+
+func totpCode(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		return "", err
+	}
+
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	binCode := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", totpDigits, binCode%1_000_000), nil
+}
+
+// validateTOTP returns the time step the code matched so callers can reject
+// a code that has already been used.
+func validateTOTP(secret, code string, t time.Time) (int64, bool) {
+	current := t.Unix() / totpPeriod
+
+	for i := -totpSkew; i <= totpSkew; i++ {
+		step := current + int64(i)
+
+		expected, err := totpCode(secret, step)
+		if err != nil {
+			return 0, false
+		}
+
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+// the SHA1 secret of the RFC 6238 test vectors, "12345678901234567890"
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, the codes are the last 6 of its 8 digits
+	tests := []struct {
+		time int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		code, err := totpCode(rfc6238Secret, tt.time/totpPeriod)
+		if err != nil {
+			t.Fatalf("totpCode(%d): %v", tt.time, err)
+		}
+
+		if code != tt.code {
+			t.Errorf("totpCode(%d) = %q, want %q", tt.time, code, tt.code)
+		}
+	}
+}
+
+func TestTOTPCodeInvalidSecret(t *testing.T) {
+	if _, err := totpCode("not base32!", 1); err == nil {
+		t.Error("totpCode accepted an invalid secret")
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / totpPeriod
+
+	codeAt := func(step int64) string {
+		code, err := totpCode(rfc6238Secret, step)
+		if err != nil {
+			t.Fatalf("totpCode(%d): %v", step, err)
+		}
+		return code
+	}
+
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		step   int64
+		ok     bool
+	}{
+		{"current step", rfc6238Secret, codeAt(current), current, true},
+		{"previous step", rfc6238Secret, codeAt(current - 1), current - 1, true},
+		{"next step", rfc6238Secret, codeAt(current + 1), current + 1, true},
+		{"outside the skew", rfc6238Secret, codeAt(current - 2), 0, false},
+		{"wrong code", rfc6238Secret, "000000", 0, false},
+		{"empty code", rfc6238Secret, "", 0, false},
+		{"8 digit code", rfc6238Secret, "14050471", 0, false},
+		{"invalid secret", "not base32!", "050471", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := validateTOTP(tt.secret, tt.code, now)
+			if ok != tt.ok || step != tt.step {
+				t.Errorf("validateTOTP(%q) = %d, %v, want %d, %v", tt.code, step, ok, tt.step, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "test-secret-at-least-32-bytes-long!"
+
+func testClaims(exp time.Time) Claims {
+	return Claims{
+		SessionId: "session",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "user",
+			Audience:  jwt.ClaimStrings{"authenticated"},
+			Issuer:    "https://issuer.test",
+			ExpiresAt: jwt.NewNumericDate(exp),
+		},
+	}
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, kid string, claims jwt.Claims, key any) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+// writeJWKS writes the public keys to a JWKS file and returns its path.
+func writeJWKS(t *testing.T, rsaKey *rsa.PublicKey, ecKey *ecdsa.PublicKey) string {
+	t.Helper()
+
+	enc := base64.RawURLEncoding
+	set := jwks{Keys: []jwk{
+		{
+			Kid: "rsa",
+			Kty: "RSA",
+			N:   enc.EncodeToString(rsaKey.N.Bytes()),
+			E:   enc.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+		},
+		{
+			Kid: "ec",
+			Kty: "EC",
+			Crv: "P-256",
+			X:   enc.EncodeToString(ecKey.X.Bytes()),
+			Y:   enc.EncodeToString(ecKey.Y.Bytes()),
+		},
+	}}
+
+	b, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestVerifierVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := testClaims(time.Now().Add(time.Hour))
+	expired := testClaims(time.Now().Add(-time.Minute))
+	noExpiry := testClaims(time.Now())
+	noExpiry.ExpiresAt = nil
+	otherAudience := testClaims(time.Now().Add(time.Hour))
+	otherAudience.Audience = jwt.ClaimStrings{"other"}
+	otherIssuer := testClaims(time.Now().Add(time.Hour))
+	otherIssuer.Issuer = "https://other.test"
+
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, valid).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secretOnly := VerifierConfig{Secret: testSecret, Audience: "authenticated", Issuer: "https://issuer.test"}
+	jwksOnly := VerifierConfig{JWKS: writeJWKS(t, &rsaKey.PublicKey, &ecKey.PublicKey), Audience: "authenticated"}
+
+	tests := []struct {
+		name   string
+		config VerifierConfig
+		token  string
+		want   error
+	}{
+		{"HS256", secretOnly, signToken(t, jwt.SigningMethodHS256, "", valid, []byte(testSecret)), nil},
+		{"expired", secretOnly, signToken(t, jwt.SigningMethodHS256, "", expired, []byte(testSecret)), ErrInvalidToken},
+		{"no expiry", secretOnly, signToken(t, jwt.SigningMethodHS256, "", noExpiry, []byte(testSecret)), ErrInvalidToken},
+		{"other audience", secretOnly, signToken(t, jwt.SigningMethodHS256, "", otherAudience, []byte(testSecret)), ErrInvalidToken},
+		{"other issuer", secretOnly, signToken(t, jwt.SigningMethodHS256, "", otherIssuer, []byte(testSecret)), ErrInvalidToken},
+		{"wrong secret", secretOnly, signToken(t, jwt.SigningMethodHS256, "", valid, []byte("another secret")), ErrInvalidToken},
+		{"alg none", secretOnly, unsigned, ErrInvalidToken},
+		{"HS384", secretOnly, signToken(t, jwt.SigningMethodHS384, "", valid, []byte(testSecret)), ErrInvalidToken},
+		{"RS256 without a JWKS", secretOnly, signToken(t, jwt.SigningMethodRS256, "rsa", valid, rsaKey), ErrKeyUnavailable},
+		{"RS256", jwksOnly, signToken(t, jwt.SigningMethodRS256, "rsa", valid, rsaKey), nil},
+		{"ES256", jwksOnly, signToken(t, jwt.SigningMethodES256, "ec", valid, ecKey), nil},
+		{"RS512", jwksOnly, signToken(t, jwt.SigningMethodRS512, "rsa", valid, rsaKey), ErrInvalidToken},
+		{"expired RS256", jwksOnly, signToken(t, jwt.SigningMethodRS256, "rsa", expired, rsaKey), ErrInvalidToken},
+		{"key of another kid", jwksOnly, signToken(t, jwt.SigningMethodES256, "rsa", valid, ecKey), ErrInvalidToken},
+		{"unknown kid", jwksOnly, signToken(t, jwt.SigningMethodRS256, "unknown", valid, rsaKey), ErrKeyUnavailable},
+		// the public key mustn't be usable as an HMAC secret
+		{"HS256 without a secret", jwksOnly, signToken(t, jwt.SigningMethodHS256, "rsa", valid, rsaKey.PublicKey.N.Bytes()), ErrKeyUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := NewVerifier(tt.config).Verify(tt.token)
+
+			if tt.want != nil {
+				if !errors.Is(err, tt.want) {
+					t.Fatalf("Verify() error = %v, want %v", err, tt.want)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if claims.Subject != "user" || claims.SessionId != "session" {
+				t.Errorf("Verify() = %+v, want the claims of the token", claims)
+			}
+		})
+	}
+}
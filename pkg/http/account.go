@@ -0,0 +1,138 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/cativovo/go-demo-auth/pkg/auth"
+	"github.com/cativovo/go-demo-auth/pkg/ratelimit"
+	"github.com/cativovo/go-demo-auth/pkg/rbac"
+	"github.com/go-chi/chi/v5"
+)
+
+// accountExport is everything we store about the user, downloaded from the
+// account page.
+type accountExport struct {
+	ExportedAt  time.Time       `json:"exported_at"`
+	Profile     apiUser         `json:"profile"`
+	CreatedAt   time.Time       `json:"created_at"`
+	Sessions    []exportSession `json:"sessions"`
+	AuditEvents []apiAuditEvent `json:"audit_events"`
+}
+
+type exportSession struct {
+	Id         string    `json:"id"`
+	Device     string    `json:"device"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+}
+
+func (s *Server) registerAccountRoutes() {
+	s.router.Route("/account", func(r chi.Router) {
+		r.Use(authMiddleWare(s.authService, s.sessions, s.rbacService, s.orgService))
+		r.Use(sessionOnlyMiddleware)
+		r.With(s.rateLimit("export", ratelimit.Every(5, time.Hour), byUserId)).Get("/export", s.handleExportAccount)
+		r.With(s.rateLimit("delete-account", ratelimit.Every(10, 15*time.Minute), byUserId)).Post("/delete", s.handleDeleteAccount)
+	})
+}
+
+func (s *Server) handleExportAccount(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdKey).(string)
+	claims := r.Context().Value(claimsKey).(auth.Claims)
+
+	u, err := s.userService.GetUserById(r.Context(), userId)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	sessions, err := s.authService.GetSessions(r.Context(), u.Id, claims.SessionId)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	events, err := s.auditService.GetAllEvents(r.Context(), u.Id, u.Email)
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	access := r.Context().Value(accessKey).(rbac.Access)
+
+	e := accountExport{
+		ExportedAt: time.Now().UTC(),
+		Profile: apiUser{
+			Id:            u.Id,
+			Email:         u.Email,
+			Name:          u.Name,
+			EmailVerified: u.VerifiedAt != nil,
+			VerifiedAt:    u.VerifiedAt,
+			Roles:         access.Roles,
+			Permissions:   access.Permissions,
+		},
+		CreatedAt:   u.CreatedAt,
+		Sessions:    make([]exportSession, 0, len(sessions)),
+		AuditEvents: make([]apiAuditEvent, 0, len(events)),
+	}
+
+	for _, ss := range sessions {
+		e.Sessions = append(e.Sessions, exportSession{
+			Id:         ss.Id,
+			Device:     ss.Device(),
+			UserAgent:  ss.UserAgent,
+			IP:         ss.IP,
+			CreatedAt:  ss.CreatedAt,
+			LastSeenAt: ss.LastSeenAt,
+		})
+	}
+
+	for _, ev := range events {
+		e.AuditEvents = append(e.AuditEvents, toAPIAuditEvent(ev))
+	}
+
+	w.Header().Add("Cache-Control", "no-store, private")
+	w.Header().Add("Content-Disposition", fmt.Sprintf(`attachment; filename="account-%s.json"`, u.Id))
+	writeJSON(w, http.StatusOK, e)
+}
+
+// handleDeleteAccount deletes the account once the user typed their
+// password again, then signs this browser out like handleLogout.
+func (s *Server) handleDeleteAccount(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdKey).(string)
+
+	if err := s.userService.DeleteOwnAccount(r.Context(), userId, r.PostFormValue("password"), auditClient(r)); err != nil {
+		var throttled *auth.ThrottledError
+
+		message := "Something went wrong"
+		switch {
+		case errors.Is(err, auth.ErrInvalidCredentials):
+			message = "Your password is incorrect"
+		case errors.As(err, &throttled):
+			message = throttledMessage(throttled)
+		}
+
+		w.Header().Add("HX-Reswap", "none")
+		errorAlertTmpl.Execute(w, map[string]any{
+			"Message": message,
+		})
+		return
+	}
+
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		if err := s.sessions.End(r.Context(), c.Value); err != nil {
+			log.Println(err)
+		}
+	}
+
+	clearCookie(w, r)
+	redirect(w, r, "/auth-page/login")
+}
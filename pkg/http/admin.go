@@ -0,0 +1,250 @@
+package http
+
+import (
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/cativovo/go-demo-auth/pkg/rbac"
+	"github.com/cativovo/go-demo-auth/pkg/user"
+	"github.com/go-chi/chi/v5"
+)
+
+var adminUsersPageTmpl *template.Template = template.Must(
+	template.ParseFiles(
+		"web/base.html",
+		"web/layouts/private.html",
+		"web/components/nav.html",
+		"web/components/admin_users.html",
+		"web/components/admin_user_list.html",
+	),
+)
+
+var adminUserPageTmpl *template.Template = template.Must(
+	template.ParseFiles(
+		"web/base.html",
+		"web/layouts/private.html",
+		"web/components/nav.html",
+		"web/components/admin_user.html",
+		"web/components/admin_user_details.html",
+	),
+)
+
+var adminUserListTmpl *template.Template = template.Must(template.ParseFiles("web/components/admin_user_list.html"))
+
+var adminUserDetailsTmpl *template.Template = template.Must(template.ParseFiles("web/components/admin_user_details.html"))
+
+func (s *Server) registerAdminRoutes() {
+	s.router.Route("/admin", func(r chi.Router) {
+		r.Use(authMiddleWare(s.authService, s.sessions, s.rbacService, s.orgService))
+		r.Use(sessionOnlyMiddleware)
+		r.Use(RequirePermission(rbac.PermissionReadUsers))
+		r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "/admin/users", http.StatusFound)
+		})
+		r.Get("/users", s.adminUsersPage)
+		r.Get("/users/{userId}", s.adminUserPage)
+
+		r.Group(func(r chi.Router) {
+			r.Use(RequirePermission(rbac.PermissionManageUsers))
+			r.Post("/users/{userId}/disable", s.handleDisableUser)
+			r.Post("/users/{userId}/enable", s.handleEnableUser)
+			r.Post("/users/{userId}/logout", s.handleForceLogout)
+			r.Post("/users/{userId}/reset-password", s.handleSendPasswordReset)
+			r.Post("/users/{userId}/delete", s.handleDeleteUser)
+		})
+	})
+}
+
+func (s *Server) adminUsersPage(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	// anything that isn't a page number shows the first page
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+
+	p, err := s.userService.SearchUsers(r.Context(), query, page)
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	data := pageData(r, map[string]any{
+		"Page":        p,
+		"PreviousURL": adminUsersURL(query, p.Page-1),
+		"NextURL":     adminUsersURL(query, p.Page+1),
+	})
+
+	w.Header().Add("Cache-Control", "no-store, private")
+
+	switch {
+	case r.Header.Get("HX-Target") == "admin-user-list":
+		adminUserListTmpl.Execute(w, data)
+	case r.Header.Get("HX-Boosted") == "true":
+		adminUsersPageTmpl.ExecuteTemplate(w, "layout", data)
+	default:
+		adminUsersPageTmpl.Execute(w, data)
+	}
+}
+
+func (s *Server) adminUserPage(w http.ResponseWriter, r *http.Request) {
+	data, err := s.adminUserData(r, chi.URLParam(r, "userId"))
+	if err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	data = pageData(r, data)
+
+	w.Header().Add("Cache-Control", "no-store, private")
+
+	if r.Header.Get("HX-Boosted") == "true" {
+		adminUserPageTmpl.ExecuteTemplate(w, "layout", data)
+		return
+	}
+
+	adminUserPageTmpl.Execute(w, data)
+}
+
+func (s *Server) handleDisableUser(w http.ResponseWriter, r *http.Request) {
+	userId := chi.URLParam(r, "userId")
+
+	if isCurrentUser(r, userId) {
+		writeAdminError(w, "You can't disable your own account")
+		return
+	}
+
+	if err := s.userService.DisableUser(r.Context(), userId); err != nil {
+		writeAdminError(w, adminErrorMessage(err))
+		return
+	}
+
+	s.renderAdminUserDetails(w, r, userId, "The user has been disabled and signed out")
+}
+
+func (s *Server) handleEnableUser(w http.ResponseWriter, r *http.Request) {
+	userId := chi.URLParam(r, "userId")
+
+	if err := s.userService.EnableUser(r.Context(), userId); err != nil {
+		writeAdminError(w, adminErrorMessage(err))
+		return
+	}
+
+	s.renderAdminUserDetails(w, r, userId, "The user has been enabled")
+}
+
+func (s *Server) handleForceLogout(w http.ResponseWriter, r *http.Request) {
+	userId := chi.URLParam(r, "userId")
+
+	if err := s.userService.ForceLogout(r.Context(), userId); err != nil {
+		writeAdminError(w, adminErrorMessage(err))
+		return
+	}
+
+	s.renderAdminUserDetails(w, r, userId, "The user has been signed out everywhere")
+}
+
+func (s *Server) handleSendPasswordReset(w http.ResponseWriter, r *http.Request) {
+	userId := chi.URLParam(r, "userId")
+
+	if err := s.userService.SendPasswordReset(r.Context(), userId); err != nil {
+		writeAdminError(w, adminErrorMessage(err))
+		return
+	}
+
+	s.renderAdminUserDetails(w, r, userId, "A password reset link has been emailed to the user")
+}
+
+func (s *Server) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	userId := chi.URLParam(r, "userId")
+
+	if isCurrentUser(r, userId) {
+		writeAdminError(w, "You can't delete your own account from here")
+		return
+	}
+
+	if err := s.userService.DeleteUser(r.Context(), userId); err != nil {
+		writeAdminError(w, adminErrorMessage(err))
+		return
+	}
+
+	redirect(w, r, "/admin/users")
+}
+
+func (s *Server) renderAdminUserDetails(w http.ResponseWriter, r *http.Request, userId, message string) {
+	data, err := s.adminUserData(r, userId)
+	if err != nil {
+		writeAdminError(w, adminErrorMessage(err))
+		return
+	}
+
+	data["Message"] = message
+
+	adminUserDetailsTmpl.Execute(w, data)
+}
+
+func (s *Server) adminUserData(r *http.Request, userId string) (map[string]any, error) {
+	u, err := s.userService.GetUserById(r.Context(), userId)
+	if err != nil {
+		return nil, err
+	}
+
+	access, err := s.rbacService.GetAccess(r.Context(), u.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := s.authService.GetSessions(r.Context(), u.Id, "")
+	if err != nil {
+		log.Println(err)
+	}
+
+	current := r.Context().Value(accessKey).(rbac.Access)
+
+	return map[string]any{
+			"User":      u,
+			"Roles":     access.Roles,
+			"Sessions":  sessions,
+			"CanManage": current.HasPermission(rbac.PermissionManageUsers),
+			"Self":      isCurrentUser(r, u.Id),
+		},
+		nil
+}
+
+func writeAdminError(w http.ResponseWriter, message string) {
+	w.Header().Add("HX-Reswap", "none")
+	errorAlertTmpl.Execute(w, map[string]any{
+		"Message": message,
+	})
+}
+
+func adminErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, user.ErrUserNotFound):
+		return "This user doesn't exist anymore"
+	default:
+		return "Something went wrong"
+	}
+}
+
+// helpers
+func isCurrentUser(r *http.Request, userId string) bool {
+	return r.Context().Value(userIdKey).(string) == userId
+}
+
+func adminUsersURL(query string, page int) string {
+	v := url.Values{}
+	if query != "" {
+		v.Set("q", query)
+	}
+	v.Set("page", strconv.Itoa(page))
+
+	return "/admin/users?" + v.Encode()
+}
@@ -0,0 +1,407 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cativovo/go-demo-auth/pkg/auth"
+	"github.com/cativovo/go-demo-auth/pkg/ratelimit"
+	"github.com/cativovo/go-demo-auth/pkg/rbac"
+	"github.com/cativovo/go-demo-auth/pkg/user"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+)
+
+const maxAPIBodySize = 1 << 20
+
+// apiPublicPaths don't need a CSRF token, they only accept JSON which other
+// sites can't send without a CORS preflight.
+var apiPublicPaths = []string{"/api/v1/register", "/api/v1/login", "/api/v1/login/totp", "/api/v1/refresh"}
+
+type apiError struct {
+	Error   string            `json:"error"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+type apiToken struct {
+	UserId       string `json:"user_id"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	ExpiresAt    int    `json:"expires_at"`
+}
+
+type apiUser struct {
+	Id            string     `json:"id"`
+	Email         string     `json:"email"`
+	Name          string     `json:"name"`
+	EmailVerified bool       `json:"email_verified"`
+	VerifiedAt    *time.Time `json:"verified_at,omitempty"`
+	Roles         []string   `json:"roles"`
+	Permissions   []string   `json:"permissions"`
+}
+
+type apiRegisterRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Name     string `json:"name"`
+}
+
+type apiLoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// apiTOTPRequired answers a password login of a user with two-factor
+// authentication enabled, the code goes to /login/totp with ChallengeId.
+type apiTOTPRequired struct {
+	apiError
+	ChallengeId string `json:"challenge_id"`
+}
+
+type apiTOTPLoginRequest struct {
+	ChallengeId string `json:"challenge_id"`
+	TOTPCode    string `json:"totp_code"`
+}
+
+type apiRefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func (s *Server) registerAPIRoutes() {
+	s.router.Route("/api/v1", func(r chi.Router) {
+		// the limiters are shared with the htmx routes doing the same
+		r.With(s.rateLimit("register", ratelimit.Every(10, time.Hour), byIP)).Post("/register", s.handleAPIRegister)
+		r.With(
+			s.rateLimit("login", ratelimit.Every(30, time.Minute), byIP),
+			s.rateLimit("login-email", ratelimit.Every(10, time.Minute), byJSONEmail),
+		).Post("/login", s.handleAPILogin)
+		r.With(s.rateLimit("totp", ratelimit.Every(30, time.Minute), byIP)).Post("/login/totp", s.handleAPITOTPLogin)
+		r.With(s.rateLimit("refresh", ratelimit.Every(60, time.Minute), byIP)).Post("/refresh", s.handleAPIRefresh)
+
+		r.Group(func(r chi.Router) {
+			r.Use(requireBearerMiddleware)
+			r.Use(authMiddleWare(s.authService, s.sessions, s.rbacService, s.orgService))
+			r.With(sessionOnlyMiddleware).Post("/logout", s.handleAPILogout)
+			r.Get("/me", s.handleAPIMe)
+			r.With(RequirePermission(rbac.PermissionReadAuditLog)).Get("/audit-events", s.handleAPIAuditEvents)
+
+			// a leaked API token mustn't be able to hand out administrator
+			r.With(sessionOnlyMiddleware, RequirePermission(rbac.PermissionManageRoles)).Route("/users/{userId}/roles/{role}", func(r chi.Router) {
+				r.Put("/", s.handleAPIAssignRole)
+				r.Delete("/", s.handleAPIRemoveRole)
+			})
+		})
+	})
+}
+
+func (s *Server) handleAPIRegister(w http.ResponseWriter, r *http.Request) {
+	req := apiRegisterRequest{}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	c := user.Credentials{
+		Email:    strings.TrimSpace(req.Email),
+		Password: req.Password,
+		Name:     strings.TrimSpace(req.Name),
+	}
+
+	if errs := s.userService.ValidateCredentials(c); errs != nil {
+		writeAPIError(w, http.StatusUnprocessableEntity, "validation_failed", "Some fields are invalid", fieldErrors(errs))
+		return
+	}
+
+	if err := s.userService.ValidatePassword(c); err != nil {
+		writeAPIError(w, http.StatusUnprocessableEntity, "validation_failed", "Some fields are invalid", map[string]string{
+			"password": passwordErrorMessage(err),
+		})
+		return
+	}
+
+	token, errs := s.userService.Register(r.Context(), c, auditClient(r))
+	if errs != nil {
+		switch {
+		case errors.Is(errs[0], auth.ErrEmailNotVerified):
+			writeJSON(w, http.StatusAccepted, map[string]string{
+				"status":  "verification_required",
+				"message": "Confirm your email with the link we sent before logging in",
+			})
+		case errors.Is(errs[0], user.ErrEmailAlreadyUsed):
+			writeAPIError(w, http.StatusConflict, "email_already_used", "An account already uses this email", map[string]string{
+				"email": "is already used",
+			})
+		default:
+			writeAPIError(w, http.StatusInternalServerError, "server_error", "Something went wrong", nil)
+		}
+		return
+	}
+
+	writeAPIToken(w, http.StatusCreated, token)
+}
+
+func (s *Server) handleAPILogin(w http.ResponseWriter, r *http.Request) {
+	req := apiLoginRequest{}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	token, err := s.authService.Login(r.Context(), strings.TrimSpace(req.Email), req.Password, auditClient(r))
+	if err != nil {
+		writeAPILoginError(w, err)
+		return
+	}
+
+	enabled, err := s.authService.IsTOTPEnabled(r.Context(), token.UserId)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "server_error", "Something went wrong", nil)
+		return
+	}
+
+	if enabled {
+		// the token stays in the challenge until the code is verified
+		challengeId, err := s.authService.StartLoginChallenge(r.Context(), token)
+		if err != nil {
+			writeAPILoginError(w, err)
+			return
+		}
+
+		writeJSON(w, http.StatusUnauthorized, apiTOTPRequired{
+			apiError: apiError{
+				Error:   "totp_required",
+				Message: "Send the code of your authenticator app as totp_code to /api/v1/login/totp with challenge_id",
+			},
+			ChallengeId: challengeId,
+		})
+		return
+	}
+
+	writeAPIToken(w, http.StatusOK, token)
+}
+
+func (s *Server) handleAPITOTPLogin(w http.ResponseWriter, r *http.Request) {
+	req := apiTOTPLoginRequest{}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	token, err := s.authService.CompleteLoginChallenge(r.Context(), req.ChallengeId, req.TOTPCode, auditClient(r))
+	if err != nil {
+		writeAPILoginError(w, err)
+		return
+	}
+
+	writeAPIToken(w, http.StatusOK, token)
+}
+
+func (s *Server) handleAPIRefresh(w http.ResponseWriter, r *http.Request) {
+	req := apiRefreshRequest{}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if req.RefreshToken == "" {
+		writeAPIError(w, http.StatusUnprocessableEntity, "validation_failed", "Some fields are invalid", map[string]string{
+			"refresh_token": "is required",
+		})
+		return
+	}
+
+	token, err := s.authService.Refresh(r.Context(), req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidToken) {
+			writeAPIError(w, http.StatusUnauthorized, "invalid_token", "The refresh token is invalid or expired", nil)
+			return
+		}
+		if errors.Is(err, auth.ErrAccountDisabled) {
+			writeAPIError(w, http.StatusForbidden, "account_disabled", "This account has been disabled", nil)
+			return
+		}
+
+		writeAPIError(w, http.StatusInternalServerError, "server_error", "Something went wrong", nil)
+		return
+	}
+
+	writeAPIToken(w, http.StatusOK, token)
+}
+
+func (s *Server) handleAPILogout(w http.ResponseWriter, r *http.Request) {
+	token := r.Context().Value(accessTokenKey).(string)
+
+	if err := s.authService.Logout(r.Context(), token, auditClient(r)); err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "server_error", "Something went wrong", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleAPIMe(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdKey).(string)
+
+	u, err := s.userService.GetUserById(r.Context(), userId)
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, "user_not_found", "The user doesn't exist anymore", nil)
+		return
+	}
+
+	access := r.Context().Value(accessKey).(rbac.Access)
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, apiUser{
+		Id:            u.Id,
+		Email:         u.Email,
+		Name:          u.Name,
+		EmailVerified: u.VerifiedAt != nil,
+		VerifiedAt:    u.VerifiedAt,
+		Roles:         nonNil(access.Roles),
+		Permissions:   nonNil(access.Permissions),
+	})
+}
+
+func (s *Server) handleAPIAssignRole(w http.ResponseWriter, r *http.Request) {
+	if err := s.rbacService.AssignRole(r.Context(), chi.URLParam(r, "userId"), chi.URLParam(r, "role")); err != nil {
+		writeAPIRoleError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleAPIRemoveRole(w http.ResponseWriter, r *http.Request) {
+	if err := s.rbacService.RemoveRole(r.Context(), chi.URLParam(r, "userId"), chi.URLParam(r, "role")); err != nil {
+		writeAPIRoleError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// requireBearerMiddleware answers 401 instead of letting authMiddleWare
+// redirect API clients without a token to the login page.
+func requireBearerMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			w.Header().Add("WWW-Authenticate", "Bearer")
+			writeAPIError(w, http.StatusUnauthorized, "invalid_token", "A bearer token is required", nil)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeAPIError(w http.ResponseWriter, status int, code, message string, fields map[string]string) {
+	writeJSON(w, status, apiError{
+		Error:   code,
+		Message: message,
+		Fields:  fields,
+	})
+}
+
+func writeAPIToken(w http.ResponseWriter, status int, t auth.Token) {
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, status, apiToken{
+		UserId:       t.UserId,
+		AccessToken:  t.AccessToken,
+		RefreshToken: t.RefreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    t.ExpiresIn,
+		ExpiresAt:    t.ExpiresAt,
+	})
+}
+
+func writeAPILoginError(w http.ResponseWriter, err error) {
+	var throttled *auth.ThrottledError
+
+	switch {
+	case errors.Is(err, auth.ErrInvalidCredentials):
+		writeAPIError(w, http.StatusUnauthorized, "invalid_credentials", "Invalid email or password", nil)
+	case errors.Is(err, auth.ErrInvalidTOTPCode):
+		writeAPIError(w, http.StatusUnauthorized, "invalid_totp_code", "Invalid authentication code", nil)
+	case errors.Is(err, auth.ErrInvalidChallenge):
+		writeAPIError(w, http.StatusUnauthorized, "invalid_challenge", "The login challenge expired or had too many attempts, log in again", nil)
+	case errors.Is(err, auth.ErrEmailNotVerified):
+		writeAPIError(w, http.StatusForbidden, "email_not_verified", "Confirm your email before logging in", nil)
+	case errors.Is(err, auth.ErrAccountDisabled):
+		writeAPIError(w, http.StatusForbidden, "account_disabled", "This account has been disabled", nil)
+	case errors.As(err, &throttled):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+		writeAPIError(w, http.StatusTooManyRequests, "too_many_attempts", throttledMessage(throttled), nil)
+	default:
+		writeAPIError(w, http.StatusInternalServerError, "server_error", "Something went wrong", nil)
+	}
+}
+
+func writeAPIRoleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, rbac.ErrUnknownRole):
+		writeAPIError(w, http.StatusNotFound, "role_not_found", "The role doesn't exist", nil)
+	case errors.Is(err, user.ErrUserNotFound):
+		writeAPIError(w, http.StatusNotFound, "user_not_found", "The user doesn't exist", nil)
+	case errors.Is(err, rbac.ErrLastAdmin):
+		writeAPIError(w, http.StatusConflict, "last_admin", "The last administrator can't lose the admin role", nil)
+	default:
+		writeAPIError(w, http.StatusInternalServerError, "server_error", "Something went wrong", nil)
+	}
+}
+
+// decodeJSON reads the body into v, it answers the error and returns false
+// when the body isn't valid JSON.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		writeAPIError(w, http.StatusUnsupportedMediaType, "unsupported_media_type", "The body must be application/json", nil)
+		return false
+	}
+
+	d := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIBodySize))
+	d.DisallowUnknownFields()
+
+	if err := d.Decode(v); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_json", "The body isn't valid JSON: "+err.Error(), nil)
+		return false
+	}
+
+	return true
+}
+
+// fieldErrors maps the validation errors to the JSON names of the fields.
+func fieldErrors(errs validator.ValidationErrors) map[string]string {
+	fields := map[string]string{}
+
+	for _, err := range errs {
+		name := strings.ToLower(err.StructField())
+
+		switch err.Tag() {
+		case "required":
+			fields[name] = "is required"
+		case "email":
+			fields[name] = "must be a valid email"
+		case "min":
+			fields[name] = fmt.Sprintf("must be at least %s characters", err.Param())
+		default:
+			fields[name] = "is invalid"
+		}
+	}
+
+	return fields
+}
+
+// nonNil makes empty lists encode as [] instead of null.
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+
+	return s
+}
@@ -0,0 +1,83 @@
+package http
+
+import (
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cativovo/go-demo-auth/pkg/auth"
+	"github.com/go-chi/chi/v5"
+)
+
+var apiTokenSettingsTmpl *template.Template = template.Must(template.ParseFiles("web/components/api_token_settings.html"))
+
+func (s *Server) registerAPITokenRoutes() {
+	s.router.Route("/account/api-tokens", func(r chi.Router) {
+		r.Use(authMiddleWare(s.authService, s.sessions, s.rbacService, s.orgService))
+		r.Use(sessionOnlyMiddleware)
+		r.Post("/", s.handleCreateAPIToken)
+		r.Post("/{tokenId}/revoke", s.handleRevokeAPIToken)
+	})
+}
+
+func (s *Server) handleCreateAPIToken(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdKey).(string)
+
+	r.ParseForm()
+
+	// an invalid value is rejected by CreateAPIToken as a zero lifetime
+	days, _ := strconv.Atoi(r.PostFormValue("expires_in_days"))
+
+	token, _, err := s.authService.CreateAPIToken(r.Context(), userId, r.PostFormValue("name"), r.PostForm["scope"], time.Duration(days)*24*time.Hour)
+	if err != nil {
+		w.Header().Add("HX-Reswap", "none")
+		errorAlertTmpl.Execute(w, map[string]any{
+			"Message": apiTokenErrorMessage(err),
+		})
+		return
+	}
+
+	s.renderAPITokenSettings(w, r, userId, token)
+}
+
+func (s *Server) handleRevokeAPIToken(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdKey).(string)
+
+	if err := s.authService.RevokeAPIToken(r.Context(), userId, chi.URLParam(r, "tokenId")); err != nil {
+		w.Header().Add("HX-Reswap", "none")
+		errorAlertTmpl.Execute(w, map[string]any{
+			"Message": apiTokenErrorMessage(err),
+		})
+		return
+	}
+
+	s.renderAPITokenSettings(w, r, userId, "")
+}
+
+func (s *Server) renderAPITokenSettings(w http.ResponseWriter, r *http.Request, userId, newToken string) {
+	tokens, err := s.authService.GetAPITokens(r.Context(), userId)
+	if err != nil {
+		log.Println(err)
+	}
+
+	apiTokenSettingsTmpl.Execute(w, map[string]any{
+		"APITokens":   tokens,
+		"NewAPIToken": newToken,
+	})
+}
+
+func apiTokenErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, auth.ErrInvalidAPITokenName),
+		errors.Is(err, auth.ErrInvalidAPITokenLifetime),
+		errors.Is(err, auth.ErrAPITokenNotFound):
+		return err.Error()
+	case errors.Is(err, auth.ErrInvalidAPITokenScope):
+		return "Pick at least one scope"
+	default:
+		return "Something went wrong"
+	}
+}
@@ -0,0 +1,111 @@
+package http
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cativovo/go-demo-auth/pkg/audit"
+)
+
+type apiAuditEvent struct {
+	Id        string    `json:"id"`
+	UserId    string    `json:"user_id,omitempty"`
+	Email     string    `json:"email,omitempty"`
+	Action    string    `json:"action"`
+	Outcome   string    `json:"outcome"`
+	Detail    string    `json:"detail,omitempty"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type apiAuditEventPage struct {
+	Events     []apiAuditEvent `json:"events"`
+	Page       int             `json:"page"`
+	TotalPages int             `json:"total_pages"`
+	Total      int             `json:"total"`
+}
+
+// handleAPIAuditEvents searches the events with the user_id, email, action,
+// outcome, ip, since and until query parameters, since and until are RFC
+// 3339 timestamps.
+func (s *Server) handleAPIAuditEvents(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	fields := map[string]string{}
+
+	f := audit.Filter{
+		UserId:  strings.TrimSpace(q.Get("user_id")),
+		Email:   strings.TrimSpace(q.Get("email")),
+		Action:  strings.TrimSpace(q.Get("action")),
+		Outcome: q.Get("outcome"),
+		IP:      strings.TrimSpace(q.Get("ip")),
+		Since:   timeParam(q, "since", fields),
+		Until:   timeParam(q, "until", fields),
+	}
+
+	if f.Outcome != "" && f.Outcome != audit.OutcomeSuccess && f.Outcome != audit.OutcomeFailure {
+		fields["outcome"] = "must be success or failure"
+	}
+
+	if len(fields) > 0 {
+		writeAPIError(w, http.StatusUnprocessableEntity, "validation_failed", "Some query parameters are invalid", fields)
+		return
+	}
+
+	// anything that isn't a page number shows the first page
+	page, _ := strconv.Atoi(q.Get("page"))
+
+	p, err := s.auditService.SearchEvents(r.Context(), f, page)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "server_error", "Something went wrong", nil)
+		return
+	}
+
+	events := make([]apiAuditEvent, 0, len(p.Events))
+	for _, e := range p.Events {
+		events = append(events, toAPIAuditEvent(e))
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, apiAuditEventPage{
+		Events:     events,
+		Page:       p.Page,
+		TotalPages: p.TotalPages(),
+		Total:      p.Total,
+	})
+}
+
+// helpers
+func toAPIAuditEvent(e audit.Event) apiAuditEvent {
+	return apiAuditEvent{
+		Id:        e.Id,
+		UserId:    e.UserId,
+		Email:     e.Email,
+		Action:    e.Action,
+		Outcome:   e.Outcome,
+		Detail:    e.Detail,
+		IP:        e.IP,
+		UserAgent: e.UserAgent,
+		CreatedAt: e.CreatedAt,
+	}
+}
+
+// timeParam parses the RFC 3339 timestamp of the query parameter, it adds
+// the error to fields when it's invalid.
+func timeParam(q url.Values, name string, fields map[string]string) *time.Time {
+	v := q.Get(name)
+	if v == "" {
+		return nil
+	}
+
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		fields[name] = "must be an RFC 3339 timestamp"
+		return nil
+	}
+
+	return &t
+}
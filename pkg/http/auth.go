@@ -3,18 +3,62 @@ package http
 import (
 	"errors"
 	"fmt"
+	"html/template"
+	"log"
+	"math"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
 
 	"github.com/cativovo/go-demo-auth/pkg/auth"
+	"github.com/cativovo/go-demo-auth/pkg/password"
+	"github.com/cativovo/go-demo-auth/pkg/ratelimit"
 	"github.com/cativovo/go-demo-auth/pkg/user"
 	"github.com/go-chi/chi/v5"
 )
 
+var magicLinkFormTmpl *template.Template = template.Must(template.ParseFiles("web/components/magic_link_form.html"))
+
+var forgotPasswordFormTmpl *template.Template = template.Must(template.ParseFiles("web/components/forgot_password_form.html"))
+
+var resetPasswordFormTmpl *template.Template = template.Must(template.ParseFiles("web/components/reset_password_form.html"))
+
+var verifyEmailFormTmpl *template.Template = template.Must(template.ParseFiles("web/components/verify_email_form.html"))
+
+var verificationBannerTmpl *template.Template = template.Must(template.ParseFiles("web/components/verification_banner.html"))
+
+var unlockTmpl *template.Template = template.Must(template.ParseFiles("web/components/unlock.html"))
+
 func (s *Server) registerAuthRoutes() {
 	s.router.Route("/auth", func(r chi.Router) {
-		r.Post("/register", s.handleRegister)
-		r.Post("/login", s.handleLogin)
-		r.Get("/logout", s.handleLogout)
+		// emails are limited per recipient and per ip across every route sending one
+		mailByIP := s.rateLimit("mail", ratelimit.Every(20, time.Hour), byIP)
+		mailByEmail := s.rateLimit("mail-email", ratelimit.Every(3, 15*time.Minute), byEmail)
+
+		r.With(s.rateLimit("register", ratelimit.Every(10, time.Hour), byIP)).Post("/register", s.handleRegister)
+		r.With(
+			s.rateLimit("login", ratelimit.Every(30, time.Minute), byIP),
+			s.rateLimit("login-email", ratelimit.Every(10, time.Minute), byEmail),
+		).Post("/login", s.handleLogin)
+		r.With(s.rateLimit("totp", ratelimit.Every(30, time.Minute), byIP)).Post("/totp", s.handleTOTPChallenge)
+		// every ceremony started is stored until it expires
+		r.With(s.rateLimit("passkey", ratelimit.Every(30, time.Minute), byIP)).Post("/passkey/begin", s.handleBeginPasskeyLogin)
+		r.With(s.rateLimit("passkey-finish", ratelimit.Every(30, time.Minute), byIP)).Post("/passkey/finish", s.handleFinishPasskeyLogin)
+		r.With(mailByIP, mailByEmail).Post("/magic-link", s.handleSendMagicLink)
+		r.Get("/magic-link", s.handleMagicLink)
+		r.Post("/magic-link/login", s.handleMagicLinkLogin)
+		r.With(mailByIP, mailByEmail).Post("/forgot-password", s.handleForgotPassword)
+		r.With(s.rateLimit("reset-password", ratelimit.Every(10, time.Minute), byIP)).Post("/reset-password", s.handleResetPassword)
+		r.Get("/verify-email", s.handleVerifyEmail)
+		r.Post("/verify-email", s.handleConfirmVerifyEmail)
+		r.With(mailByIP, mailByEmail).Post("/resend-verification", s.handleResendVerification)
+		r.Get("/unlock", s.handleUnlock)
+		r.Post("/unlock", s.handleConfirmUnlock)
+		r.Get("/confirm-email", s.handleConfirmEmail)
+		r.Post("/confirm-email", s.handleConfirmEmailChange)
+		r.Post("/logout", s.handleLogout)
 	})
 }
 
@@ -25,8 +69,20 @@ func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
 		Name:     r.PostFormValue("name"),
 	}
 
-	token, errors := s.userService.Register(userCredentials)
-	if errors != nil {
+	token, errs := s.userService.Register(r.Context(), userCredentials, auditClient(r))
+	if len(errs) == 1 && errors.Is(errs[0], auth.ErrEmailNotVerified) {
+		redirect(w, r, "/auth-page/verify-email?email="+url.QueryEscape(userCredentials.Email))
+		return
+	}
+	if errs != nil {
+		var policyErr *password.PolicyError
+		if errors.As(errors.Join(errs...), &policyErr) {
+			errorAlertTmpl.Execute(w, map[string]any{
+				"Message": policyErr.Message,
+			})
+			return
+		}
+
 		// TODO: handle each errors
 		errorAlertTmpl.Execute(w, map[string]any{
 			"Message": "Something went wrong...",
@@ -34,25 +90,260 @@ func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	accessTokenCookie, refreshTokenCookie := createTokenCookie(token)
+	if err := s.startSession(w, r, token); err != nil {
+		errorAlertTmpl.Execute(w, map[string]any{
+			"Message": "Something went wrong...",
+		})
+		return
+	}
 
-	w.Header().Add("HX-Location", "/")
-	http.SetCookie(w, accessTokenCookie)
-	http.SetCookie(w, refreshTokenCookie)
+	// invitation links send new users here and expect them back
+	w.Header().Add("HX-Location", returnTo(w, r))
 }
 
 func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 	email := r.PostFormValue("email")
 	password := r.PostFormValue("password")
 
-	token, err := s.authService.Login(email, password)
+	token, err := s.authService.Login(r.Context(), email, password, auditClient(r))
 	if err != nil {
+		var throttled *auth.ThrottledError
+
 		switch {
 		case errors.Is(err, auth.ErrInvalidCredentials):
 			errorAlertTmpl.Execute(w, map[string]any{
 				"Message": "Invalid username/password",
 			})
 			return
+		case errors.As(err, &throttled):
+			errorAlertTmpl.Execute(w, map[string]any{
+				"Message": throttledMessage(throttled),
+			})
+			return
+		case errors.Is(err, auth.ErrEmailNotVerified):
+			redirect(w, r, "/auth-page/verify-email?email="+url.QueryEscape(email))
+			return
+		case errors.Is(err, auth.ErrAccountDisabled):
+			errorAlertTmpl.Execute(w, map[string]any{
+				"Message": "This account has been disabled",
+			})
+			return
+		default:
+			errorAlertTmpl.Execute(w, map[string]any{
+				"Message": "Something went wrong",
+			})
+			return
+		}
+	}
+
+	s.signIn(w, r, token)
+}
+
+func (s *Server) handleSendMagicLink(w http.ResponseWriter, r *http.Request) {
+	email := strings.TrimSpace(r.PostFormValue("email"))
+
+	if err := s.authService.SendMagicLink(r.Context(), email); err != nil {
+		magicLinkFormTmpl.Execute(w, map[string]any{
+			"Email": email,
+			"Error": "Something went wrong, please try again",
+		})
+		return
+	}
+
+	magicLinkFormTmpl.Execute(w, map[string]any{
+		"Email": email,
+		"Sent":  true,
+	})
+}
+
+// handleMagicLink only asks to confirm the sign-in, mail scanners following
+// the link mustn't burn the token.
+func (s *Server) handleMagicLink(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Cache-Control", "no-store, public")
+	w.Header().Add("Referrer-Policy", "no-referrer")
+	magicLinkPageTmpl.Execute(w, pageData(r, map[string]any{
+		"Token": r.URL.Query().Get("token"),
+	}))
+}
+
+func (s *Server) handleMagicLinkLogin(w http.ResponseWriter, r *http.Request) {
+	token, err := s.authService.LoginWithMagicLink(r.Context(), r.PostFormValue("token"), auditClient(r))
+	if err != nil {
+		message := "This sign-in link is invalid or has expired"
+		if errors.Is(err, auth.ErrAccountDisabled) {
+			message = "This account has been disabled"
+		}
+
+		magicLinkFormTmpl.Execute(w, map[string]any{
+			"Error": message,
+		})
+		return
+	}
+
+	s.signIn(w, r, token)
+}
+
+func (s *Server) handleForgotPassword(w http.ResponseWriter, r *http.Request) {
+	email := strings.TrimSpace(r.PostFormValue("email"))
+
+	if err := s.authService.RequestPasswordReset(r.Context(), email); err != nil {
+		forgotPasswordFormTmpl.Execute(w, map[string]any{
+			"Email": email,
+			"Error": "Something went wrong, please try again",
+		})
+		return
+	}
+
+	forgotPasswordFormTmpl.Execute(w, map[string]any{
+		"Email": email,
+		"Sent":  true,
+	})
+}
+
+func (s *Server) handleResetPassword(w http.ResponseWriter, r *http.Request) {
+	token := r.PostFormValue("token")
+
+	if err := s.authService.ResetPassword(r.Context(), token, r.PostFormValue("password")); err != nil {
+		data := map[string]any{
+			"Token": token,
+		}
+
+		var policyErr *password.PolicyError
+
+		switch {
+		case errors.As(err, &policyErr):
+			data["Error"] = policyErr.Message
+		case errors.Is(err, auth.ErrInvalidToken):
+			data["Error"] = "This reset link is invalid or has expired"
+		default:
+			data["Error"] = "Something went wrong, please try again"
+		}
+
+		resetPasswordFormTmpl.Execute(w, data)
+		return
+	}
+
+	clearCookie(w, r)
+	resetPasswordFormTmpl.Execute(w, map[string]any{
+		"Done": true,
+	})
+}
+
+// handleVerifyEmail only asks to confirm the email, mail scanners following
+// the link mustn't burn the token.
+func (s *Server) handleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Cache-Control", "no-store, public")
+	w.Header().Add("Referrer-Policy", "no-referrer")
+	verifyEmailPageTmpl.Execute(w, pageData(r, map[string]any{
+		"Token": r.URL.Query().Get("token"),
+	}))
+}
+
+func (s *Server) handleConfirmVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token, err := s.userService.VerifyEmail(r.Context(), r.PostFormValue("token"))
+	if err != nil {
+		message := "This confirmation link is invalid or has expired"
+		if errors.Is(err, auth.ErrAccountDisabled) {
+			message = "Your email is confirmed but this account has been disabled"
+		}
+
+		verifyEmailFormTmpl.Execute(w, map[string]any{
+			"Error": message,
+		})
+		return
+	}
+
+	s.signIn(w, r, token)
+}
+
+func (s *Server) handleResendVerification(w http.ResponseWriter, r *http.Request) {
+	email := strings.TrimSpace(r.PostFormValue("email"))
+
+	if err := s.userService.ResendVerificationEmail(r.Context(), email); err != nil {
+		verifyEmailFormTmpl.Execute(w, map[string]any{
+			"Email": email,
+			"Error": "Something went wrong, please try again",
+		})
+		return
+	}
+
+	verifyEmailFormTmpl.Execute(w, map[string]any{
+		"Email": email,
+		"Sent":  true,
+	})
+}
+
+func (s *Server) handleResendVerificationFromAccount(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdKey).(string)
+
+	u, err := s.userService.GetUserById(r.Context(), userId)
+	if err == nil {
+		err = s.userService.ResendVerificationEmail(r.Context(), u.Email)
+	}
+
+	if err != nil {
+		w.Header().Add("HX-Reswap", "none")
+		errorAlertTmpl.Execute(w, map[string]any{
+			"Message": "Something went wrong",
+		})
+		return
+	}
+
+	verificationBannerTmpl.Execute(w, map[string]any{
+		"Email": u.Email,
+		"Sent":  true,
+	})
+}
+
+// handleUnlock only asks to confirm the unlock, mail scanners following the
+// link mustn't burn the token.
+func (s *Server) handleUnlock(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Cache-Control", "no-store, public")
+	w.Header().Add("Referrer-Policy", "no-referrer")
+	unlockPageTmpl.Execute(w, pageData(r, map[string]any{
+		"Token": r.URL.Query().Get("token"),
+	}))
+}
+
+func (s *Server) handleConfirmUnlock(w http.ResponseWriter, r *http.Request) {
+	if err := s.authService.UnlockAccount(r.Context(), r.PostFormValue("token")); err != nil {
+		unlockTmpl.Execute(w, map[string]any{
+			"Error": "This unlock link is invalid or has expired",
+		})
+		return
+	}
+
+	unlockTmpl.Execute(w, map[string]any{
+		"Unlocked": true,
+	})
+}
+
+func (s *Server) handleTOTPChallenge(w http.ResponseWriter, r *http.Request) {
+	challengeCookie, err := r.Cookie("login_challenge")
+	if err != nil {
+		w.Header().Add("HX-Location", "/auth-page/login")
+		return
+	}
+
+	token, err := s.authService.CompleteLoginChallenge(r.Context(), challengeCookie.Value, r.PostFormValue("code"), auditClient(r))
+	if err != nil {
+		var throttled *auth.ThrottledError
+
+		switch {
+		case errors.As(err, &throttled):
+			errorAlertTmpl.Execute(w, map[string]any{
+				"Message": throttledMessage(throttled),
+			})
+			return
+		case errors.Is(err, auth.ErrInvalidTOTPCode):
+			errorAlertTmpl.Execute(w, map[string]any{
+				"Message": "Invalid authentication code",
+			})
+			return
+		case errors.Is(err, auth.ErrInvalidChallenge):
+			http.SetCookie(w, createCookie("login_challenge", "", -1))
+			w.Header().Add("HX-Location", "/auth-page/login")
+			return
 		default:
 			errorAlertTmpl.Execute(w, map[string]any{
 				"Message": "Something went wrong",
@@ -61,21 +352,126 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	accessTokenCookie, refreshTokenCookie := createTokenCookie(token)
+	http.SetCookie(w, createCookie("login_challenge", "", -1))
+
+	if err := s.startSession(w, r, token); err != nil {
+		errorAlertTmpl.Execute(w, map[string]any{
+			"Message": "Something went wrong",
+		})
+		return
+	}
 
-	w.Header().Add("HX-Location", "/")
-	http.SetCookie(w, accessTokenCookie)
-	http.SetCookie(w, refreshTokenCookie)
+	w.Header().Add("HX-Location", returnTo(w, r))
 }
 
 func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
-	if token, getCookieErr := r.Cookie("access_token"); getCookieErr == nil {
-		if logoutErr := s.authService.Logout(token.Value); logoutErr != nil {
-			fmt.Fprintln(w, logoutErr)
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		if ss, err := s.sessions.Get(r.Context(), c.Value); err == nil {
+			if err := s.authService.Logout(r.Context(), ss.Token.AccessToken, auditClient(r)); err != nil {
+				log.Println(err)
+			}
+		}
+
+		if err := s.sessions.End(r.Context(), c.Value); err != nil {
+			log.Println(err)
 		}
 	}
 
-	w.Header().Add("Location", "/auth-page/login")
 	clearCookie(w, r)
+	redirect(w, r, "/auth-page/login")
+}
+
+// signIn issues the token cookies for t, or sends the user to the TOTP
+// challenge first when they have two-factor authentication enabled.
+func (s *Server) signIn(w http.ResponseWriter, r *http.Request, t auth.Token) {
+	enabled, err := s.authService.IsTOTPEnabled(r.Context(), t.UserId)
+	if err != nil {
+		errorAlertTmpl.Execute(w, map[string]any{
+			"Message": "Something went wrong",
+		})
+		return
+	}
+
+	if enabled {
+		challengeId, err := s.authService.StartLoginChallenge(r.Context(), t)
+		if err != nil {
+			errorAlertTmpl.Execute(w, map[string]any{
+				"Message": "Something went wrong",
+			})
+			return
+		}
+
+		http.SetCookie(w, createCookie("login_challenge", challengeId, 300))
+		redirect(w, r, "/auth-page/totp")
+		return
+	}
+
+	if err := s.startSession(w, r, t); err != nil {
+		errorAlertTmpl.Execute(w, map[string]any{
+			"Message": "Something went wrong",
+		})
+		return
+	}
+
+	redirect(w, r, returnTo(w, r))
+}
+
+// startSession keeps t in the session store and gives the browser the id of
+// the session.
+func (s *Server) startSession(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	sessionId, err := s.sessions.Start(r.Context(), t)
+	if err != nil {
+		log.Println("startSession Start:", err)
+		return err
+	}
+
+	http.SetCookie(w, createCookie(sessionCookie, sessionId, 0))
+
+	return nil
+}
+
+func throttledMessage(e *auth.ThrottledError) string {
+	switch {
+	case errors.Is(e, auth.ErrAccountLocked):
+		return fmt.Sprintf(
+			"This account is locked after too many failed attempts. Use the link we emailed you or try again in %d minutes",
+			int(math.Ceil(e.RetryAfter.Minutes())),
+		)
+	case errors.Is(e, auth.ErrIPBlocked):
+		return "Too many failed attempts from your network, please try again later"
+	default:
+		return fmt.Sprintf("Too many failed attempts, try again in %d seconds", int(math.Ceil(e.RetryAfter.Seconds())))
+	}
+}
+
+// returnTo is where the user was going before being sent to the login page,
+// only local paths are accepted so the cookie can't be used to redirect
+// somewhere else. Browsers drop tabs and newlines from URLs, so "/\t/host"
+// would be "//host".
+func returnTo(w http.ResponseWriter, r *http.Request) string {
+	c, err := r.Cookie(returnToCookie)
+	if err != nil {
+		return "/"
+	}
+
+	http.SetCookie(w, createCookie(returnToCookie, "", -1))
+
+	path, err := url.QueryUnescape(c.Value)
+	if err != nil || !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.HasPrefix(path, "/\\") || strings.ContainsFunc(path, unicode.IsControl) {
+		return "/"
+	}
+
+	return path
+}
+
+// redirect uses HX-Location for htmx requests and a plain redirect for
+// navigations, e.g. following a link from an email.
+func redirect(w http.ResponseWriter, r *http.Request, url string) {
+	if r.Header.Get("HX-Request") == "true" {
+		w.Header().Add("HX-Location", url)
+		return
+	}
+
+	w.Header().Add("Location", url)
 	w.WriteHeader(http.StatusFound)
 }
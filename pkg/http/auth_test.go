@@ -0,0 +1,58 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	_ "github.com/cativovo/go-demo-auth/pkg/http/internal/testroot"
+)
+
+func TestReturnTo(t *testing.T) {
+	tests := []struct {
+		name   string
+		cookie string
+		want   string
+	}{
+		{"path", "/account", "/account"},
+		{"path with a query", url.QueryEscape("/account?tab=sessions"), "/account?tab=sessions"},
+		{"authorize request", url.QueryEscape("/authorize?client_id=app&redirect_uri=https%3A%2F%2Fapp.test"), "/authorize?client_id=app&redirect_uri=https%3A%2F%2Fapp.test"},
+		{"empty", "", "/"},
+		{"relative path", "account", "/"},
+		{"absolute URL", url.QueryEscape("https://evil.test"), "/"},
+		{"scheme relative URL", url.QueryEscape("//evil.test"), "/"},
+		{"backslash", url.QueryEscape("/\\evil.test"), "/"},
+		{"tab", url.QueryEscape("/\t/evil.test"), "/"},
+		{"newline", url.QueryEscape("/\n/evil.test"), "/"},
+		{"invalid escape", "%zz", "/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.AddCookie(&http.Cookie{Name: returnToCookie, Value: tt.cookie})
+			w := httptest.NewRecorder()
+
+			if got := returnTo(w, r); got != tt.want {
+				t.Errorf("returnTo(%q) = %q, want %q", tt.cookie, got, tt.want)
+			}
+
+			cleared := false
+			for _, c := range w.Result().Cookies() {
+				cleared = cleared || (c.Name == returnToCookie && c.MaxAge < 0)
+			}
+			if !cleared {
+				t.Error("the cookie wasn't cleared")
+			}
+		})
+	}
+}
+
+func TestReturnToWithoutCookie(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	if got := returnTo(httptest.NewRecorder(), r); got != "/" {
+		t.Errorf("returnTo() = %q, want /", got)
+	}
+}
@@ -1,9 +1,14 @@
 package http
 
-import (
-	"net/http"
+import "net/http"
 
-	"github.com/cativovo/go-demo-auth/pkg/auth"
+const (
+	returnToCookie = "return_to"
+	// sessionCookie holds the opaque id of the session, the provider tokens
+	// stay in the session store.
+	sessionCookie = "session_id"
+	// activeOrgCookie holds the id of the organization picked in nav.html.
+	activeOrgCookie = "active_org"
 )
 
 func createCookie(name string, value string, maxAge int) *http.Cookie {
@@ -20,14 +25,12 @@ func createCookie(name string, value string, maxAge int) *http.Cookie {
 
 func clearCookie(w http.ResponseWriter, r *http.Request) {
 	for _, cookie := range r.Cookies() {
+		// the page swapped in by htmx keeps sending the token of the body
+		if cookie.Name == csrfCookie {
+			continue
+		}
+
 		cookie = createCookie(cookie.Name, cookie.Value, -1)
 		http.SetCookie(w, cookie)
 	}
 }
-
-func createTokenCookie(t auth.Token) (*http.Cookie, *http.Cookie) {
-	accessTokenCookie := createCookie("access_token", t.AccessToken, t.ExpiresIn)
-	refreshTokenCookie := createCookie("refresh_token", t.RefreshToken, 0)
-
-	return accessTokenCookie, refreshTokenCookie
-}
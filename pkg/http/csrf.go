@@ -0,0 +1,117 @@
+package http
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/cativovo/go-demo-auth/pkg/org"
+	"github.com/cativovo/go-demo-auth/pkg/rbac"
+)
+
+// csrfCookie holds the token that state-changing requests have to send back
+// in csrfHeader, or in csrfField for plain forms. Other sites can make the
+// browser send the cookie but can't read it to echo it.
+const (
+	csrfCookie = "csrf_token"
+	csrfHeader = "X-CSRF-Token"
+	csrfField  = "csrf_token"
+)
+
+type CSRFTokenKey string
+
+var csrfTokenKey CSRFTokenKey = "csrfToken"
+
+// csrfMiddleware rejects unsafe requests without a valid token, except on
+// the exempt paths which are authenticated by other means, e.g. the OAuth
+// endpoints called by client apps.
+func csrfMiddleware(exempt ...string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var token string
+
+			if c, err := r.Cookie(csrfCookie); err == nil && c.Value != "" {
+				token = c.Value
+			} else {
+				t, err := randomCSRFToken()
+				if err != nil {
+					log.Println("csrfMiddleware randomCSRFToken:", err)
+					http.Error(w, "Something went wrong", http.StatusInternalServerError)
+					return
+				}
+
+				token = t
+				http.SetCookie(w, createCookie(csrfCookie, token, 0))
+			}
+
+			// browsers never add a bearer token on their own, those requests
+			// are authenticated with it and not the cookies
+			bearer := strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+			if !isSafeMethod(r.Method) && !bearer && !slices.Contains(exempt, r.URL.Path) {
+				sent := r.Header.Get(csrfHeader)
+				if sent == "" {
+					sent = r.PostFormValue(csrfField)
+				}
+
+				if sent == "" || subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+					writeInvalidCSRFToken(w, r)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), csrfTokenKey, token)))
+		})
+	}
+}
+
+// pageData adds the CSRF token to the data of a page, base.html sends it
+// with every htmx request. The access and the organizations of the user are
+// added too for nav.html.
+func pageData(r *http.Request, data map[string]any) map[string]any {
+	if data == nil {
+		data = map[string]any{}
+	}
+
+	data["CSRFToken"], _ = r.Context().Value(csrfTokenKey).(string)
+	data["Access"], _ = r.Context().Value(accessKey).(rbac.Access)
+	data["Memberships"], _ = r.Context().Value(membershipsKey).([]org.Membership)
+	data["ActiveOrg"], _ = r.Context().Value(activeOrgKey).(org.Membership)
+
+	return data
+}
+
+func writeInvalidCSRFToken(w http.ResponseWriter, r *http.Request) {
+	message := "Your session has expired, please reload the page"
+
+	if r.Header.Get("HX-Request") == "true" {
+		// base.html lets htmx swap 403 responses so the alert shows up
+		w.Header().Add("HX-Reswap", "none")
+		w.WriteHeader(http.StatusForbidden)
+		errorAlertTmpl.Execute(w, map[string]any{
+			"Message": message,
+		})
+		return
+	}
+
+	http.Error(w, message, http.StatusForbidden)
+}
+
+// helpers
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+func randomCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
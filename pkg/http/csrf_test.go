@@ -0,0 +1,77 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	_ "github.com/cativovo/go-demo-auth/pkg/http/internal/testroot"
+)
+
+func TestCSRFMiddleware(t *testing.T) {
+	const token = "token"
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		cookie string
+		header string
+		field  string
+		bearer bool
+		want   int
+	}{
+		{"safe method", http.MethodGet, "/", "", "", "", false, http.StatusOK},
+		{"no cookie", http.MethodPost, "/", "", token, "", false, http.StatusForbidden},
+		{"no token", http.MethodPost, "/", token, "", "", false, http.StatusForbidden},
+		{"header", http.MethodPost, "/", token, token, "", false, http.StatusOK},
+		{"form field", http.MethodPost, "/", token, "", token, false, http.StatusOK},
+		{"wrong header", http.MethodPost, "/", token, "other", "", false, http.StatusForbidden},
+		{"wrong form field", http.MethodDelete, "/", token, "", "other", false, http.StatusForbidden},
+		{"prefix of the token", http.MethodPost, "/", token, "tok", "", false, http.StatusForbidden},
+		{"token longer than the cookie", http.MethodPost, "/", token, token + "n", "", false, http.StatusForbidden},
+		{"bearer token", http.MethodPost, "/", "", "", "", true, http.StatusOK},
+		{"exempt path", http.MethodPost, "/token", "", "", "", false, http.StatusOK},
+	}
+
+	handler := csrfMiddleware("/token")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if v, _ := r.Context().Value(csrfTokenKey).(string); v == "" {
+			t.Error("the token isn't in the context")
+		}
+	}))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			if tt.field != "" {
+				form.Set(csrfField, tt.field)
+			}
+
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: csrfCookie, Value: tt.cookie})
+			}
+			if tt.header != "" {
+				r.Header.Set(csrfHeader, tt.header)
+			}
+			if tt.bearer {
+				r.Header.Set("Authorization", "Bearer pat")
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+
+			setsCookie := strings.Contains(w.Header().Get("Set-Cookie"), csrfCookie+"=")
+			if setsCookie != (tt.cookie == "") {
+				t.Errorf("sets the cookie = %v, want %v", setsCookie, tt.cookie == "")
+			}
+		})
+	}
+}
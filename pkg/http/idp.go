@@ -0,0 +1,227 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cativovo/go-demo-auth/pkg/idp"
+	"github.com/cativovo/go-demo-auth/pkg/ratelimit"
+	"github.com/go-chi/chi/v5"
+)
+
+var consentPageTmpl *template.Template = template.Must(
+	template.ParseFiles(
+		"web/base.html",
+		"web/layouts/public.html",
+		"web/components/consent.html",
+	),
+)
+
+var scopeDescriptions = map[string]string{
+	"openid":  "Know who you are",
+	"email":   "See your email address",
+	"profile": "See your name",
+}
+
+func (s *Server) registerIdPRoutes() {
+	s.router.Get("/.well-known/openid-configuration", s.handleDiscovery)
+	s.router.Get("/jwks", s.handleJWKS)
+	s.router.With(s.rateLimit("token", ratelimit.Every(60, time.Minute), byIP)).Post("/token", s.handleToken)
+	s.router.Get("/userinfo", s.handleUserInfo)
+	s.router.Post("/userinfo", s.handleUserInfo)
+
+	s.router.Group(func(r chi.Router) {
+		r.Use(authMiddleWare(s.authService, s.sessions, s.rbacService, s.orgService))
+		r.Use(sessionOnlyMiddleware)
+		r.Get("/authorize", s.handleAuthorize)
+		r.Post("/authorize", s.handleConsent)
+	})
+}
+
+func (s *Server) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	writeJSON(w, http.StatusOK, s.idpService.Discovery())
+}
+
+func (s *Server) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	writeJSON(w, http.StatusOK, s.idpService.JWKS())
+}
+
+func (s *Server) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdKey).(string)
+	req := authorizationRequest(r)
+
+	client, err := s.idpService.ValidateAuthorizationRequest(r.Context(), req)
+	if err != nil {
+		s.authorizationError(w, r, req, err)
+		return
+	}
+
+	consented, err := s.idpService.HasConsent(r.Context(), userId, req)
+	if err != nil {
+		s.authorizationError(w, r, req, err)
+		return
+	}
+
+	if consented {
+		s.authorize(w, r, userId, req)
+		return
+	}
+
+	scopes := make([]string, 0)
+	for _, scope := range strings.Fields(req.Scope) {
+		scopes = append(scopes, scopeDescriptions[scope])
+	}
+
+	w.Header().Add("Cache-Control", "no-store, private")
+	consentPageTmpl.Execute(w, pageData(r, map[string]any{
+		"Client":  client,
+		"Scopes":  scopes,
+		"Request": req,
+	}))
+}
+
+func (s *Server) handleConsent(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdKey).(string)
+	req := authorizationRequest(r)
+
+	if _, err := s.idpService.ValidateAuthorizationRequest(r.Context(), req); err != nil {
+		s.authorizationError(w, r, req, err)
+		return
+	}
+
+	if r.PostFormValue("decision") != "allow" {
+		http.Redirect(w, r, s.idpService.ErrorRedirect(req, idp.ErrAccessDenied), http.StatusFound)
+		return
+	}
+
+	s.authorize(w, r, userId, req)
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, idp.ErrInvalidRequest)
+		return
+	}
+
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		writeOAuthError(w, http.StatusBadRequest, idp.ErrUnsupportedGrantType)
+		return
+	}
+
+	req := idp.TokenRequest{
+		ClientId:     r.PostForm.Get("client_id"),
+		ClientSecret: r.PostForm.Get("client_secret"),
+		Code:         r.PostForm.Get("code"),
+		RedirectURI:  r.PostForm.Get("redirect_uri"),
+		CodeVerifier: r.PostForm.Get("code_verifier"),
+	}
+
+	// client_secret_basic, the credentials are form encoded before being
+	// put in the header
+	if id, secret, ok := r.BasicAuth(); ok {
+		req.ClientId, _ = url.QueryUnescape(id)
+		req.ClientSecret, _ = url.QueryUnescape(secret)
+	}
+
+	t, err := s.idpService.Exchange(r.Context(), req)
+	if err != nil {
+		switch {
+		case errors.Is(err, idp.ErrInvalidClient):
+			w.Header().Add("WWW-Authenticate", `Basic realm="token"`)
+			writeOAuthError(w, http.StatusUnauthorized, err)
+		case errors.Is(err, idp.ErrInvalidGrant):
+			writeOAuthError(w, http.StatusBadRequest, err)
+		default:
+			writeOAuthError(w, http.StatusInternalServerError, idp.ErrServerError)
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, t)
+}
+
+func (s *Server) handleUserInfo(w http.ResponseWriter, r *http.Request) {
+	accessToken, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		w.Header().Add("WWW-Authenticate", `Bearer`)
+		writeOAuthError(w, http.StatusUnauthorized, idp.ErrInvalidToken)
+		return
+	}
+
+	info, err := s.idpService.UserInfo(r.Context(), accessToken)
+	if err != nil {
+		w.Header().Add("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeOAuthError(w, http.StatusUnauthorized, idp.ErrInvalidToken)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, info)
+}
+
+// helpers
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, userId string, req idp.AuthorizationRequest) {
+	redirectURI, err := s.idpService.Authorize(r.Context(), userId, req)
+	if err != nil {
+		s.authorizationError(w, r, req, err)
+		return
+	}
+
+	http.Redirect(w, r, redirectURI, http.StatusFound)
+}
+
+// authorizationError reports err to the client when the redirect uri can be
+// trusted and shows it to the user otherwise.
+func (s *Server) authorizationError(w http.ResponseWriter, r *http.Request, req idp.AuthorizationRequest, err error) {
+	if errors.Is(err, idp.ErrInvalidClient) || errors.Is(err, idp.ErrInvalidRedirectURI) {
+		w.WriteHeader(http.StatusBadRequest)
+		consentPageTmpl.Execute(w, pageData(r, map[string]any{
+			"Error": "The application that sent you here is not registered",
+		}))
+		return
+	}
+
+	switch {
+	case errors.Is(err, idp.ErrInvalidRequest),
+		errors.Is(err, idp.ErrInvalidScope),
+		errors.Is(err, idp.ErrUnsupportedResponseType):
+	default:
+		err = idp.ErrServerError
+	}
+
+	http.Redirect(w, r, s.idpService.ErrorRedirect(req, err), http.StatusFound)
+}
+
+func authorizationRequest(r *http.Request) idp.AuthorizationRequest {
+	return idp.AuthorizationRequest{
+		ResponseType:        r.FormValue("response_type"),
+		ClientId:            r.FormValue("client_id"),
+		RedirectURI:         r.FormValue("redirect_uri"),
+		Scope:               r.FormValue("scope"),
+		State:               r.FormValue("state"),
+		Nonce:               r.FormValue("nonce"),
+		CodeChallenge:       r.FormValue("code_challenge"),
+		CodeChallengeMethod: r.FormValue("code_challenge_method"),
+	}
+}
+
+func writeOAuthError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{
+		"error": err.Error(),
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
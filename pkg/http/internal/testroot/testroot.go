@@ -0,0 +1,18 @@
+// Package testroot moves the tests importing it to the root of the module,
+// the templates of the http package are parsed from paths relative to it
+// when the package is initialized.
+package testroot
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+func init() {
+	_, file, _, _ := runtime.Caller(0)
+
+	if err := os.Chdir(filepath.Join(filepath.Dir(file), "..", "..", "..", "..")); err != nil {
+		panic(err)
+	}
+}
@@ -1,17 +1,66 @@
 package http
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"math"
+	"net"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/cativovo/go-demo-auth/pkg/audit"
 	"github.com/cativovo/go-demo-auth/pkg/auth"
+	"github.com/cativovo/go-demo-auth/pkg/org"
+	"github.com/cativovo/go-demo-auth/pkg/ratelimit"
+	"github.com/cativovo/go-demo-auth/pkg/rbac"
+	"github.com/cativovo/go-demo-auth/pkg/session"
 )
 
 type UserIdKey string
 
 var userIdKey UserIdKey = "userId"
 
+type ClaimsKey string
+
+var claimsKey ClaimsKey = "claims"
+
+type AccessTokenKey string
+
+// accessTokenKey is the access token of the session, after it was refreshed
+// if needed.
+var accessTokenKey AccessTokenKey = "accessToken"
+
+type APITokenKey string
+
+// apiTokenKey is set instead of accessTokenKey when the request was
+// authenticated with an API token.
+var apiTokenKey APITokenKey = "apiToken"
+
+type MembershipsKey string
+
+// membershipsKey holds the organizations of the user as []org.Membership.
+var membershipsKey MembershipsKey = "memberships"
+
+type ActiveOrgKey string
+
+// activeOrgKey holds the org.Membership of the organization the user is
+// working in, handlers scope what they show and change to it.
+var activeOrgKey ActiveOrgKey = "activeOrg"
+
+type AccessKey string
+
+// accessKey holds the roles and permissions of the user as rbac.Access.
+var accessKey AccessKey = "access"
+
 func setHtmlContentTypeMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Content-Type", "text/html")
@@ -20,30 +69,400 @@ func setHtmlContentTypeMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-func authMiddleWare(a auth.Service) func(next http.Handler) http.Handler {
+func authMiddleWare(a auth.Service, sessions *session.Manager, rb rbac.Service, o org.Service) func(next http.Handler) http.Handler {
 	loginUrl := "/auth-page/login"
 
+	redirectToLogin := func(w http.ResponseWriter, r *http.Request) {
+		clearCookie(w, r)
+		// e.g. an app sending the user to /authorize, they come back after logging in
+		if r.Method == http.MethodGet && r.Header.Get("HX-Request") != "true" {
+			http.SetCookie(w, createCookie(returnToCookie, url.QueryEscape(r.URL.RequestURI()), 600))
+		}
+		w.Header().Add("Location", loginUrl)
+		w.WriteHeader(http.StatusFound)
+	}
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			accessTokenCookie, err := r.Cookie("access_token")
+			// scripts authenticate with a bearer token instead of the session cookie
+			if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+				serveWithBearerToken(a, rb, o, next, w, r, bearer)
+				return
+			}
+
+			c, err := r.Cookie(sessionCookie)
+			if err != nil {
+				redirectToLogin(w, r)
+				return
+			}
+
+			sessionId := c.Value
+
+			ss, err := sessions.Get(r.Context(), sessionId)
 			if err != nil {
+				if !errors.Is(err, session.ErrNotFound) {
+					log.Println(err)
+				}
+				redirectToLogin(w, r)
+				return
+			}
+
+			token := ss.Token
+
+			claims, err := a.VerifyToken(r.Context(), token.AccessToken)
+			if err != nil && !errors.Is(err, auth.ErrInvalidToken) {
 				log.Println(err)
 				w.Header().Add("Location", loginUrl)
 				w.WriteHeader(http.StatusFound)
 				return
 			}
 
-			userId, err := a.GetUserId(accessTokenCookie.Value)
+			// the access token expired, rotate it with the refresh token
 			if err != nil {
+				token, err = refreshSession(r.Context(), a, sessions, sessionId, token)
+				if err != nil {
+					log.Println(err)
+					redirectToLogin(w, r)
+					return
+				}
+
+				claims, err = a.VerifyToken(r.Context(), token.AccessToken)
+				if err != nil {
+					log.Println(err)
+					redirectToLogin(w, r)
+					return
+				}
+			}
+
+			// the session may have been signed out from another device or by
+			// an administrator
+			if err := a.TouchSession(r.Context(), claims, r.UserAgent(), clientIP(r)); err != nil {
+				if errors.Is(err, auth.ErrSessionRevoked) || errors.Is(err, auth.ErrAccountDisabled) || errors.Is(err, auth.ErrSessionNotFound) {
+					if err := sessions.End(r.Context(), sessionId); err != nil {
+						log.Println(err)
+					}
+					redirectToLogin(w, r)
+					return
+				}
+
 				log.Println(err)
-				w.Header().Add("Location", loginUrl)
-				w.WriteHeader(http.StatusFound)
+				http.Error(w, "Something went wrong", http.StatusInternalServerError)
+				return
+			}
+
+			ctx, err := userContext(r, rb, o, claims.Subject)
+			if err != nil {
+				http.Error(w, "Something went wrong", http.StatusInternalServerError)
 				return
 			}
 
-			ctx := context.WithValue(r.Context(), userIdKey, userId)
+			ctx = context.WithValue(ctx, claimsKey, claims)
+			ctx = context.WithValue(ctx, accessTokenKey, token.AccessToken)
 
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
+
+// serveWithBearerToken authenticates scripts and API clients, bearer is an
+// API token or the access token returned by /api/v1/login.
+func serveWithBearerToken(a auth.Service, rb rbac.Service, o org.Service, next http.Handler, w http.ResponseWriter, r *http.Request, bearer string) {
+	if t, err := a.VerifyAPIToken(r.Context(), bearer); err == nil {
+		scope := auth.APIScopeWrite
+		if isSafeMethod(r.Method) {
+			scope = auth.APIScopeRead
+		}
+
+		if !t.HasScope(scope) {
+			w.Header().Add("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, scope))
+			writeAPIError(w, http.StatusForbidden, "insufficient_scope", "The token doesn't have the "+scope+" scope", nil)
+			return
+		}
+
+		ctx, err := userContext(r, rb, o, t.UserId)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, "server_error", "Something went wrong", nil)
+			return
+		}
+
+		claims := auth.Claims{}
+		claims.Subject = t.UserId
+
+		ctx = context.WithValue(ctx, claimsKey, claims)
+		ctx = context.WithValue(ctx, apiTokenKey, t)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+		return
+	}
+
+	claims, err := a.VerifyToken(r.Context(), bearer)
+	if err == nil {
+		err = a.TouchSession(r.Context(), claims, r.UserAgent(), clientIP(r))
+	}
+	if err != nil {
+		if !errors.Is(err, auth.ErrInvalidToken) && !errors.Is(err, auth.ErrSessionRevoked) && !errors.Is(err, auth.ErrAccountDisabled) {
+			log.Println(err)
+		}
+		w.Header().Add("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeAPIError(w, http.StatusUnauthorized, "invalid_token", "The access token is invalid or expired", nil)
+		return
+	}
+
+	ctx, err := userContext(r, rb, o, claims.Subject)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "server_error", "Something went wrong", nil)
+		return
+	}
+
+	ctx = context.WithValue(ctx, claimsKey, claims)
+	ctx = context.WithValue(ctx, accessTokenKey, bearer)
+
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// userContext adds the user, their access and their organizations to the
+// context of r.
+func userContext(r *http.Request, rb rbac.Service, o org.Service, userId string) (context.Context, error) {
+	access, err := rb.GetAccess(r.Context(), userId)
+	if err != nil {
+		return nil, err
+	}
+
+	memberships, err := o.GetMemberships(r.Context(), userId)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.WithValue(r.Context(), userIdKey, userId)
+	ctx = context.WithValue(ctx, accessKey, access)
+	ctx = context.WithValue(ctx, membershipsKey, memberships)
+	ctx = context.WithValue(ctx, activeOrgKey, activeMembership(r, memberships))
+
+	return ctx, nil
+}
+
+// activeMembership is the organization picked with the switcher of
+// nav.html, or with the X-Organization-Id header for API clients. It falls
+// back to the first organization of the user.
+func activeMembership(r *http.Request, memberships []org.Membership) org.Membership {
+	orgId := r.Header.Get(orgIdHeader)
+	if orgId == "" {
+		if c, err := r.Cookie(activeOrgCookie); err == nil {
+			orgId = c.Value
+		}
+	}
+
+	for _, m := range memberships {
+		if m.Id == orgId {
+			return m
+		}
+	}
+
+	// GetMemberships never returns an empty list
+	return memberships[0]
+}
+
+// sessionOnlyMiddleware keeps API tokens away from the routes managing the
+// account security, otherwise a leaked token could be used to create new
+// tokens or take over the account. It only works behind authMiddleWare.
+func sessionOnlyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value(apiTokenKey).(auth.APIToken); ok {
+			writeAPIError(w, http.StatusForbidden, "session_required", "API tokens can't be used here", nil)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireRole lets the request through if the user has one of the roles.
+// It only works behind authMiddleWare.
+func RequireRole(roles ...string) func(next http.Handler) http.Handler {
+	return requireAccess(func(access rbac.Access) bool {
+		return slices.ContainsFunc(roles, access.HasRole)
+	})
+}
+
+// RequirePermission lets the request through if the user has all of the
+// permissions. It only works behind authMiddleWare.
+func RequirePermission(permissions ...string) func(next http.Handler) http.Handler {
+	return requireAccess(func(access rbac.Access) bool {
+		for _, p := range permissions {
+			if !access.HasPermission(p) {
+				return false
+			}
+		}
+
+		return true
+	})
+}
+
+// requireAccess answers 403 unless allowed, a request without the access
+// in its context is never allowed.
+func requireAccess(allowed func(access rbac.Access) bool) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			access, ok := r.Context().Value(accessKey).(rbac.Access)
+			if !ok || !allowed(access) {
+				writeForbidden(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func writeForbidden(w http.ResponseWriter, r *http.Request) {
+	message := "You don't have access to this page"
+
+	switch {
+	case r.Header.Get("HX-Request") == "true":
+		// base.html lets htmx swap 403 responses so the alert shows up
+		w.Header().Add("HX-Reswap", "none")
+		w.WriteHeader(http.StatusForbidden)
+		errorAlertTmpl.Execute(w, map[string]any{
+			"Message": message,
+		})
+	case strings.Contains(r.Header.Get("Accept"), "text/html"):
+		http.Error(w, message, http.StatusForbidden)
+	default:
+		writeAPIError(w, http.StatusForbidden, "forbidden", message, nil)
+	}
+}
+
+// refreshSession rotates the tokens of the session. Concurrent requests can
+// race to refresh, the loser uses the tokens the winner stored since its
+// refresh token has been rotated away.
+func refreshSession(ctx context.Context, a auth.Service, sessions *session.Manager, sessionId string, t auth.Token) (auth.Token, error) {
+	token, err := a.Refresh(ctx, t.RefreshToken)
+	if err != nil {
+		latest, getErr := sessions.Get(ctx, sessionId)
+		if getErr == nil && latest.Token.RefreshToken != t.RefreshToken {
+			return latest.Token, nil
+		}
+
+		if endErr := sessions.End(ctx, sessionId); endErr != nil {
+			log.Println(endErr)
+		}
+
+		return auth.Token{}, err
+	}
+
+	// the old refresh token is gone, a client disconnecting now must not
+	// keep the new one from being stored
+	if err := sessions.UpdateToken(context.WithoutCancel(ctx), sessionId, token); err != nil {
+		return auth.Token{}, err
+	}
+
+	return token, nil
+}
+
+// clientIP is the address of the client, see middleware.RealIP for proxies.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// auditClient is who the events recorded while serving r are attributed to.
+func auditClient(r *http.Request) audit.Client {
+	return audit.Client{
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+	}
+}
+
+type rateLimitKeyFunc func(r *http.Request) string
+
+func byIP(r *http.Request) string {
+	return clientIP(r)
+}
+
+func byEmail(r *http.Request) string {
+	return strings.ToLower(strings.TrimSpace(r.FormValue("email")))
+}
+
+// byJSONEmail is byEmail for the JSON API, the body is put back for the
+// handler to decode.
+func byJSONEmail(r *http.Request) string {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxAPIBodySize+1))
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+
+	req := struct {
+		Email string `json:"email"`
+	}{}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return ""
+	}
+
+	return strings.ToLower(strings.TrimSpace(req.Email))
+}
+
+// byUserId only works behind authMiddleWare.
+func byUserId(r *http.Request) string {
+	userId, _ := r.Context().Value(userIdKey).(string)
+	return userId
+}
+
+// rateLimitMiddleware answers 429 once the bucket of the key is empty,
+// requests without a key aren't limited.
+func rateLimitMiddleware(l *ratelimit.Limiter, key rateLimitKeyFunc) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			k := key(r)
+			if k == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			allowed, retryAfter, err := l.Allow(r.Context(), k)
+			if err != nil {
+				// a broken store shouldn't take the login down with it
+				log.Println("rateLimitMiddleware Allow:", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !allowed {
+				writeTooManyRequests(w, r, retryAfter)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func writeTooManyRequests(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	message := fmt.Sprintf("Too many requests, try again in %d seconds", seconds)
+
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+
+	switch {
+	case r.Header.Get("HX-Request") == "true":
+		// base.html lets htmx swap 429 responses so the alert shows up
+		w.Header().Add("HX-Reswap", "none")
+		w.WriteHeader(http.StatusTooManyRequests)
+		errorAlertTmpl.Execute(w, map[string]any{
+			"Message": message,
+		})
+	case strings.Contains(r.Header.Get("Accept"), "text/html"):
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprintln(w, message)
+	default:
+		writeJSON(w, http.StatusTooManyRequests, map[string]any{
+			"error":       "rate_limited",
+			"retry_after": seconds,
+		})
+	}
+}
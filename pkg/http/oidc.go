@@ -0,0 +1,109 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/cativovo/go-demo-auth/pkg/auth"
+	"github.com/cativovo/go-demo-auth/pkg/user"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	oidcStateCookie    = "oidc_state"
+	oidcNonceCookie    = "oidc_nonce"
+	oidcVerifierCookie = "oidc_verifier"
+)
+
+func (s *Server) registerOIDCRoutes() {
+	s.router.Route("/auth/oidc/{provider}", func(r chi.Router) {
+		r.Get("/", s.handleBeginOIDCLogin)
+		r.Get("/callback", s.handleOIDCCallback)
+	})
+}
+
+func (s *Server) handleBeginOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	req, err := s.authService.BeginOIDCLogin(r.Context(), chi.URLParam(r, "provider"))
+	if err != nil {
+		s.renderLoginError(w, r, oidcErrorMessage(err))
+		return
+	}
+
+	// the callback is a top-level navigation from the provider, so these
+	// are sent back with the default SameSite=Lax
+	http.SetCookie(w, createCookie(oidcStateCookie, req.State, 600))
+	http.SetCookie(w, createCookie(oidcNonceCookie, req.Nonce, 600))
+	http.SetCookie(w, createCookie(oidcVerifierCookie, req.Verifier, 600))
+
+	w.Header().Add("Location", req.URL)
+	w.WriteHeader(http.StatusFound)
+}
+
+func (s *Server) handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	provider := chi.URLParam(r, "provider")
+	query := r.URL.Query()
+
+	req := auth.OIDCAuthRequest{}
+	if c, err := r.Cookie(oidcStateCookie); err == nil {
+		req.State = c.Value
+	}
+	if c, err := r.Cookie(oidcNonceCookie); err == nil {
+		req.Nonce = c.Value
+	}
+	if c, err := r.Cookie(oidcVerifierCookie); err == nil {
+		req.Verifier = c.Value
+	}
+
+	http.SetCookie(w, createCookie(oidcStateCookie, "", -1))
+	http.SetCookie(w, createCookie(oidcNonceCookie, "", -1))
+	http.SetCookie(w, createCookie(oidcVerifierCookie, "", -1))
+
+	// the user declined or the provider refused the request
+	if query.Get("error") != "" {
+		s.renderLoginError(w, r, "Sign in was cancelled")
+		return
+	}
+
+	identity, err := s.authService.FinishOIDCLogin(r.Context(), provider, query.Get("state"), query.Get("code"), req)
+	if err != nil {
+		s.renderLoginError(w, r, oidcErrorMessage(err))
+		return
+	}
+
+	token, err := s.authService.LoginWithOIDC(r.Context(), identity, auditClient(r))
+	if errors.Is(err, auth.ErrOIDCIdentityNotLinked) {
+		token, err = s.userService.RegisterWithOIDC(r.Context(), identity, auditClient(r))
+	}
+	if err != nil {
+		s.renderLoginError(w, r, oidcErrorMessage(err))
+		return
+	}
+
+	s.signIn(w, r, token)
+}
+
+// helpers
+func (s *Server) renderLoginError(w http.ResponseWriter, r *http.Request, message string) {
+	w.Header().Add("Cache-Control", "no-store, public")
+	loginPageTmpl.Execute(w, pageData(r, map[string]any{
+		"OIDCProviders": s.authService.OIDCProviders(),
+		"Error":         message,
+	}))
+}
+
+func oidcErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, auth.ErrUnknownOIDCProvider):
+		return "Unknown sign in provider"
+	case errors.Is(err, auth.ErrInvalidOIDCResponse):
+		return "Sign in failed, please try again"
+	case errors.Is(err, auth.ErrEmailNotVerified):
+		return "Your provider account has no verified email address"
+	case errors.Is(err, auth.ErrAccountDisabled):
+		return "This account has been disabled"
+	case errors.Is(err, user.ErrEmailAlreadyUsed):
+		return "An account with this email already exists, sign in with your password instead"
+	default:
+		return "Something went wrong"
+	}
+}
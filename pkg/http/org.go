@@ -0,0 +1,347 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+
+	"github.com/cativovo/go-demo-auth/pkg/org"
+	"github.com/go-chi/chi/v5"
+)
+
+// orgIdHeader picks the active organization of API clients, browsers use
+// activeOrgCookie.
+const orgIdHeader = "X-Organization-Id"
+
+// invitationReturnToMaxAge leaves enough time to register and confirm the
+// email before coming back to the invitation.
+const invitationReturnToMaxAge = 24 * 60 * 60
+
+var orgPageTmpl *template.Template = template.Must(
+	template.ParseFiles(
+		"web/base.html",
+		"web/layouts/private.html",
+		"web/components/nav.html",
+		"web/components/org.html",
+		"web/components/org_settings.html",
+	),
+)
+
+var invitationPageTmpl *template.Template = template.Must(
+	template.ParseFiles(
+		"web/base.html",
+		"web/layouts/public.html",
+		"web/components/invitation.html",
+	),
+)
+
+var orgSettingsTmpl *template.Template = template.Must(template.ParseFiles("web/components/org_settings.html"))
+
+func (s *Server) registerOrgRoutes() {
+	s.router.Route("/invitations/{token}", func(r chi.Router) {
+		r.Get("/", s.invitationPage)
+		r.With(
+			authMiddleWare(s.authService, s.sessions, s.rbacService, s.orgService),
+			sessionOnlyMiddleware,
+		).Post("/accept", s.handleAcceptInvitation)
+	})
+
+	s.router.Route("/orgs", func(r chi.Router) {
+		r.Use(authMiddleWare(s.authService, s.sessions, s.rbacService, s.orgService))
+		r.Use(sessionOnlyMiddleware)
+		r.Post("/", s.handleCreateOrganization)
+		r.Post("/switch", s.handleSwitchOrganization)
+	})
+
+	s.router.Route("/org", func(r chi.Router) {
+		r.Use(authMiddleWare(s.authService, s.sessions, s.rbacService, s.orgService))
+		r.Use(sessionOnlyMiddleware)
+		r.Get("/", s.orgPage)
+
+		r.Group(func(r chi.Router) {
+			r.Use(requireOrgManagerMiddleware)
+			r.Post("/invitations", s.handleInvite)
+			r.Post("/invitations/{invitationId}/revoke", s.handleRevokeInvitation)
+			r.Post("/members/{userId}/role", s.handleUpdateMemberRole)
+			r.Post("/members/{userId}/remove", s.handleRemoveMember)
+		})
+	})
+}
+
+func (s *Server) orgPage(w http.ResponseWriter, r *http.Request) {
+	data, err := s.orgSettingsData(r)
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
+	}
+
+	data = pageData(r, data)
+
+	w.Header().Add("Cache-Control", "no-store, private")
+
+	if r.Header.Get("HX-Boosted") == "true" {
+		orgPageTmpl.ExecuteTemplate(w, "layout", data)
+		return
+	}
+
+	orgPageTmpl.Execute(w, data)
+}
+
+func (s *Server) handleCreateOrganization(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdKey).(string)
+
+	o, err := s.orgService.CreateOrganization(r.Context(), userId, r.PostFormValue("name"))
+	if err != nil {
+		writeOrgError(w, err)
+		return
+	}
+
+	http.SetCookie(w, createCookie(activeOrgCookie, o.Id, 0))
+	redirect(w, r, "/org")
+}
+
+func (s *Server) handleSwitchOrganization(w http.ResponseWriter, r *http.Request) {
+	orgId := r.PostFormValue("org_id")
+	memberships := r.Context().Value(membershipsKey).([]org.Membership)
+
+	for _, m := range memberships {
+		if m.Id == orgId {
+			http.SetCookie(w, createCookie(activeOrgCookie, orgId, 0))
+			w.Header().Add("HX-Refresh", "true")
+			return
+		}
+	}
+
+	writeOrgError(w, org.ErrNotMember)
+}
+
+func (s *Server) handleInvite(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdKey).(string)
+	m := r.Context().Value(activeOrgKey).(org.Membership)
+	role := r.PostFormValue("role")
+
+	// admins can't make someone more powerful than themselves
+	if role == org.RoleOwner && m.Role != org.RoleOwner {
+		writeOrgError(w, errOwnerOnly)
+		return
+	}
+
+	if _, err := s.orgService.Invite(r.Context(), m.Id, userId, r.PostFormValue("email"), role); err != nil {
+		writeOrgError(w, err)
+		return
+	}
+
+	s.renderOrgSettings(w, r)
+}
+
+func (s *Server) handleRevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	m := r.Context().Value(activeOrgKey).(org.Membership)
+
+	if err := s.orgService.RevokeInvitation(r.Context(), m.Id, chi.URLParam(r, "invitationId")); err != nil {
+		writeOrgError(w, err)
+		return
+	}
+
+	s.renderOrgSettings(w, r)
+}
+
+func (s *Server) handleUpdateMemberRole(w http.ResponseWriter, r *http.Request) {
+	m := r.Context().Value(activeOrgKey).(org.Membership)
+	memberId := chi.URLParam(r, "userId")
+	role := r.PostFormValue("role")
+
+	if err := s.checkOwnerOnly(r.Context(), m, memberId, role); err != nil {
+		writeOrgError(w, err)
+		return
+	}
+
+	if err := s.orgService.UpdateMemberRole(r.Context(), m.Id, memberId, role); err != nil {
+		writeOrgError(w, err)
+		return
+	}
+
+	s.renderOrgSettings(w, r)
+}
+
+func (s *Server) handleRemoveMember(w http.ResponseWriter, r *http.Request) {
+	m := r.Context().Value(activeOrgKey).(org.Membership)
+	memberId := chi.URLParam(r, "userId")
+
+	if err := s.checkOwnerOnly(r.Context(), m, memberId, ""); err != nil {
+		writeOrgError(w, err)
+		return
+	}
+
+	if err := s.orgService.RemoveMember(r.Context(), m.Id, memberId); err != nil {
+		writeOrgError(w, err)
+		return
+	}
+
+	s.renderOrgSettings(w, r)
+}
+
+// invitationPage sends visitors without a session to the register form, or
+// to the login form when the invited email already has an account. They come
+// back here afterwards to accept.
+func (s *Server) invitationPage(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+
+	w.Header().Add("Cache-Control", "no-store")
+	w.Header().Add("Referrer-Policy", "no-referrer")
+
+	i, err := s.orgService.GetInvitation(r.Context(), token)
+	if err != nil {
+		invitationPageTmpl.Execute(w, pageData(r, map[string]any{
+			"Error": orgErrorMessage(err),
+		}))
+		return
+	}
+
+	signedIn := false
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		_, err := s.sessions.Get(r.Context(), c.Value)
+		signedIn = err == nil
+	}
+
+	if !signedIn {
+		http.SetCookie(w, createCookie(returnToCookie, url.QueryEscape(r.URL.RequestURI()), invitationReturnToMaxAge))
+
+		page := "/auth-page/register"
+		if _, err := s.userService.GetUserByEmail(r.Context(), i.Email); err == nil {
+			page = "/auth-page/login"
+		}
+
+		http.Redirect(w, r, page+"?email="+url.QueryEscape(i.Email), http.StatusFound)
+		return
+	}
+
+	invitationPageTmpl.Execute(w, pageData(r, map[string]any{
+		"Invitation": i,
+		"Token":      token,
+	}))
+}
+
+func (s *Server) handleAcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdKey).(string)
+
+	m, err := s.orgService.AcceptInvitation(r.Context(), chi.URLParam(r, "token"), userId)
+	if err != nil {
+		writeOrgError(w, err)
+		return
+	}
+
+	http.SetCookie(w, createCookie(activeOrgCookie, m.Id, 0))
+	redirect(w, r, "/org")
+}
+
+func (s *Server) renderOrgSettings(w http.ResponseWriter, r *http.Request) {
+	data, err := s.orgSettingsData(r)
+	if err != nil {
+		writeOrgError(w, err)
+		return
+	}
+
+	orgSettingsTmpl.Execute(w, data)
+}
+
+func (s *Server) orgSettingsData(r *http.Request) (map[string]any, error) {
+	userId := r.Context().Value(userIdKey).(string)
+	m := r.Context().Value(activeOrgKey).(org.Membership)
+
+	members, err := s.orgService.GetMembers(r.Context(), m.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	var invitations []org.Invitation
+	if m.CanManage() {
+		invitations, err = s.orgService.GetInvitations(r.Context(), m.Id)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return map[string]any{
+			"UserId":      userId,
+			"ActiveOrg":   m,
+			"Members":     members,
+			"Invitations": invitations,
+			"Roles":       org.Roles,
+		},
+		nil
+}
+
+var errOwnerOnly = errors.New("only owners can do this")
+
+// checkOwnerOnly keeps admins from changing owners or making someone an
+// owner, only owners can.
+func (s *Server) checkOwnerOnly(ctx context.Context, m org.Membership, memberId, role string) error {
+	if m.Role == org.RoleOwner {
+		return nil
+	}
+
+	if role == org.RoleOwner {
+		return errOwnerOnly
+	}
+
+	members, err := s.orgService.GetMembers(ctx, m.Id)
+	if err != nil {
+		return err
+	}
+
+	for _, member := range members {
+		if member.UserId == memberId && member.Role == org.RoleOwner {
+			return errOwnerOnly
+		}
+	}
+
+	return nil
+}
+
+// requireOrgManagerMiddleware only lets the owners and admins of the active
+// organization through. It only works behind authMiddleWare.
+func requireOrgManagerMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m, ok := r.Context().Value(activeOrgKey).(org.Membership)
+		if !ok || !m.CanManage() {
+			writeForbidden(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeOrgError(w http.ResponseWriter, err error) {
+	w.Header().Add("HX-Reswap", "none")
+	errorAlertTmpl.Execute(w, map[string]any{
+		"Message": orgErrorMessage(err),
+	})
+}
+
+func orgErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, org.ErrInvalidOrganizationName):
+		return "The name is required and must be at most 64 characters"
+	case errors.Is(err, org.ErrInvalidRole):
+		return "Pick one of the roles"
+	case errors.Is(err, org.ErrInvalidEmail):
+		return "Enter a valid email"
+	case errors.Is(err, org.ErrNotMember):
+		return "This user isn't a member of the organization"
+	case errors.Is(err, org.ErrLastOwner):
+		return "The organization needs at least one owner"
+	case errors.Is(err, org.ErrInvitationNotFound):
+		return "This invitation has already been accepted or revoked"
+	case errors.Is(err, org.ErrInvalidInvitation):
+		return "This invitation is invalid, has expired or has already been accepted"
+	case errors.Is(err, org.ErrInvitationEmailMismatch):
+		return "This invitation was sent to another email, log in with that account to accept it"
+	case errors.Is(err, errOwnerOnly):
+		return "Only owners can change owners or make someone an owner"
+	default:
+		return "Something went wrong"
+	}
+}
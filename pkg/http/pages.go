@@ -4,7 +4,10 @@ import (
 	"html/template"
 	"log"
 	"net/http"
+	"time"
 
+	"github.com/cativovo/go-demo-auth/pkg/auth"
+	"github.com/cativovo/go-demo-auth/pkg/ratelimit"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -21,6 +24,63 @@ var loginPageTmpl *template.Template = template.Must(
 		"web/base.html",
 		"web/layouts/public.html",
 		"web/components/login_form.html",
+		"web/components/passkey_script.html",
+	),
+)
+
+var totpPageTmpl *template.Template = template.Must(
+	template.ParseFiles(
+		"web/base.html",
+		"web/layouts/public.html",
+		"web/components/totp_form.html",
+	),
+)
+
+var magicLinkPageTmpl *template.Template = template.Must(
+	template.ParseFiles(
+		"web/base.html",
+		"web/layouts/public.html",
+		"web/components/magic_link_form.html",
+	),
+)
+
+var forgotPasswordPageTmpl *template.Template = template.Must(
+	template.ParseFiles(
+		"web/base.html",
+		"web/layouts/public.html",
+		"web/components/forgot_password_form.html",
+	),
+)
+
+var resetPasswordPageTmpl *template.Template = template.Must(
+	template.ParseFiles(
+		"web/base.html",
+		"web/layouts/public.html",
+		"web/components/reset_password_form.html",
+	),
+)
+
+var verifyEmailPageTmpl *template.Template = template.Must(
+	template.ParseFiles(
+		"web/base.html",
+		"web/layouts/public.html",
+		"web/components/verify_email_form.html",
+	),
+)
+
+var unlockPageTmpl *template.Template = template.Must(
+	template.ParseFiles(
+		"web/base.html",
+		"web/layouts/public.html",
+		"web/components/unlock.html",
+	),
+)
+
+var confirmEmailPageTmpl *template.Template = template.Must(
+	template.ParseFiles(
+		"web/base.html",
+		"web/layouts/public.html",
+		"web/components/confirm_email.html",
 	),
 )
 
@@ -30,6 +90,15 @@ var accountPageTmpl *template.Template = template.Must(
 		"web/layouts/private.html",
 		"web/components/nav.html",
 		"web/components/account.html",
+		"web/components/verification_banner.html",
+		"web/components/profile_settings.html",
+		"web/components/totp_settings.html",
+		"web/components/passkey_settings.html",
+		"web/components/passkey_script.html",
+		"web/components/session_settings.html",
+		"web/components/api_token_settings.html",
+		"web/components/security_activity.html",
+		"web/components/account_data.html",
 	),
 )
 
@@ -46,11 +115,12 @@ func (s *Server) registerPages() {
 	s.router.Route("/auth-page", func(r chi.Router) {
 		r.Use(func(next http.Handler) http.Handler {
 			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				_, err := r.Cookie("access_token")
-				if err == nil {
-					w.Header().Add("Location", "/")
-					w.WriteHeader(http.StatusFound)
-					return
+				if c, err := r.Cookie(sessionCookie); err == nil {
+					if _, err := s.sessions.Get(r.Context(), c.Value); err == nil {
+						w.Header().Add("Location", "/")
+						w.WriteHeader(http.StatusFound)
+						return
+					}
 				}
 
 				next.ServeHTTP(w, r)
@@ -58,29 +128,78 @@ func (s *Server) registerPages() {
 		})
 		r.Get("/login", s.loginPage)
 		r.Get("/register", s.registerPage)
+		r.Get("/totp", s.totpPage)
+		r.Get("/magic-link", s.magicLinkPage)
+		r.Get("/forgot-password", s.forgotPasswordPage)
+		r.Get("/reset-password", s.resetPasswordPage)
+		r.Get("/verify-email", s.verifyEmailPage)
 	})
 
 	s.router.Route("/", func(r chi.Router) {
-		r.Use(authMiddleWare(s.authService))
+		r.Use(authMiddleWare(s.authService, s.sessions, s.rbacService, s.orgService))
 		r.Get("/", s.accountPage)
 		r.Get("/info", s.infoPage)
+		r.With(s.rateLimit("resend-verification", ratelimit.Every(3, 15*time.Minute), byUserId)).Post("/account/resend-verification", s.handleResendVerificationFromAccount)
 	})
 }
 
 func (s *Server) loginPage(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Cache-Control", "no-store, public")
-	loginPageTmpl.Execute(w, nil)
+	loginPageTmpl.Execute(w, pageData(r, map[string]any{
+		"OIDCProviders": s.authService.OIDCProviders(),
+		"Email":         r.URL.Query().Get("email"),
+	}))
 }
 
 func (s *Server) registerPage(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Cache-Control", "no-store, public")
-	registerPageTmpl.Execute(w, nil)
+	registerPageTmpl.Execute(w, pageData(r, map[string]any{
+		"Email": r.URL.Query().Get("email"),
+	}))
+}
+
+func (s *Server) magicLinkPage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Cache-Control", "no-store, public")
+	magicLinkPageTmpl.Execute(w, pageData(r, nil))
+}
+
+func (s *Server) forgotPasswordPage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Cache-Control", "no-store, public")
+	forgotPasswordPageTmpl.Execute(w, pageData(r, nil))
+}
+
+func (s *Server) resetPasswordPage(w http.ResponseWriter, r *http.Request) {
+	// the token is only checked on submit so that mail scanners following
+	// the link can't burn it
+	w.Header().Add("Cache-Control", "no-store, public")
+	w.Header().Add("Referrer-Policy", "no-referrer")
+	resetPasswordPageTmpl.Execute(w, pageData(r, map[string]any{
+		"Token": r.URL.Query().Get("token"),
+	}))
+}
+
+func (s *Server) verifyEmailPage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Cache-Control", "no-store, public")
+	verifyEmailPageTmpl.Execute(w, pageData(r, map[string]any{
+		"Email": r.URL.Query().Get("email"),
+	}))
+}
+
+func (s *Server) totpPage(w http.ResponseWriter, r *http.Request) {
+	if _, err := r.Cookie("login_challenge"); err != nil {
+		w.Header().Add("Location", "/auth-page/login")
+		w.WriteHeader(http.StatusFound)
+		return
+	}
+
+	w.Header().Add("Cache-Control", "no-store, public")
+	totpPageTmpl.Execute(w, pageData(r, nil))
 }
 
 func (s *Server) accountPage(w http.ResponseWriter, r *http.Request) {
 	userId := r.Context().Value(userIdKey).(string)
 
-	user, err := s.userService.GetUserById(userId)
+	user, err := s.userService.GetUserById(r.Context(), userId)
 	if err != nil {
 		log.Println(err)
 		w.Header().Add("Location", "/auth/login")
@@ -88,11 +207,45 @@ func (s *Server) accountPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data := map[string]any{
-		"UserId": user.Id,
-		"Name":   user.Name,
+	totpEnabled, err := s.authService.IsTOTPEnabled(r.Context(), user.Id)
+	if err != nil {
+		log.Println(err)
+	}
+
+	passkeys, err := s.authService.GetPasskeys(r.Context(), user.Id)
+	if err != nil {
+		log.Println(err)
+	}
+
+	claims := r.Context().Value(claimsKey).(auth.Claims)
+
+	sessions, err := s.authService.GetSessions(r.Context(), user.Id, claims.SessionId)
+	if err != nil {
+		log.Println(err)
 	}
 
+	apiTokens, err := s.authService.GetAPITokens(r.Context(), user.Id)
+	if err != nil {
+		log.Println(err)
+	}
+
+	securityEvents, err := s.auditService.GetRecentEvents(r.Context(), user.Id, user.Email)
+	if err != nil {
+		log.Println(err)
+	}
+
+	data := pageData(r, map[string]any{
+		"UserId":         user.Id,
+		"Name":           user.Name,
+		"Email":          user.Email,
+		"Verified":       user.VerifiedAt != nil,
+		"TOTPEnabled":    totpEnabled,
+		"Passkeys":       passkeys,
+		"Sessions":       sessions,
+		"APITokens":      apiTokens,
+		"SecurityEvents": securityEvents,
+	})
+
 	w.Header().Add("Cache-Control", "no-store, private")
 
 	if r.Header.Get("HX-Boosted") == "true" {
@@ -107,9 +260,9 @@ func (s *Server) infoPage(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Cache-Control", "private, max-age=30")
 
 	if r.Header.Get("HX-Boosted") == "true" {
-		infoPageTmpl.ExecuteTemplate(w, "layout", nil)
+		infoPageTmpl.ExecuteTemplate(w, "layout", pageData(r, nil))
 		return
 	}
 
-	infoPageTmpl.Execute(w, nil)
+	infoPageTmpl.Execute(w, pageData(r, nil))
 }
@@ -0,0 +1,132 @@
+package http
+
+import (
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+
+	"github.com/cativovo/go-demo-auth/pkg/auth"
+	"github.com/go-chi/chi/v5"
+)
+
+var passkeySettingsTmpl *template.Template = template.Must(template.ParseFiles("web/components/passkey_settings.html"))
+
+const passkeyCeremonyCookie = "passkey_ceremony"
+
+func (s *Server) registerPasskeyRoutes() {
+	s.router.Route("/account/passkeys", func(r chi.Router) {
+		r.Use(authMiddleWare(s.authService, s.sessions, s.rbacService, s.orgService))
+		r.Use(sessionOnlyMiddleware)
+		r.Post("/begin", s.handleBeginPasskeyRegistration)
+		r.Post("/finish", s.handleFinishPasskeyRegistration)
+	})
+}
+
+func (s *Server) handleBeginPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdKey).(string)
+
+	u, err := s.userService.GetUserById(r.Context(), userId)
+	if err != nil {
+		log.Println(err)
+		writePasskeyError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	options, ceremonyId, err := s.authService.BeginPasskeyRegistration(r.Context(), u.Id, u.Email, u.Name)
+	if err != nil {
+		writePasskeyError(w, http.StatusInternalServerError, passkeyErrorMessage(err))
+		return
+	}
+
+	http.SetCookie(w, createCookie(passkeyCeremonyCookie, ceremonyId, 300))
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(options)
+}
+
+func (s *Server) handleFinishPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdKey).(string)
+
+	ceremonyCookie, err := r.Cookie(passkeyCeremonyCookie)
+	if err != nil {
+		writePasskeyError(w, http.StatusBadRequest, "Passkey registration expired, please try again")
+		return
+	}
+
+	u, err := s.userService.GetUserById(r.Context(), userId)
+	if err != nil {
+		log.Println(err)
+		writePasskeyError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	http.SetCookie(w, createCookie(passkeyCeremonyCookie, "", -1))
+
+	if err := s.authService.FinishPasskeyRegistration(r.Context(), u.Id, u.Email, u.Name, ceremonyCookie.Value, r.Body); err != nil {
+		writePasskeyError(w, http.StatusBadRequest, passkeyErrorMessage(err))
+		return
+	}
+
+	passkeys, err := s.authService.GetPasskeys(r.Context(), userId)
+	if err != nil {
+		log.Println(err)
+	}
+
+	passkeySettingsTmpl.Execute(w, map[string]any{
+		"Passkeys": passkeys,
+	})
+}
+
+func (s *Server) handleBeginPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	options, ceremonyId, err := s.authService.BeginPasskeyLogin(r.Context())
+	if err != nil {
+		writePasskeyError(w, http.StatusInternalServerError, passkeyErrorMessage(err))
+		return
+	}
+
+	http.SetCookie(w, createCookie(passkeyCeremonyCookie, ceremonyId, 300))
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(options)
+}
+
+func (s *Server) handleFinishPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	ceremonyCookie, err := r.Cookie(passkeyCeremonyCookie)
+	if err != nil {
+		writePasskeyError(w, http.StatusBadRequest, "Passkey login expired, please try again")
+		return
+	}
+
+	http.SetCookie(w, createCookie(passkeyCeremonyCookie, "", -1))
+
+	token, err := s.authService.FinishPasskeyLogin(r.Context(), ceremonyCookie.Value, r.Body, auditClient(r))
+	if err != nil {
+		writePasskeyError(w, http.StatusUnauthorized, passkeyErrorMessage(err))
+		return
+	}
+
+	s.signIn(w, r, token)
+}
+
+// writePasskeyError answers the fetch calls made by passkey_script.html, which
+// put the alert in place themselves since htmx isn't involved.
+func writePasskeyError(w http.ResponseWriter, status int, message string) {
+	w.WriteHeader(status)
+	errorAlertTmpl.Execute(w, map[string]any{
+		"Message": message,
+	})
+}
+
+func passkeyErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, auth.ErrInvalidPasskey):
+		return "Passkey could not be verified"
+	case errors.Is(err, auth.ErrInvalidChallenge):
+		return "Passkey request expired, please try again"
+	case errors.Is(err, auth.ErrPasskeysDisabled):
+		return "Passkeys are not enabled"
+	case errors.Is(err, auth.ErrAccountDisabled):
+		return "This account has been disabled"
+	default:
+		return "Something went wrong"
+	}
+}
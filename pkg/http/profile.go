@@ -0,0 +1,181 @@
+package http
+
+import (
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/cativovo/go-demo-auth/pkg/auth"
+	"github.com/cativovo/go-demo-auth/pkg/password"
+	"github.com/cativovo/go-demo-auth/pkg/ratelimit"
+	"github.com/cativovo/go-demo-auth/pkg/user"
+	"github.com/go-chi/chi/v5"
+)
+
+var profileSettingsTmpl *template.Template = template.Must(template.ParseFiles("web/components/profile_settings.html"))
+
+var confirmEmailTmpl *template.Template = template.Must(template.ParseFiles("web/components/confirm_email.html"))
+
+var errOtherSessionsNotRevoked = errors.New("the other sessions couldn't be signed out")
+
+func (s *Server) registerProfileRoutes() {
+	s.router.Route("/account/profile", func(r chi.Router) {
+		r.Use(authMiddleWare(s.authService, s.sessions, s.rbacService, s.orgService))
+		r.Use(sessionOnlyMiddleware)
+		r.Get("/", s.handleProfileSettings)
+		r.Get("/name/edit", s.handleEditName)
+		r.Post("/name", s.handleUpdateName)
+		// shares the buckets of the other routes sending emails
+		r.With(
+			s.rateLimit("mail", ratelimit.Every(20, time.Hour), byIP),
+			s.rateLimit("mail-email", ratelimit.Every(3, 15*time.Minute), byEmail),
+		).Post("/email", s.handleRequestEmailChange)
+		r.With(s.rateLimit("change-password", ratelimit.Every(10, 15*time.Minute), byUserId)).Post("/password", s.handleChangePassword)
+	})
+}
+
+func (s *Server) handleProfileSettings(w http.ResponseWriter, r *http.Request) {
+	s.renderProfileSettings(w, r, nil)
+}
+
+func (s *Server) handleEditName(w http.ResponseWriter, r *http.Request) {
+	s.renderProfileSettings(w, r, map[string]any{
+		"EditingName": true,
+	})
+}
+
+func (s *Server) handleUpdateName(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdKey).(string)
+
+	if _, err := s.userService.UpdateName(r.Context(), userId, r.PostFormValue("name")); err != nil {
+		writeProfileError(w, err)
+		return
+	}
+
+	s.renderProfileSettings(w, r, nil)
+}
+
+func (s *Server) handleRequestEmailChange(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdKey).(string)
+	token := r.Context().Value(accessTokenKey).(string)
+	email := r.PostFormValue("email")
+
+	if err := s.userService.RequestEmailChange(r.Context(), userId, token, email); err != nil {
+		writeProfileError(w, err)
+		return
+	}
+
+	s.renderProfileSettings(w, r, map[string]any{
+		"PendingEmail": email,
+	})
+}
+
+func (s *Server) handleChangePassword(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdKey).(string)
+
+	if err := s.userService.ChangePassword(
+		r.Context(),
+		userId,
+		r.PostFormValue("current_password"),
+		r.PostFormValue("password"),
+		auditClient(r),
+	); err != nil {
+		writeProfileError(w, err)
+		return
+	}
+
+	// whoever knew the old password is signed out, this device stays signed in
+	token := r.Context().Value(accessTokenKey).(string)
+	if err := s.authService.RevokeOtherSessions(r.Context(), token); err != nil {
+		log.Println("handleChangePassword RevokeOtherSessions:", err)
+		writeProfileError(w, errOtherSessionsNotRevoked)
+		return
+	}
+
+	s.renderProfileSettings(w, r, map[string]any{
+		"PasswordChanged": true,
+	})
+}
+
+// handleConfirmEmail only asks to confirm the change, mail scanners following
+// the link mustn't burn the token.
+func (s *Server) handleConfirmEmail(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Cache-Control", "no-store, public")
+	w.Header().Add("Referrer-Policy", "no-referrer")
+	confirmEmailPageTmpl.Execute(w, pageData(r, map[string]any{
+		"Token": r.URL.Query().Get("token"),
+	}))
+}
+
+func (s *Server) handleConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	u, err := s.userService.ConfirmEmailChange(r.Context(), r.PostFormValue("token"), auditClient(r))
+	if err != nil {
+		confirmEmailTmpl.Execute(w, map[string]any{
+			"Error":   profileErrorMessage(err),
+			"Pending": errors.Is(err, user.ErrEmailChangePending),
+		})
+		return
+	}
+
+	confirmEmailTmpl.Execute(w, map[string]any{
+		"Email": u.Email,
+	})
+}
+
+// renderProfileSettings renders the settings with the current name and email
+// of the user, data adds the state of the forms.
+func (s *Server) renderProfileSettings(w http.ResponseWriter, r *http.Request, data map[string]any) {
+	userId := r.Context().Value(userIdKey).(string)
+
+	u, err := s.userService.GetUserById(r.Context(), userId)
+	if err != nil {
+		log.Println(err)
+		writeProfileError(w, err)
+		return
+	}
+
+	if data == nil {
+		data = map[string]any{}
+	}
+	data["Name"] = u.Name
+	data["Email"] = u.Email
+
+	profileSettingsTmpl.Execute(w, data)
+}
+
+func writeProfileError(w http.ResponseWriter, err error) {
+	w.Header().Add("HX-Reswap", "none")
+	errorAlertTmpl.Execute(w, map[string]any{
+		"Message": profileErrorMessage(err),
+	})
+}
+
+func profileErrorMessage(err error) string {
+	var policyErr *password.PolicyError
+	var throttled *auth.ThrottledError
+
+	switch {
+	case errors.As(err, &policyErr):
+		return policyErr.Message
+	case errors.As(err, &throttled):
+		return throttledMessage(throttled)
+	case errors.Is(err, user.ErrInvalidName):
+		return "Your name is required and can be at most 100 characters"
+	case errors.Is(err, user.ErrInvalidEmail):
+		return "Invalid email"
+	case errors.Is(err, user.ErrEmailAlreadyUsed):
+		return "An account already uses this email"
+	case errors.Is(err, auth.ErrInvalidCredentials):
+		return "Your current password is incorrect"
+	case errors.Is(err, user.ErrEmailChangePending):
+		return "Almost done, also open the link we sent to your other email address"
+	case errors.Is(err, auth.ErrInvalidToken):
+		return "This confirmation link is invalid or has expired"
+	case errors.Is(err, errOtherSessionsNotRevoked):
+		return "Your password was changed but your other devices couldn't be signed out, sign them out from your sessions"
+	default:
+		return "Something went wrong"
+	}
+}
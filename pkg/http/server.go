@@ -2,34 +2,70 @@ package http
 
 import (
 	"net/http"
+	"os"
 
+	"github.com/cativovo/go-demo-auth/pkg/audit"
 	"github.com/cativovo/go-demo-auth/pkg/auth"
+	"github.com/cativovo/go-demo-auth/pkg/idp"
+	"github.com/cativovo/go-demo-auth/pkg/org"
+	"github.com/cativovo/go-demo-auth/pkg/ratelimit"
+	"github.com/cativovo/go-demo-auth/pkg/rbac"
+	"github.com/cativovo/go-demo-auth/pkg/session"
 	"github.com/cativovo/go-demo-auth/pkg/user"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 )
 
 type Server struct {
-	router      *chi.Mux
-	authService auth.Service
-	userService user.Service
+	router       *chi.Mux
+	authService  auth.Service
+	userService  user.Service
+	idpService   idp.Service
+	rateLimits   ratelimit.Store
+	sessions     *session.Manager
+	rbacService  rbac.Service
+	orgService   org.Service
+	auditService audit.Service
 }
 
-func NewServer(a auth.Service, u user.Service) *Server {
+func NewServer(a auth.Service, u user.Service, i idp.Service, rl ratelimit.Store, ss session.Store, rb rbac.Service, o org.Service, au audit.Service) *Server {
 	router := chi.NewRouter()
 
+	// only behind a proxy that sets X-Forwarded-For, otherwise clients could
+	// pick the address that lockouts and rate limits apply to
+	if os.Getenv("TRUST_PROXY_HEADERS") == "true" {
+		router.Use(middleware.RealIP)
+	}
 	router.Use(middleware.Logger)
 	router.Use(setHtmlContentTypeMiddleware)
 	router.Use(middleware.Compress(5, "text/html", "text/css"))
+	router.Use(csrfMiddleware(append([]string{"/token", "/userinfo"}, apiPublicPaths...)...))
 
 	server := &Server{
-		router:      router,
-		authService: a,
-		userService: u,
+		router:       router,
+		authService:  a,
+		userService:  u,
+		idpService:   i,
+		rateLimits:   rl,
+		sessions:     session.NewManager(ss),
+		rbacService:  rb,
+		orgService:   o,
+		auditService: au,
 	}
 
 	server.registerAuthRoutes()
 	server.registerValidateRoutes()
+	server.registerTOTPRoutes()
+	server.registerPasskeyRoutes()
+	server.registerSessionRoutes()
+	server.registerProfileRoutes()
+	server.registerAccountRoutes()
+	server.registerAPITokenRoutes()
+	server.registerAPIRoutes()
+	server.registerAdminRoutes()
+	server.registerOrgRoutes()
+	server.registerOIDCRoutes()
+	server.registerIdPRoutes()
 	server.registerPages()
 
 	return server
@@ -38,3 +74,9 @@ func NewServer(a auth.Service, u user.Service) *Server {
 func (s *Server) ListenAndServe(addr string) {
 	http.ListenAndServe(addr, s.router)
 }
+
+// rateLimit limits the requests of each key, limiters with the same name
+// share their buckets.
+func (s *Server) rateLimit(name string, fallback ratelimit.Limit, key rateLimitKeyFunc) func(next http.Handler) http.Handler {
+	return rateLimitMiddleware(ratelimit.New(name, s.rateLimits, fallback), key)
+}
@@ -0,0 +1,76 @@
+package http
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+
+	"github.com/cativovo/go-demo-auth/pkg/auth"
+	"github.com/go-chi/chi/v5"
+)
+
+var sessionSettingsTmpl *template.Template = template.Must(template.ParseFiles("web/components/session_settings.html"))
+
+func (s *Server) registerSessionRoutes() {
+	s.router.Route("/account/sessions", func(r chi.Router) {
+		r.Use(authMiddleWare(s.authService, s.sessions, s.rbacService, s.orgService))
+		r.Use(sessionOnlyMiddleware)
+		r.Post("/{sessionId}/revoke", s.handleRevokeSession)
+		r.Post("/revoke-others", s.handleRevokeOtherSessions)
+	})
+}
+
+func (s *Server) handleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdKey).(string)
+
+	if err := s.authService.RevokeSession(r.Context(), userId, chi.URLParam(r, "sessionId")); err != nil {
+		w.Header().Add("HX-Reswap", "none")
+		errorAlertTmpl.Execute(w, map[string]any{
+			"Message": sessionErrorMessage(err),
+		})
+		return
+	}
+
+	s.renderSessionSettings(w, r)
+}
+
+func (s *Server) handleRevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	token := r.Context().Value(accessTokenKey).(string)
+
+	if err := s.authService.RevokeOtherSessions(r.Context(), token); err != nil {
+		w.Header().Add("HX-Reswap", "none")
+		errorAlertTmpl.Execute(w, map[string]any{
+			"Message": sessionErrorMessage(err),
+		})
+		return
+	}
+
+	s.renderSessionSettings(w, r)
+}
+
+func (s *Server) renderSessionSettings(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdKey).(string)
+	claims := r.Context().Value(claimsKey).(auth.Claims)
+
+	sessions, err := s.authService.GetSessions(r.Context(), userId, claims.SessionId)
+	if err != nil {
+		w.Header().Add("HX-Reswap", "none")
+		errorAlertTmpl.Execute(w, map[string]any{
+			"Message": sessionErrorMessage(err),
+		})
+		return
+	}
+
+	sessionSettingsTmpl.Execute(w, map[string]any{
+		"Sessions": sessions,
+	})
+}
+
+func sessionErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, auth.ErrSessionNotFound):
+		return "This session has already been signed out"
+	default:
+		return "Something went wrong"
+	}
+}
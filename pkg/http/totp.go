@@ -0,0 +1,110 @@
+package http
+
+import (
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/cativovo/go-demo-auth/pkg/auth"
+	"github.com/cativovo/go-demo-auth/pkg/ratelimit"
+	"github.com/go-chi/chi/v5"
+	"github.com/skip2/go-qrcode"
+)
+
+var totpSettingsTmpl *template.Template = template.Must(template.ParseFiles("web/components/totp_settings.html"))
+
+func (s *Server) registerTOTPRoutes() {
+	s.router.Route("/account/totp", func(r chi.Router) {
+		r.Use(authMiddleWare(s.authService, s.sessions, s.rbacService, s.orgService))
+		r.Use(sessionOnlyMiddleware)
+		r.Post("/enroll", s.handleEnrollTOTP)
+		// both take a code, they share a bucket so it can't be guessed twice as fast
+		totpByUser := s.rateLimit("totp-settings", ratelimit.Every(10, 15*time.Minute), byUserId)
+		r.With(totpByUser).Post("/confirm", s.handleConfirmTOTP)
+		r.With(totpByUser).Post("/disable", s.handleDisableTOTP)
+	})
+}
+
+func (s *Server) handleEnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdKey).(string)
+
+	u, err := s.userService.GetUserById(r.Context(), userId)
+	if err != nil {
+		log.Println(err)
+		w.Header().Add("HX-Reswap", "none")
+		errorAlertTmpl.Execute(w, map[string]any{
+			"Message": "Something went wrong",
+		})
+		return
+	}
+
+	enrollment, err := s.authService.EnrollTOTP(r.Context(), userId, u.Email)
+	if err != nil {
+		w.Header().Add("HX-Reswap", "none")
+		errorAlertTmpl.Execute(w, map[string]any{
+			"Message": totpErrorMessage(err),
+		})
+		return
+	}
+
+	png, err := qrcode.Encode(enrollment.URI, qrcode.Medium, 256)
+	if err != nil {
+		log.Println(err)
+		w.Header().Add("HX-Reswap", "none")
+		errorAlertTmpl.Execute(w, map[string]any{
+			"Message": "Something went wrong",
+		})
+		return
+	}
+
+	totpSettingsTmpl.Execute(w, map[string]any{
+		"TOTPEnrollment": enrollment,
+		"TOTPQRCode":     template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png)),
+	})
+}
+
+func (s *Server) handleConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdKey).(string)
+
+	if err := s.authService.ConfirmTOTP(r.Context(), userId, r.PostFormValue("code")); err != nil {
+		w.Header().Add("HX-Reswap", "none")
+		errorAlertTmpl.Execute(w, map[string]any{
+			"Message": totpErrorMessage(err),
+		})
+		return
+	}
+
+	totpSettingsTmpl.Execute(w, map[string]any{
+		"TOTPEnabled": true,
+	})
+}
+
+func (s *Server) handleDisableTOTP(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userIdKey).(string)
+
+	if err := s.authService.DisableTOTP(r.Context(), userId, r.PostFormValue("code")); err != nil {
+		w.Header().Add("HX-Reswap", "none")
+		errorAlertTmpl.Execute(w, map[string]any{
+			"Message": totpErrorMessage(err),
+		})
+		return
+	}
+
+	totpSettingsTmpl.Execute(w, map[string]any{
+		"TOTPEnabled": false,
+	})
+}
+
+func totpErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, auth.ErrInvalidTOTPCode):
+		return "Invalid authentication code"
+	case errors.Is(err, auth.ErrTOTPNotEnrolled), errors.Is(err, auth.ErrTOTPAlreadyEnabled):
+		return err.Error()
+	default:
+		return "Something went wrong"
+	}
+}
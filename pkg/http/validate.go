@@ -5,14 +5,19 @@ import (
 	"html/template"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/cativovo/go-demo-auth/pkg/password"
+	"github.com/cativovo/go-demo-auth/pkg/ratelimit"
 	"github.com/cativovo/go-demo-auth/pkg/user"
 )
 
 var registerFormTmpl *template.Template = template.Must(template.ParseFiles("web/components/register_form.html"))
 
 func (s *Server) registerValidateRoutes() {
-	s.router.Post("/validate-register", s.handleValidateRegister)
+	// the email check tells whether an account exists, limit how fast
+	// that can be probed
+	s.router.With(s.rateLimit("validate-register", ratelimit.Every(60, time.Minute), byIP)).Post("/validate-register", s.handleValidateRegister)
 }
 
 func (s *Server) handleValidateRegister(w http.ResponseWriter, r *http.Request) {
@@ -41,12 +46,22 @@ func (s *Server) handleValidateRegister(w http.ResponseWriter, r *http.Request)
 		}
 	}
 
+	if data["ErrPassword"] == nil {
+		if err := s.userService.ValidatePassword(user.Credentials{
+			Email:    email,
+			Password: password,
+			Name:     name,
+		}); err != nil {
+			data["ErrPassword"] = passwordErrorMessage(err)
+		}
+	}
+
 	if data["ErrEmail"] != nil {
 		registerFormTmpl.Execute(w, data)
 		return
 	}
 
-	_, err := s.userService.GetUserByEmail(email)
+	_, err := s.userService.GetUserByEmail(r.Context(), email)
 
 	if err == nil {
 		data["ErrEmail"] = "Email is already used!"
@@ -61,7 +76,19 @@ func (s *Server) handleValidateRegister(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	data["AreValuesValid"] = errs == nil
+	data["AreValuesValid"] = errs == nil && data["ErrPassword"] == nil
 
 	registerFormTmpl.Execute(w, data)
 }
+
+// helpers
+// passwordErrorMessage tells the user what to change when err is a
+// password.PolicyError.
+func passwordErrorMessage(err error) string {
+	var policyErr *password.PolicyError
+	if errors.As(err, &policyErr) {
+		return policyErr.Message
+	}
+
+	return "Something went wrong"
+}
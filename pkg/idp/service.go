@@ -0,0 +1,444 @@
+package idp
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cativovo/go-demo-auth/pkg/user"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// The error codes are the ones defined by RFC 6749 so that they can be sent
+// to clients as they are.
+var (
+	ErrInvalidRequest          = errors.New("invalid_request")
+	ErrInvalidClient           = errors.New("invalid_client")
+	ErrInvalidGrant            = errors.New("invalid_grant")
+	ErrUnsupportedGrantType    = errors.New("unsupported_grant_type")
+	ErrUnsupportedResponseType = errors.New("unsupported_response_type")
+	ErrInvalidScope            = errors.New("invalid_scope")
+	ErrAccessDenied            = errors.New("access_denied")
+	ErrInvalidRedirectURI      = errors.New("invalid redirect uri")
+	ErrInvalidToken            = errors.New("invalid_token")
+	ErrServerError             = errors.New("server_error")
+)
+
+const (
+	authorizationCodeLifetime = time.Minute
+	tokenLifetime             = time.Hour
+)
+
+var supportedScopes = []string{"openid", "email", "profile"}
+
+type Client struct {
+	Id   string
+	Name string
+	// SecretHash is the sha256 of the secret, empty for public clients
+	// which have to rely on PKCE alone.
+	SecretHash   string
+	RedirectURIs []string
+}
+
+// AuthorizationRequest holds the parameters of a request to /authorize.
+type AuthorizationRequest struct {
+	ResponseType        string
+	ClientId            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+type AuthorizationCode struct {
+	CodeHash      string
+	ClientId      string
+	UserId        string
+	RedirectURI   string
+	Scope         string
+	Nonce         string
+	CodeChallenge string
+	ExpiresAt     time.Time
+}
+
+type TokenRequest struct {
+	ClientId     string
+	ClientSecret string
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+}
+
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	IdToken     string `json:"id_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	Scope       string `json:"scope"`
+}
+
+type UserInfo struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+	Name          string `json:"name,omitempty"`
+}
+
+type Discovery struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JwksURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IdTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+type Service interface {
+	Discovery() Discovery
+	JWKS() JWKS
+	// ValidateAuthorizationRequest returns ErrInvalidClient or
+	// ErrInvalidRedirectURI when the user can't be sent back to the client,
+	// any other error can be reported to the redirect uri.
+	ValidateAuthorizationRequest(ctx context.Context, req AuthorizationRequest) (Client, error)
+	HasConsent(ctx context.Context, userId string, req AuthorizationRequest) (bool, error)
+	// Authorize records the consent of the user and returns the redirect uri
+	// carrying the authorization code.
+	Authorize(ctx context.Context, userId string, req AuthorizationRequest) (string, error)
+	// ErrorRedirect returns the redirect uri reporting err to the client, req
+	// must have passed the client and redirect uri checks.
+	ErrorRedirect(req AuthorizationRequest, err error) string
+	Exchange(ctx context.Context, req TokenRequest) (TokenResponse, error)
+	UserInfo(ctx context.Context, accessToken string) (UserInfo, error)
+}
+
+type Repository interface {
+	GetOAuthClient(ctx context.Context, id string) (Client, error)
+	AddAuthorizationCode(ctx context.Context, c AuthorizationCode) error
+	TakeAuthorizationCode(ctx context.Context, codeHash string) (AuthorizationCode, error)
+	GetConsentScope(ctx context.Context, userId, clientId string) (string, error)
+	SaveConsent(ctx context.Context, userId, clientId, scope string) error
+}
+
+type Config struct {
+	// Issuer is the public URL of the server, e.g. https://accounts.example.com
+	Issuer     string
+	SigningKey *rsa.PrivateKey
+}
+
+type service struct {
+	repository  Repository
+	userService user.Service
+	issuer      string
+	key         *rsa.PrivateKey
+	keyId       string
+}
+
+func NewIdPService(r Repository, u user.Service, c Config) Service {
+	return &service{
+		repository:  r,
+		userService: u,
+		issuer:      strings.TrimSuffix(c.Issuer, "/"),
+		key:         c.SigningKey,
+		keyId:       keyId(&c.SigningKey.PublicKey),
+	}
+}
+
+func (s *service) Discovery() Discovery {
+	return Discovery{
+		Issuer:                            s.issuer,
+		AuthorizationEndpoint:             s.issuer + "/authorize",
+		TokenEndpoint:                     s.issuer + "/token",
+		UserinfoEndpoint:                  s.issuer + "/userinfo",
+		JwksURI:                           s.issuer + "/jwks",
+		ScopesSupported:                   supportedScopes,
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code"},
+		SubjectTypesSupported:             []string{"public"},
+		IdTokenSigningAlgValuesSupported:  []string{"RS256"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "nonce", "email", "email_verified", "name"},
+	}
+}
+
+func (s *service) JWKS() JWKS {
+	return JWKS{
+		Keys: []JWK{publicJWK(s.keyId, &s.key.PublicKey)},
+	}
+}
+
+func (s *service) ValidateAuthorizationRequest(ctx context.Context, req AuthorizationRequest) (Client, error) {
+	c, err := s.repository.GetOAuthClient(ctx, req.ClientId)
+	if err != nil {
+		return Client{}, ErrInvalidClient
+	}
+
+	// redirect uris are compared exactly, anything looser is an open redirect
+	if !slices.Contains(c.RedirectURIs, req.RedirectURI) {
+		return Client{}, ErrInvalidRedirectURI
+	}
+
+	if req.ResponseType != "code" {
+		return c, ErrUnsupportedResponseType
+	}
+
+	scopes := strings.Fields(req.Scope)
+	if !slices.Contains(scopes, "openid") {
+		return c, ErrInvalidScope
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(supportedScopes, scope) {
+			return c, ErrInvalidScope
+		}
+	}
+
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != "S256" {
+		return c, ErrInvalidRequest
+	}
+
+	return c, nil
+}
+
+func (s *service) HasConsent(ctx context.Context, userId string, req AuthorizationRequest) (bool, error) {
+	granted, err := s.repository.GetConsentScope(ctx, userId, req.ClientId)
+	if err != nil {
+		// no row means the user never consented
+		return false, nil
+	}
+
+	grantedScopes := strings.Fields(granted)
+	for _, scope := range strings.Fields(req.Scope) {
+		if !slices.Contains(grantedScopes, scope) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func (s *service) Authorize(ctx context.Context, userId string, req AuthorizationRequest) (string, error) {
+	if _, err := s.ValidateAuthorizationRequest(ctx, req); err != nil {
+		return "", err
+	}
+
+	code, err := randomToken()
+	if err != nil {
+		log.Println("IdPService Authorize randomToken:", err)
+		return "", ErrServerError
+	}
+
+	c := AuthorizationCode{
+		CodeHash:      hashToken(code),
+		ClientId:      req.ClientId,
+		UserId:        userId,
+		RedirectURI:   req.RedirectURI,
+		Scope:         req.Scope,
+		Nonce:         req.Nonce,
+		CodeChallenge: req.CodeChallenge,
+		ExpiresAt:     time.Now().Add(authorizationCodeLifetime),
+	}
+
+	if err := s.repository.AddAuthorizationCode(ctx, c); err != nil {
+		log.Println("IdPService Authorize AddAuthorizationCode:", err)
+		return "", ErrServerError
+	}
+
+	if err := s.repository.SaveConsent(ctx, userId, req.ClientId, req.Scope); err != nil {
+		log.Println("IdPService Authorize SaveConsent:", err)
+		return "", ErrServerError
+	}
+
+	return redirectURI(req, url.Values{"code": {code}}), nil
+}
+
+func (s *service) ErrorRedirect(req AuthorizationRequest, err error) string {
+	return redirectURI(req, url.Values{"error": {err.Error()}})
+}
+
+func (s *service) Exchange(ctx context.Context, req TokenRequest) (TokenResponse, error) {
+	client, err := s.repository.GetOAuthClient(ctx, req.ClientId)
+	if err != nil {
+		return TokenResponse{}, ErrInvalidClient
+	}
+
+	if client.SecretHash != "" && subtle.ConstantTimeCompare([]byte(hashToken(req.ClientSecret)), []byte(client.SecretHash)) != 1 {
+		return TokenResponse{}, ErrInvalidClient
+	}
+
+	c, err := s.repository.TakeAuthorizationCode(ctx, hashToken(req.Code))
+	if err != nil {
+		return TokenResponse{}, ErrInvalidGrant
+	}
+
+	if c.ClientId != client.Id || c.RedirectURI != req.RedirectURI || time.Now().After(c.ExpiresAt) {
+		return TokenResponse{}, ErrInvalidGrant
+	}
+
+	if subtle.ConstantTimeCompare([]byte(s256(req.CodeVerifier)), []byte(c.CodeChallenge)) != 1 {
+		return TokenResponse{}, ErrInvalidGrant
+	}
+
+	u, err := s.userService.GetUserById(ctx, c.UserId)
+	if err != nil || u.DisabledAt != nil {
+		return TokenResponse{}, ErrInvalidGrant
+	}
+
+	now := time.Now()
+	expiresAt := jwt.NewNumericDate(now.Add(tokenLifetime))
+
+	accessToken, err := s.sign(accessTokenClaims{
+		Scope:    c.Scope,
+		ClientId: client.Id,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.issuer,
+			Subject:   u.Id,
+			Audience:  jwt.ClaimStrings{s.issuer + "/userinfo"},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: expiresAt,
+		},
+	})
+	if err != nil {
+		log.Println("IdPService Exchange sign access token:", err)
+		return TokenResponse{}, ErrServerError
+	}
+
+	info := userInfo(u, c.Scope)
+
+	idToken, err := s.sign(idTokenClaims{
+		Nonce:         c.Nonce,
+		Email:         info.Email,
+		EmailVerified: info.EmailVerified,
+		Name:          info.Name,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.issuer,
+			Subject:   u.Id,
+			Audience:  jwt.ClaimStrings{client.Id},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: expiresAt,
+		},
+	})
+	if err != nil {
+		log.Println("IdPService Exchange sign id token:", err)
+		return TokenResponse{}, ErrServerError
+	}
+
+	return TokenResponse{
+			AccessToken: accessToken,
+			IdToken:     idToken,
+			TokenType:   "Bearer",
+			ExpiresIn:   int(tokenLifetime.Seconds()),
+			Scope:       c.Scope,
+		},
+		nil
+}
+
+func (s *service) UserInfo(ctx context.Context, accessToken string) (UserInfo, error) {
+	claims := accessTokenClaims{}
+
+	_, err := jwt.ParseWithClaims(
+		accessToken,
+		&claims,
+		func(t *jwt.Token) (any, error) {
+			return &s.key.PublicKey, nil
+		},
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithIssuer(s.issuer),
+		jwt.WithAudience(s.issuer+"/userinfo"),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return UserInfo{}, ErrInvalidToken
+	}
+
+	// the tokens of a user who was disabled since stop working
+	u, err := s.userService.GetUserById(ctx, claims.Subject)
+	if err != nil || u.DisabledAt != nil {
+		return UserInfo{}, ErrInvalidToken
+	}
+
+	return userInfo(u, claims.Scope), nil
+}
+
+// helpers
+type accessTokenClaims struct {
+	Scope    string `json:"scope"`
+	ClientId string `json:"client_id"`
+	jwt.RegisteredClaims
+}
+
+type idTokenClaims struct {
+	Nonce         string `json:"nonce,omitempty"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+	Name          string `json:"name,omitempty"`
+	jwt.RegisteredClaims
+}
+
+func (s *service) sign(claims jwt.Claims) (string, error) {
+	t := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	t.Header["kid"] = s.keyId
+
+	return t.SignedString(s.key)
+}
+
+// userInfo only releases the claims covered by the granted scopes.
+func userInfo(u user.User, scope string) UserInfo {
+	info := UserInfo{
+		Subject: u.Id,
+	}
+
+	scopes := strings.Fields(scope)
+
+	if slices.Contains(scopes, "email") {
+		verified := u.VerifiedAt != nil
+		info.Email = u.Email
+		info.EmailVerified = &verified
+	}
+
+	if slices.Contains(scopes, "profile") {
+		info.Name = u.Name
+	}
+
+	return info
+}
+
+func redirectURI(req AuthorizationRequest, v url.Values) string {
+	if req.State != "" {
+		v.Set("state", req.State)
+	}
+
+	separator := "?"
+	if strings.Contains(req.RedirectURI, "?") {
+		separator = "&"
+	}
+
+	return req.RedirectURI + separator + v.Encode()
+}
+
+func s256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
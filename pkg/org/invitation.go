@@ -0,0 +1,193 @@
+package org
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/mail"
+	"slices"
+	"strings"
+	"time"
+
+	mailer "github.com/cativovo/go-demo-auth/pkg/mail"
+)
+
+const invitationLifetime = 7 * 24 * time.Hour
+
+// Invitation lets whoever owns Email join the organization. Only the sha256
+// of its token is stored, the token is in the emailed link.
+type Invitation struct {
+	Id        string
+	OrgId     string
+	OrgName   string
+	Email     string
+	Role      string
+	InvitedBy string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// Invite emails a link to join orgId, a new invitation to the same email
+// doesn't revoke the previous ones.
+func (s *service) Invite(ctx context.Context, orgId, invitedBy, email, role string) (Invitation, error) {
+	email = strings.TrimSpace(email)
+	if a, err := mail.ParseAddress(email); err != nil || a.Address != email {
+		return Invitation{}, ErrInvalidEmail
+	}
+
+	if !slices.Contains(Roles, role) {
+		return Invitation{}, ErrInvalidRole
+	}
+
+	o, err := s.repository.GetOrganizationById(ctx, orgId)
+	if err != nil {
+		log.Println("OrgService Invite GetOrganizationById:", err)
+		return Invitation{}, ErrSomethingWentWrong
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		log.Println("OrgService Invite randomToken:", err)
+		return Invitation{}, ErrSomethingWentWrong
+	}
+
+	i, err := s.repository.AddInvitation(ctx, Invitation{
+		OrgId:     orgId,
+		Email:     email,
+		Role:      role,
+		InvitedBy: invitedBy,
+		ExpiresAt: time.Now().Add(invitationLifetime),
+	}, hashToken(token))
+	if err != nil {
+		log.Println("OrgService Invite AddInvitation:", err)
+		return Invitation{}, ErrSomethingWentWrong
+	}
+
+	link := fmt.Sprintf("%s/invitations/%s", s.appUrl, token)
+
+	if s.mailer == nil {
+		log.Println("OrgService Invite: no mailer, invitation link for", email, link)
+		return i, nil
+	}
+
+	m := mailer.Message{
+		To:      email,
+		Subject: fmt.Sprintf("You're invited to join %s", o.Name),
+		Body: fmt.Sprintf(
+			"You have been invited to join %s as %s. Follow this link to accept, it expires in %d days.\n\n%s\n\nIf you weren't expecting this, you can ignore this email.\n",
+			o.Name,
+			role,
+			int(invitationLifetime.Hours()/24),
+			link,
+		),
+	}
+
+	if err := s.mailer.Send(m); err != nil {
+		log.Println("OrgService Invite Send:", err)
+		return Invitation{}, ErrSomethingWentWrong
+	}
+
+	return i, nil
+}
+
+func (s *service) GetInvitations(ctx context.Context, orgId string) ([]Invitation, error) {
+	invitations, err := s.repository.GetInvitationsByOrgId(ctx, orgId)
+	if err != nil {
+		log.Println("OrgService GetInvitations GetInvitationsByOrgId:", err)
+		return nil, ErrSomethingWentWrong
+	}
+
+	return invitations, nil
+}
+
+func (s *service) RevokeInvitation(ctx context.Context, orgId, invitationId string) error {
+	deleted, err := s.repository.DeleteInvitation(ctx, orgId, invitationId)
+	if err != nil {
+		log.Println("OrgService RevokeInvitation DeleteInvitation:", err)
+		return ErrSomethingWentWrong
+	}
+
+	if !deleted {
+		return ErrInvitationNotFound
+	}
+
+	return nil
+}
+
+func (s *service) GetInvitation(ctx context.Context, token string) (Invitation, error) {
+	i, err := s.repository.GetInvitationByHash(ctx, hashToken(token))
+	if err != nil {
+		return Invitation{}, ErrInvalidInvitation
+	}
+
+	o, err := s.repository.GetOrganizationById(ctx, i.OrgId)
+	if err != nil {
+		log.Println("OrgService GetInvitation GetOrganizationById:", err)
+		return Invitation{}, ErrSomethingWentWrong
+	}
+
+	i.OrgName = o.Name
+
+	return i, nil
+}
+
+func (s *service) AcceptInvitation(ctx context.Context, token, userId string) (Membership, error) {
+	i, err := s.GetInvitation(ctx, token)
+	if err != nil {
+		return Membership{}, err
+	}
+
+	u, err := s.repository.GetUserById(ctx, userId)
+	if err != nil {
+		log.Println("OrgService AcceptInvitation GetUserById:", err)
+		return Membership{}, ErrSomethingWentWrong
+	}
+
+	// the link could have been forwarded, only the invited email can use it
+	if !strings.EqualFold(u.Email, i.Email) {
+		return Membership{}, ErrInvitationEmailMismatch
+	}
+
+	if err := s.repository.AddMembership(ctx, i.OrgId, userId, i.Role); err != nil {
+		log.Println("OrgService AcceptInvitation AddMembership:", err)
+		return Membership{}, ErrSomethingWentWrong
+	}
+
+	if _, err := s.repository.DeleteInvitation(ctx, i.OrgId, i.Id); err != nil {
+		log.Println("OrgService AcceptInvitation DeleteInvitation:", err)
+	}
+
+	// the user may already have been a member with another role
+	memberships, err := s.repository.GetMembershipsByUserId(ctx, userId)
+	if err != nil {
+		log.Println("OrgService AcceptInvitation GetMembershipsByUserId:", err)
+		return Membership{}, ErrSomethingWentWrong
+	}
+
+	for _, m := range memberships {
+		if m.Id == i.OrgId {
+			return m, nil
+		}
+	}
+
+	return Membership{}, ErrSomethingWentWrong
+}
+
+// helpers
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
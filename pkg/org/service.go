@@ -0,0 +1,278 @@
+package org
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cativovo/go-demo-auth/pkg/mail"
+	"github.com/cativovo/go-demo-auth/pkg/user"
+)
+
+var (
+	ErrSomethingWentWrong      = errors.New("something went wrong")
+	ErrInvalidOrganizationName = errors.New("organization name is required and must be at most 64 characters")
+	ErrInvalidRole             = errors.New("invalid organization role")
+	ErrNotMember               = errors.New("not a member of the organization")
+	ErrLastOwner               = errors.New("the last owner can't leave or lose the owner role")
+	ErrInvalidEmail            = errors.New("invalid email")
+	ErrInvalidInvitation       = errors.New("invitation is invalid or expired")
+	ErrInvitationNotFound      = errors.New("invitation not found")
+	ErrInvitationEmailMismatch = errors.New("invitation was sent to another email")
+)
+
+// The roles a member can have in an organization, they are unrelated to the
+// roles of rbac which apply to the whole app.
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
+var Roles = []string{RoleOwner, RoleAdmin, RoleMember}
+
+const maxOrganizationNameLength = 64
+
+type Organization struct {
+	Id        string
+	Name      string
+	CreatedAt time.Time
+}
+
+// Membership is an organization of a user along with their role in it.
+type Membership struct {
+	Organization
+	Role string
+}
+
+// CanManage tells if the member can invite, remove and change the role of
+// the other members.
+func (m Membership) CanManage() bool {
+	return m.Role == RoleOwner || m.Role == RoleAdmin
+}
+
+type Member struct {
+	UserId   string
+	Email    string
+	Name     string
+	Role     string
+	JoinedAt time.Time
+}
+
+type Service interface {
+	// GetMemberships returns the organizations of the user, a personal one
+	// is created for users who don't belong to any.
+	GetMemberships(ctx context.Context, userId string) ([]Membership, error)
+	CreateOrganization(ctx context.Context, userId, name string) (Organization, error)
+	GetMembers(ctx context.Context, orgId string) ([]Member, error)
+	// UpdateMemberRole and RemoveMember return ErrLastOwner instead of
+	// leaving the organization without an owner.
+	UpdateMemberRole(ctx context.Context, orgId, userId, role string) error
+	RemoveMember(ctx context.Context, orgId, userId string) error
+	Invite(ctx context.Context, orgId, invitedBy, email, role string) (Invitation, error)
+	GetInvitations(ctx context.Context, orgId string) ([]Invitation, error)
+	RevokeInvitation(ctx context.Context, orgId, invitationId string) error
+	GetInvitation(ctx context.Context, token string) (Invitation, error)
+	// AcceptInvitation adds the user to the organization of the invitation
+	// if it was sent to their email.
+	AcceptInvitation(ctx context.Context, token, userId string) (Membership, error)
+}
+
+type Repository interface {
+	AddOrganization(ctx context.Context, name string) (Organization, error)
+	GetOrganizationById(ctx context.Context, id string) (Organization, error)
+	GetMembershipsByUserId(ctx context.Context, userId string) ([]Membership, error)
+	GetMembers(ctx context.Context, orgId string) ([]Member, error)
+	AddMembership(ctx context.Context, orgId, userId, role string) error
+	UpdateMembershipRole(ctx context.Context, orgId, userId, role string) (bool, error)
+	DeleteMembership(ctx context.Context, orgId, userId string) (bool, error)
+	CountOrganizationOwners(ctx context.Context, orgId string) (int, error)
+	AddInvitation(ctx context.Context, i Invitation, tokenHash string) (Invitation, error)
+	GetInvitationByHash(ctx context.Context, tokenHash string) (Invitation, error)
+	GetInvitationsByOrgId(ctx context.Context, orgId string) ([]Invitation, error)
+	DeleteInvitation(ctx context.Context, orgId, id string) (bool, error)
+	GetUserById(ctx context.Context, id string) (user.User, error)
+}
+
+type service struct {
+	repository Repository
+	mailer     mail.Mailer
+	appUrl     string
+}
+
+type Option func(*service)
+
+// WithMailer sends the invitations, they are only logged without it.
+func WithMailer(m mail.Mailer, appUrl string) Option {
+	return func(s *service) {
+		s.mailer = m
+		s.appUrl = appUrl
+	}
+}
+
+func NewOrgService(r Repository, opts ...Option) Service {
+	s := &service{
+		repository: r,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+func (s *service) GetMemberships(ctx context.Context, userId string) ([]Membership, error) {
+	memberships, err := s.repository.GetMembershipsByUserId(ctx, userId)
+	if err != nil {
+		log.Println("OrgService GetMemberships GetMembershipsByUserId:", err)
+		return nil, ErrSomethingWentWrong
+	}
+
+	if len(memberships) > 0 {
+		return memberships, nil
+	}
+
+	u, err := s.repository.GetUserById(ctx, userId)
+	if err != nil {
+		log.Println("OrgService GetMemberships GetUserById:", err)
+		return nil, ErrSomethingWentWrong
+	}
+
+	name := u.Name
+	if name == "" {
+		name = u.Email
+	}
+
+	o, err := s.CreateOrganization(ctx, userId, truncate(name+"'s organization", maxOrganizationNameLength))
+	if err != nil {
+		return nil, err
+	}
+
+	return []Membership{
+			{
+				Organization: o,
+				Role:         RoleOwner,
+			},
+		},
+		nil
+}
+
+// CreateOrganization makes userId the owner of the new organization.
+func (s *service) CreateOrganization(ctx context.Context, userId, name string) (Organization, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxOrganizationNameLength {
+		return Organization{}, ErrInvalidOrganizationName
+	}
+
+	o, err := s.repository.AddOrganization(ctx, name)
+	if err != nil {
+		log.Println("OrgService CreateOrganization AddOrganization:", err)
+		return Organization{}, ErrSomethingWentWrong
+	}
+
+	if err := s.repository.AddMembership(ctx, o.Id, userId, RoleOwner); err != nil {
+		log.Println("OrgService CreateOrganization AddMembership:", err)
+		return Organization{}, ErrSomethingWentWrong
+	}
+
+	return o, nil
+}
+
+func (s *service) GetMembers(ctx context.Context, orgId string) ([]Member, error) {
+	members, err := s.repository.GetMembers(ctx, orgId)
+	if err != nil {
+		log.Println("OrgService GetMembers GetMembers:", err)
+		return nil, ErrSomethingWentWrong
+	}
+
+	return members, nil
+}
+
+func (s *service) UpdateMemberRole(ctx context.Context, orgId, userId, role string) error {
+	if !slices.Contains(Roles, role) {
+		return ErrInvalidRole
+	}
+
+	if role != RoleOwner {
+		if err := s.checkLastOwner(ctx, orgId, userId); err != nil {
+			return err
+		}
+	}
+
+	updated, err := s.repository.UpdateMembershipRole(ctx, orgId, userId, role)
+	if err != nil {
+		log.Println("OrgService UpdateMemberRole UpdateMembershipRole:", err)
+		return ErrSomethingWentWrong
+	}
+
+	if !updated {
+		return ErrNotMember
+	}
+
+	return nil
+}
+
+func (s *service) RemoveMember(ctx context.Context, orgId, userId string) error {
+	if err := s.checkLastOwner(ctx, orgId, userId); err != nil {
+		return err
+	}
+
+	deleted, err := s.repository.DeleteMembership(ctx, orgId, userId)
+	if err != nil {
+		log.Println("OrgService RemoveMember DeleteMembership:", err)
+		return ErrSomethingWentWrong
+	}
+
+	if !deleted {
+		return ErrNotMember
+	}
+
+	return nil
+}
+
+// helpers
+// checkLastOwner returns ErrLastOwner when userId is the only owner of the
+// organization.
+func (s *service) checkLastOwner(ctx context.Context, orgId, userId string) error {
+	count, err := s.repository.CountOrganizationOwners(ctx, orgId)
+	if err != nil {
+		log.Println("OrgService checkLastOwner CountOrganizationOwners:", err)
+		return ErrSomethingWentWrong
+	}
+
+	if count > 1 {
+		return nil
+	}
+
+	memberships, err := s.repository.GetMembershipsByUserId(ctx, userId)
+	if err != nil {
+		log.Println("OrgService checkLastOwner GetMembershipsByUserId:", err)
+		return ErrSomethingWentWrong
+	}
+
+	for _, m := range memberships {
+		if m.Id == orgId && m.Role == RoleOwner {
+			return ErrLastOwner
+		}
+	}
+
+	return nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+
+	// cut on a rune boundary
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+
+	return s[:n]
+}
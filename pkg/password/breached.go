@@ -0,0 +1,140 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// prefixLength is the number of hex characters of the SHA-1 hash a range
+// is looked up with, like the Have I Been Pwned range API.
+const prefixLength = 5
+
+// HashFile is a file of the SHA-1 hashes of breached passwords, one
+// "<HASH>:<COUNT>" line per password sorted by hash, e.g. the Pwned
+// Passwords download ordered by hash. It's searched without loading it in
+// memory.
+type HashFile struct {
+	path string
+}
+
+func NewHashFile(path string) (*HashFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't open the breached password file: %w", err)
+	}
+	defer f.Close()
+
+	return &HashFile{
+		path: path,
+	}, nil
+}
+
+// IsBreached looks the password up by the range of its hash prefix, so
+// swapping the file for the range API doesn't change what is compared.
+func (h *HashFile) IsBreached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	suffixes, err := h.Range(hash[:prefixLength])
+	if err != nil {
+		return false, err
+	}
+
+	return slices.Contains(suffixes, hash[prefixLength:]), nil
+}
+
+// Range returns the rest of the hashes starting with prefix, which is made
+// of uppercase hex characters.
+func (h *HashFile) Range(prefix string) ([]string, error) {
+	f, err := os.Open(h.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+
+	// binary search the first line at or after prefix, the offsets are
+	// moved to the start of the next line
+	lo, hi := int64(0), size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+
+		start, err := lineStart(f, mid, size)
+		if err != nil {
+			return nil, err
+		}
+
+		line, err := readLine(f, start, size)
+		if err != nil {
+			return nil, err
+		}
+
+		if start < size && line < prefix {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+
+	start, err := lineStart(f, lo, size)
+	if err != nil {
+		return nil, err
+	}
+
+	var suffixes []string
+
+	scanner := bufio.NewScanner(io.NewSectionReader(f, start, size-start))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, prefix) {
+			break
+		}
+
+		hash, _, _ := strings.Cut(line, ":")
+		suffixes = append(suffixes, hash[prefixLength:])
+	}
+
+	return suffixes, scanner.Err()
+}
+
+// helpers
+// lineStart is the offset of the first line starting at or after offset.
+func lineStart(f *os.File, offset, size int64) (int64, error) {
+	if offset == 0 {
+		return 0, nil
+	}
+
+	r := bufio.NewReader(io.NewSectionReader(f, offset-1, size-offset+1))
+
+	skipped, err := r.ReadString('\n')
+	if err == io.EOF {
+		return size, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return offset - 1 + int64(len(skipped)), nil
+}
+
+func readLine(f *os.File, start, size int64) (string, error) {
+	r := bufio.NewReader(io.NewSectionReader(f, start, size-start))
+
+	line, err := r.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+
+	return strings.TrimSpace(line), nil
+}
@@ -0,0 +1,115 @@
+package password
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// the SHA-1 hash of "password"
+const passwordHash = "5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8"
+
+func hashLine(prefix string, c string) string {
+	return prefix + strings.Repeat(c, 40-len(prefix)) + ":1"
+}
+
+func writeHashFile(t *testing.T, lines []string, trailingNewline bool) *HashFile {
+	t.Helper()
+
+	content := strings.Join(lines, "\n")
+	if trailingNewline && len(lines) > 0 {
+		content += "\n"
+	}
+
+	path := filepath.Join(t.TempDir(), "hashes.txt")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := NewHashFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return h
+}
+
+func TestHashFileRange(t *testing.T) {
+	lines := []string{
+		hashLine("00000", "1"),
+		hashLine("0000A", "1"),
+		hashLine("1E4C9", "1"),
+		hashLine("1E4C9", "2"),
+		hashLine("1E4C9", "3"),
+		hashLine("1E4CA", "1"),
+		passwordHash + ":9545824",
+		hashLine("FFFFF", "F"),
+	}
+
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		{"00000", []string{strings.Repeat("1", 35)}},
+		{"0000A", []string{strings.Repeat("1", 35)}},
+		{"1E4C9", []string{strings.Repeat("1", 35), strings.Repeat("2", 35), strings.Repeat("3", 35)}},
+		{"5BAA6", []string{passwordHash[5:]}},
+		{"FFFFF", []string{strings.Repeat("F", 35)}},
+		{"00001", nil},
+		{"12345", nil},
+		{"FFFFE", nil},
+	}
+
+	for _, trailingNewline := range []bool{true, false} {
+		h := writeHashFile(t, lines, trailingNewline)
+
+		for _, tt := range tests {
+			got, err := h.Range(tt.prefix)
+			if err != nil {
+				t.Fatalf("Range(%q): %v", tt.prefix, err)
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Range(%q) with trailing newline %v = %v, want %v", tt.prefix, trailingNewline, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestHashFileRangeEmpty(t *testing.T) {
+	h := writeHashFile(t, nil, false)
+
+	got, err := h.Range("00000")
+	if err != nil || got != nil {
+		t.Errorf("Range of an empty file = %v, %v, want nil, nil", got, err)
+	}
+}
+
+func TestHashFileIsBreached(t *testing.T) {
+	h := writeHashFile(t, []string{
+		hashLine("00000", "1"),
+		passwordHash + ":9545824",
+		hashLine("FFFFF", "F"),
+	}, true)
+
+	tests := []struct {
+		password string
+		want     bool
+	}{
+		{"password", true},
+		{"correct horse battery staple", false},
+	}
+
+	for _, tt := range tests {
+		got, err := h.IsBreached(tt.password)
+		if err != nil {
+			t.Fatalf("IsBreached(%q): %v", tt.password, err)
+		}
+
+		if got != tt.want {
+			t.Errorf("IsBreached(%q) = %v, want %v", tt.password, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package password
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	ErrTooShort        = errors.New("password is too short")
+	ErrTooLong         = errors.New("password is too long")
+	ErrTooFewClasses   = errors.New("password doesn't mix enough kinds of characters")
+	ErrBannedSubstring = errors.New("password contains a banned word")
+	ErrTooPredictable  = errors.New("password is too easy to guess")
+	ErrBreached        = errors.New("password has appeared in a data breach")
+)
+
+// PolicyError is returned by Policy.Check, Reason is one of the errors above
+// and Message tells the user what to change.
+type PolicyError struct {
+	Reason  error
+	Message string
+}
+
+func (e *PolicyError) Error() string {
+	return e.Message
+}
+
+func (e *PolicyError) Unwrap() error {
+	return e.Reason
+}
+
+// BreachedChecker tells whether a password appeared in a data breach.
+type BreachedChecker interface {
+	IsBreached(password string) (bool, error)
+}
+
+// Policy is what the passwords chosen on register, reset and change must
+// follow, the zero values turn a rule off.
+type Policy struct {
+	MinLength int
+	// MaxLength is in bytes, bcrypt ignores everything after 72.
+	MaxLength int
+	// MinClasses is how many of lowercase letters, uppercase letters,
+	// digits and symbols the password must mix.
+	MinClasses int
+	// MinEntropy is the minimum estimated strength in bits, see Entropy.
+	MinEntropy float64
+	// Banned are substrings no password may contain, e.g. the name of the
+	// app, the email and name of the user are always banned.
+	Banned   []string
+	Breached BreachedChecker
+}
+
+// minBannedLength keeps short words of an email or name, e.g. "jo", from
+// rejecting most passwords.
+const minBannedLength = 3
+
+func DefaultPolicy() Policy {
+	return Policy{
+		MinLength:  8,
+		MaxLength:  72,
+		MinClasses: 1,
+		MinEntropy: 30,
+	}
+}
+
+// NewPolicyFromEnv is DefaultPolicy changed by PASSWORD_MIN_LENGTH,
+// PASSWORD_MAX_LENGTH, PASSWORD_MIN_CLASSES, PASSWORD_MIN_ENTROPY and
+// PASSWORD_BANNED, a comma separated list. PASSWORD_BREACHED_FILE turns on
+// the breached password check, see HashFile.
+func NewPolicyFromEnv() (Policy, error) {
+	p := DefaultPolicy()
+
+	ints := map[string]*int{
+		"PASSWORD_MIN_LENGTH":  &p.MinLength,
+		"PASSWORD_MAX_LENGTH":  &p.MaxLength,
+		"PASSWORD_MIN_CLASSES": &p.MinClasses,
+	}
+
+	for name, field := range ints {
+		v := os.Getenv(name)
+		if v == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return Policy{}, fmt.Errorf("%s must be a positive number", name)
+		}
+		*field = n
+	}
+
+	if v := os.Getenv("PASSWORD_MIN_ENTROPY"); v != "" {
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil || n < 0 {
+			return Policy{}, errors.New("PASSWORD_MIN_ENTROPY must be a positive number")
+		}
+		p.MinEntropy = n
+	}
+
+	if p.MaxLength > 0 && p.MaxLength < p.MinLength {
+		return Policy{}, errors.New("PASSWORD_MAX_LENGTH is less than PASSWORD_MIN_LENGTH")
+	}
+
+	for _, b := range strings.Split(os.Getenv("PASSWORD_BANNED"), ",") {
+		if b = strings.TrimSpace(b); b != "" {
+			p.Banned = append(p.Banned, b)
+		}
+	}
+
+	if path := os.Getenv("PASSWORD_BREACHED_FILE"); path != "" {
+		f, err := NewHashFile(path)
+		if err != nil {
+			return Policy{}, err
+		}
+		p.Breached = f
+	}
+
+	return p, nil
+}
+
+// Check returns a PolicyError for the first rule password breaks. personal
+// is what password may not contain besides Banned, e.g. the email and name
+// of the user. A breached check that fails is only logged so that the
+// password can still be changed.
+func (p Policy) Check(password string, personal ...string) error {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return &PolicyError{ErrTooShort, fmt.Sprintf("Use at least %d characters", p.MinLength)}
+	}
+
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		return &PolicyError{ErrTooLong, fmt.Sprintf("Use at most %d characters", p.MaxLength)}
+	}
+
+	if classesOf(password).count() < p.MinClasses {
+		return &PolicyError{
+			ErrTooFewClasses,
+			fmt.Sprintf("Mix at least %d of lowercase letters, uppercase letters, digits and symbols", p.MinClasses),
+		}
+	}
+
+	lower := strings.ToLower(password)
+	for _, b := range append(bannedParts(personal), p.Banned...) {
+		if strings.Contains(lower, strings.ToLower(b)) {
+			return &PolicyError{ErrBannedSubstring, fmt.Sprintf("Don't use %q in your password", b)}
+		}
+	}
+
+	if Entropy(password) < p.MinEntropy {
+		return &PolicyError{ErrTooPredictable, "Make it longer or less predictable"}
+	}
+
+	if p.Breached != nil {
+		breached, err := p.Breached.IsBreached(password)
+		if err != nil {
+			log.Println("PasswordPolicy Check IsBreached:", err)
+		}
+
+		if breached {
+			return &PolicyError{ErrBreached, "This password has appeared in a data breach, choose another one"}
+		}
+	}
+
+	return nil
+}
+
+// Entropy is a rough estimate of the strength of password in bits, the
+// size of the alphabet of its classes for each character. A character
+// repeating the previous one adds nothing, so "aaaaaaaa" is weak.
+func Entropy(password string) float64 {
+	pool := classesOf(password).poolSize()
+	if pool == 0 {
+		return 0
+	}
+
+	n := 0
+	var previous rune
+	for i, r := range []rune(password) {
+		if i == 0 || r != previous {
+			n++
+		}
+		previous = r
+	}
+
+	return float64(n) * math.Log2(float64(pool))
+}
+
+// helpers
+// charClasses are the kinds of characters a password uses.
+type charClasses struct {
+	lower, upper, digit, symbol, other bool
+}
+
+func classesOf(password string) charClasses {
+	c := charClasses{}
+
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			c.lower = true
+		case r >= 'A' && r <= 'Z':
+			c.upper = true
+		case r >= '0' && r <= '9':
+			c.digit = true
+		case r < utf8.RuneSelf:
+			c.symbol = true
+		default:
+			c.other = true
+		}
+	}
+
+	return c
+}
+
+// count doesn't include other, letters of other alphabets mostly stand for
+// lowercase or uppercase letters.
+func (c charClasses) count() int {
+	n := 0
+	for _, used := range []bool{c.lower, c.upper, c.digit, c.symbol} {
+		if used {
+			n++
+		}
+	}
+
+	return n
+}
+
+// poolSize is the number of characters of the classes, other is a guess.
+func (c charClasses) poolSize() int {
+	n := 0
+	if c.lower {
+		n += 26
+	}
+	if c.upper {
+		n += 26
+	}
+	if c.digit {
+		n += 10
+	}
+	if c.symbol {
+		n += 33
+	}
+	if c.other {
+		n += 100
+	}
+
+	return n
+}
+
+// bannedParts is personal along with the words of the names and of the
+// part of the emails before the @, e.g. "jane.doe@example.com" also bans
+// "jane" and "doe".
+func bannedParts(personal []string) []string {
+	var parts []string
+
+	for _, p := range personal {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+
+		parts = append(parts, p)
+
+		local, _, _ := strings.Cut(p, "@")
+		words := strings.FieldsFunc(local, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+
+		for _, w := range words {
+			if utf8.RuneCountInString(w) >= minBannedLength {
+				parts = append(parts, w)
+			}
+		}
+	}
+
+	return parts
+}
@@ -0,0 +1,85 @@
+package password
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+type fakeBreached struct {
+	breached bool
+	err      error
+}
+
+func (f fakeBreached) IsBreached(password string) (bool, error) {
+	return f.breached, f.err
+}
+
+func TestPolicyCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   Policy
+		password string
+		personal []string
+		want     error
+	}{
+		{"valid", DefaultPolicy(), "correcthorse", nil, nil},
+		{"too short", DefaultPolicy(), "short", nil, ErrTooShort},
+		{"length counts characters", DefaultPolicy(), "ééééééé", nil, ErrTooShort},
+		{"too long", DefaultPolicy(), strings.Repeat("ab", 37), nil, ErrTooLong},
+		{"no max length", Policy{}, strings.Repeat("ab", 100), nil, nil},
+		{"too few classes", Policy{MinClasses: 3}, "correcthorse", nil, ErrTooFewClasses},
+		{"enough classes", Policy{MinClasses: 3}, "Correct1horse", nil, nil},
+		{"banned", Policy{Banned: []string{"Demo"}}, "mydemopassword", nil, ErrBannedSubstring},
+		{"email", DefaultPolicy(), "my jane.doe@example.com!", []string{"jane.doe@example.com"}, ErrBannedSubstring},
+		{"word of the email", DefaultPolicy(), "janeisgreat42", []string{"jane.doe@example.com"}, ErrBannedSubstring},
+		{"short words aren't banned", DefaultPolicy(), "jolishorse42", []string{"Jo Li"}, nil},
+		{"too predictable", DefaultPolicy(), "aaaaaaaaaaaa", nil, ErrTooPredictable},
+		{"breached", Policy{Breached: fakeBreached{breached: true}}, "password", nil, ErrBreached},
+		{"breached check failing", Policy{Breached: fakeBreached{err: errors.New("down")}}, "password", nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Check(tt.password, tt.personal...)
+
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("Check(%q) = %v, want nil", tt.password, err)
+				}
+				return
+			}
+
+			var policyErr *PolicyError
+			if !errors.As(err, &policyErr) || !errors.Is(err, tt.want) {
+				t.Fatalf("Check(%q) = %v, want a PolicyError for %v", tt.password, err, tt.want)
+			}
+			if policyErr.Message == "" {
+				t.Errorf("Check(%q) has no message", tt.password)
+			}
+		})
+	}
+}
+
+func TestEntropy(t *testing.T) {
+	tests := []struct {
+		password string
+		want     float64
+	}{
+		{"", 0},
+		{"a", math.Log2(26)},
+		{"aaaaaaaa", math.Log2(26)},
+		{"abcdefgh", 8 * math.Log2(26)},
+		{"abab", 4 * math.Log2(26)},
+		{"aA1!", 4 * math.Log2(95)},
+		{"1234", 4 * math.Log2(10)},
+		{"éa", 2 * math.Log2(126)},
+	}
+
+	for _, tt := range tests {
+		if got := Entropy(tt.password); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Entropy(%q) = %v, want %v", tt.password, got, tt.want)
+		}
+	}
+}
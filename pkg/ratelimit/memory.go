@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+	limit     Limit
+}
+
+// MemoryStore keeps the buckets in the process.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	sweptAt time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: map[string]*bucket{},
+		sweptAt: time.Now(),
+	}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, l Limit) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	if now.Sub(s.sweptAt) > sweepInterval {
+		s.sweep(now)
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.Burst), updatedAt: now}
+		s.buckets[key] = b
+	}
+
+	b.limit = l
+	b.tokens = refill(b.tokens, now.Sub(b.updatedAt), l)
+	b.updatedAt = now
+
+	if b.tokens < 1 {
+		return false, RetryAfter(b.tokens, l), nil
+	}
+
+	b.tokens--
+
+	return true, 0, nil
+}
+
+// sweep forgets the buckets that are full again, they are the same as
+// buckets that don't exist.
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		if refill(b.tokens, now.Sub(b.updatedAt), b.limit) >= float64(b.limit.Burst) {
+			delete(s.buckets, key)
+		}
+	}
+
+	s.sweptAt = now
+}
+
+// helpers
+func refill(tokens float64, elapsed time.Duration, l Limit) float64 {
+	return min(float64(l.Burst), tokens+elapsed.Seconds()*l.Rate)
+}
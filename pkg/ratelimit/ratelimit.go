@@ -0,0 +1,98 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit is a token bucket: it holds up to Burst tokens and gets Rate tokens
+// back per second, every request takes one.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Every allows n requests per period, all of them at once if they come in a burst.
+func Every(n int, period time.Duration) Limit {
+	return Limit{
+		Rate:  float64(n) / period.Seconds(),
+		Burst: n,
+	}
+}
+
+// Store keeps the buckets. Take removes a token from the bucket of key and
+// returns how long to wait when it is empty.
+type Store interface {
+	Take(ctx context.Context, key string, l Limit) (bool, time.Duration, error)
+}
+
+type Limiter struct {
+	name  string
+	store Store
+	limit Limit
+}
+
+// New creates the limiter called name, its limit can be overridden with
+// RATE_LIMIT_<NAME>, e.g. RATE_LIMIT_LOGIN=10/1m.
+func New(name string, store Store, fallback Limit) *Limiter {
+	limit := fallback
+
+	envName := "RATE_LIMIT_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+	if v := os.Getenv(envName); v != "" {
+		l, err := ParseLimit(v)
+		if err != nil {
+			panic(fmt.Sprintf("invalid %s: %s", envName, err))
+		}
+		limit = l
+	}
+
+	return &Limiter{
+		name:  name,
+		store: store,
+		limit: limit,
+	}
+}
+
+// Allow takes a token for key, keys are scoped to the limiter.
+func (l *Limiter) Allow(ctx context.Context, key string) (bool, time.Duration, error) {
+	return l.store.Take(ctx, l.name+":"+key, l.limit)
+}
+
+// RetryAfter is how long a bucket with tokens left takes to get a whole one back.
+func RetryAfter(tokens float64, l Limit) time.Duration {
+	return time.Duration((1 - tokens) / l.Rate * float64(time.Second))
+}
+
+// ParseLimit parses "<requests>/<period>", e.g. "5/15m".
+func ParseLimit(s string) (Limit, error) {
+	n, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("%q is not <requests>/<period>", s)
+	}
+
+	requests, err := strconv.Atoi(n)
+	if err != nil || requests <= 0 {
+		return Limit{}, fmt.Errorf("%q is not a positive number of requests", n)
+	}
+
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("%q is not a positive duration", period)
+	}
+
+	return Every(requests, d), nil
+}
+
+// NewStoreFromEnv picks the store from RATE_LIMIT_STORE: postgres or memory.
+// memory is the default, it only works with a single server instance.
+func NewStoreFromEnv(postgres Store) Store {
+	if os.Getenv("RATE_LIMIT_STORE") == "postgres" {
+		return postgres
+	}
+
+	return NewMemoryStore()
+}
@@ -0,0 +1,138 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRefill(t *testing.T) {
+	l := Every(10, 10*time.Second)
+
+	tests := []struct {
+		name    string
+		tokens  float64
+		elapsed time.Duration
+		want    float64
+	}{
+		{"no time passed", 2, 0, 2},
+		{"one token back per second", 2, time.Second, 3},
+		{"partial tokens", 0, 500 * time.Millisecond, 0.5},
+		{"capped at the burst", 9, time.Hour, 10},
+		{"from empty to full", 0, 10 * time.Second, 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := refill(tt.tokens, tt.elapsed, l); got != tt.want {
+				t.Errorf("refill(%v, %v) = %v, want %v", tt.tokens, tt.elapsed, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	l := Every(4, time.Minute)
+
+	tests := []struct {
+		tokens float64
+		want   time.Duration
+	}{
+		{0, 15 * time.Second},
+		{0.5, 7500 * time.Millisecond},
+		{0.75, 3750 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		if got := RetryAfter(tt.tokens, l); got != tt.want {
+			t.Errorf("RetryAfter(%v) = %v, want %v", tt.tokens, got, tt.want)
+		}
+	}
+}
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    Limit
+		wantErr bool
+	}{
+		{"5/15m", Every(5, 15*time.Minute), false},
+		{"10/1s", Limit{Rate: 10, Burst: 10}, false},
+		{"1/1h", Every(1, time.Hour), false},
+		{"5", Limit{}, true},
+		{"x/1m", Limit{}, true},
+		{"0/1m", Limit{}, true},
+		{"-1/1m", Limit{}, true},
+		{"5/soon", Limit{}, true},
+		{"5/0s", Limit{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := ParseLimit(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLimit(%q) error = %v, want error %v", tt.s, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseLimit(%q) = %+v, want %+v", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreTake(t *testing.T) {
+	ctx := context.Background()
+	l := Every(3, time.Minute)
+	s := NewMemoryStore()
+
+	for i := 0; i < 3; i++ {
+		if ok, _, _ := s.Take(ctx, "a", l); !ok {
+			t.Fatalf("request %d of the burst was denied", i+1)
+		}
+	}
+
+	ok, retryAfter, err := s.Take(ctx, "a", l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("the request after the burst was allowed")
+	}
+	if retryAfter <= 0 || retryAfter > 20*time.Second {
+		t.Errorf("retryAfter = %v, want at most 20s", retryAfter)
+	}
+
+	if ok, _, _ := s.Take(ctx, "b", l); !ok {
+		t.Error("the bucket of another key was emptied")
+	}
+
+	// a token comes back every 20 seconds
+	s.buckets["a"].updatedAt = s.buckets["a"].updatedAt.Add(-20 * time.Second)
+
+	if ok, _, _ := s.Take(ctx, "a", l); !ok {
+		t.Error("the refilled token was denied")
+	}
+	if ok, _, _ := s.Take(ctx, "a", l); ok {
+		t.Error("more than the refilled token was allowed")
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	ctx := context.Background()
+	l := Every(2, time.Minute)
+	s := NewMemoryStore()
+
+	s.Take(ctx, "full", l)
+	s.Take(ctx, "empty", l)
+	s.Take(ctx, "empty", l)
+
+	s.buckets["full"].updatedAt = s.buckets["full"].updatedAt.Add(-time.Minute)
+	s.sweep(time.Now())
+
+	if _, ok := s.buckets["full"]; ok {
+		t.Error("the full bucket wasn't swept")
+	}
+	if _, ok := s.buckets["empty"]; !ok {
+		t.Error("the empty bucket was swept")
+	}
+}
@@ -0,0 +1,235 @@
+package rbac
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/cativovo/go-demo-auth/pkg/user"
+)
+
+var (
+	ErrSomethingWentWrong = errors.New("something went wrong")
+	ErrUnknownRole        = errors.New("unknown role")
+	ErrLastAdmin          = errors.New("the last administrator can't lose the admin role")
+)
+
+// The roles and permissions are seeded by the migrations, these are the ones
+// the code refers to.
+const (
+	RoleAdmin   = "admin"
+	RoleSupport = "support"
+
+	PermissionReadUsers          = "users:read"
+	PermissionManageUsers        = "users:manage"
+	PermissionManageRoles        = "roles:manage"
+	PermissionManageOAuthClients = "oauth_clients:manage"
+	PermissionReadAuditLog       = "audit:read"
+)
+
+type Role struct {
+	Name        string
+	Description string
+	Permissions []string
+}
+
+// Access is what a user is allowed to do, the permissions are the ones of
+// all of their roles.
+type Access struct {
+	Roles       []string
+	Permissions []string
+}
+
+func (a Access) HasRole(role string) bool {
+	return slices.Contains(a.Roles, role)
+}
+
+func (a Access) HasPermission(permission string) bool {
+	return slices.Contains(a.Permissions, permission)
+}
+
+type Service interface {
+	GetAccess(ctx context.Context, userId string) (Access, error)
+	GetRoles(ctx context.Context) ([]Role, error)
+	AssignRole(ctx context.Context, userId, role string) error
+	// RemoveRole returns ErrLastAdmin instead of leaving nobody to manage
+	// the roles.
+	RemoveRole(ctx context.Context, userId, role string) error
+}
+
+type Repository interface {
+	GetRoles(ctx context.Context) ([]Role, error)
+	GetUserRoles(ctx context.Context, userId string) ([]string, error)
+	GetUserPermissions(ctx context.Context, userId string) ([]string, error)
+	AddUserRole(ctx context.Context, userId, role string) error
+	DeleteUserRole(ctx context.Context, userId, role string) (bool, error)
+	CountUsersWithRole(ctx context.Context, role string) (int, error)
+	GetUserById(ctx context.Context, id string) (user.User, error)
+}
+
+type service struct {
+	repository     Repository
+	bootstrapEmail string
+	// adminExists stops looking for the bootstrap admin once there is one
+	adminExists atomic.Bool
+}
+
+type Option func(*service)
+
+// WithBootstrapAdmin makes the user with email an administrator when they
+// show up while nobody is one yet. The email has to be verified so that it
+// can't be claimed by registering with it first.
+func WithBootstrapAdmin(email string) Option {
+	return func(s *service) {
+		s.bootstrapEmail = strings.ToLower(strings.TrimSpace(email))
+	}
+}
+
+func NewRBACService(r Repository, opts ...Option) Service {
+	s := &service{
+		repository: r,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+func (s *service) GetAccess(ctx context.Context, userId string) (Access, error) {
+	s.bootstrap(ctx, userId)
+
+	roles, err := s.repository.GetUserRoles(ctx, userId)
+	if err != nil {
+		log.Println("RBACService GetAccess GetUserRoles:", err)
+		return Access{}, ErrSomethingWentWrong
+	}
+
+	if len(roles) == 0 {
+		return Access{}, nil
+	}
+
+	permissions, err := s.repository.GetUserPermissions(ctx, userId)
+	if err != nil {
+		log.Println("RBACService GetAccess GetUserPermissions:", err)
+		return Access{}, ErrSomethingWentWrong
+	}
+
+	return Access{
+			Roles:       roles,
+			Permissions: permissions,
+		},
+		nil
+}
+
+func (s *service) GetRoles(ctx context.Context) ([]Role, error) {
+	roles, err := s.repository.GetRoles(ctx)
+	if err != nil {
+		log.Println("RBACService GetRoles GetRoles:", err)
+		return nil, ErrSomethingWentWrong
+	}
+
+	return roles, nil
+}
+
+func (s *service) AssignRole(ctx context.Context, userId, role string) error {
+	if err := s.checkRole(ctx, role); err != nil {
+		return err
+	}
+
+	if _, err := s.repository.GetUserById(ctx, userId); err != nil {
+		return user.ErrUserNotFound
+	}
+
+	if err := s.repository.AddUserRole(ctx, userId, role); err != nil {
+		log.Println("RBACService AssignRole AddUserRole:", err)
+		return ErrSomethingWentWrong
+	}
+
+	return nil
+}
+
+func (s *service) RemoveRole(ctx context.Context, userId, role string) error {
+	if err := s.checkRole(ctx, role); err != nil {
+		return err
+	}
+
+	if role == RoleAdmin {
+		count, err := s.repository.CountUsersWithRole(ctx, RoleAdmin)
+		if err != nil {
+			log.Println("RBACService RemoveRole CountUsersWithRole:", err)
+			return ErrSomethingWentWrong
+		}
+
+		if count <= 1 {
+			roles, err := s.repository.GetUserRoles(ctx, userId)
+			if err != nil {
+				log.Println("RBACService RemoveRole GetUserRoles:", err)
+				return ErrSomethingWentWrong
+			}
+
+			if slices.Contains(roles, RoleAdmin) {
+				return ErrLastAdmin
+			}
+		}
+	}
+
+	if _, err := s.repository.DeleteUserRole(ctx, userId, role); err != nil {
+		log.Println("RBACService RemoveRole DeleteUserRole:", err)
+		return ErrSomethingWentWrong
+	}
+
+	return nil
+}
+
+// helpers
+func (s *service) checkRole(ctx context.Context, role string) error {
+	roles, err := s.GetRoles(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range roles {
+		if r.Name == role {
+			return nil
+		}
+	}
+
+	return ErrUnknownRole
+}
+
+// bootstrap grants the admin role to userId if they own the bootstrap email
+// and there is no administrator yet.
+func (s *service) bootstrap(ctx context.Context, userId string) {
+	if s.bootstrapEmail == "" || s.adminExists.Load() {
+		return
+	}
+
+	count, err := s.repository.CountUsersWithRole(ctx, RoleAdmin)
+	if err != nil {
+		log.Println("RBACService bootstrap CountUsersWithRole:", err)
+		return
+	}
+
+	if count > 0 {
+		s.adminExists.Store(true)
+		return
+	}
+
+	u, err := s.repository.GetUserById(ctx, userId)
+	if err != nil || u.VerifiedAt == nil || strings.ToLower(u.Email) != s.bootstrapEmail {
+		return
+	}
+
+	if err := s.repository.AddUserRole(ctx, userId, RoleAdmin); err != nil {
+		log.Println("RBACService bootstrap AddUserRole:", err)
+		return
+	}
+
+	log.Println("RBACService bootstrap: granted the admin role to", u.Email)
+	s.adminExists.Store(true)
+}
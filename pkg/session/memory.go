@@ -0,0 +1,87 @@
+package session
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cativovo/go-demo-auth/pkg/auth"
+)
+
+const sweepInterval = time.Minute
+
+// MemoryStore keeps the sessions in the process.
+type MemoryStore struct {
+	mu       sync.Mutex
+	sessions map[string]Session
+	sweptAt  time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		sessions: map[string]Session{},
+		sweptAt:  time.Now(),
+	}
+}
+
+func (s *MemoryStore) Create(ctx context.Context, idHash string, session Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(time.Now())
+	s.sessions[idHash] = session
+
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, idHash string) (Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[idHash]
+	if !ok || !time.Now().Before(session.ExpiresAt) {
+		return Session{}, ErrNotFound
+	}
+
+	return session, nil
+}
+
+func (s *MemoryStore) UpdateToken(ctx context.Context, idHash string, t auth.Token, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[idHash]
+	if !ok {
+		return ErrNotFound
+	}
+
+	session.Token = t
+	session.ExpiresAt = expiresAt
+	s.sessions[idHash] = session
+
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, idHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, idHash)
+
+	return nil
+}
+
+// sweep forgets the expired sessions.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.sweptAt) < sweepInterval {
+		return
+	}
+
+	for idHash, session := range s.sessions {
+		if !now.Before(session.ExpiresAt) {
+			delete(s.sessions, idHash)
+		}
+	}
+
+	s.sweptAt = now
+}
@@ -0,0 +1,116 @@
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/cativovo/go-demo-auth/pkg/auth"
+)
+
+// Lifetime is how long a session lasts without being used, it is extended
+// every time the provider tokens are refreshed.
+const Lifetime = 30 * 24 * time.Hour
+
+var ErrNotFound = errors.New("session not found")
+
+// Session is what the session cookie stands for, the provider tokens never
+// leave the server.
+type Session struct {
+	UserId    string
+	Token     auth.Token
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// Store keeps the sessions by the hash of their id, so reading the store
+// isn't enough to hijack them.
+type Store interface {
+	Create(ctx context.Context, idHash string, s Session) error
+	// Get returns ErrNotFound for unknown and expired sessions.
+	Get(ctx context.Context, idHash string) (Session, error)
+	UpdateToken(ctx context.Context, idHash string, t auth.Token, expiresAt time.Time) error
+	Delete(ctx context.Context, idHash string) error
+}
+
+// Manager hands out the opaque session ids stored in the cookie.
+type Manager struct {
+	store Store
+}
+
+func NewManager(s Store) *Manager {
+	return &Manager{
+		store: s,
+	}
+}
+
+// NewStoreFromEnv picks the store from SESSION_STORE: postgres or memory.
+// postgres is the default, memory signs everyone out when the server
+// restarts and only works with a single server instance.
+func NewStoreFromEnv(postgres Store) Store {
+	if os.Getenv("SESSION_STORE") == "memory" {
+		return NewMemoryStore()
+	}
+
+	return postgres
+}
+
+// Start stores t and returns the id of the new session.
+func (m *Manager) Start(ctx context.Context, t auth.Token) (string, error) {
+	id, err := randomId()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+
+	s := Session{
+		UserId:    t.UserId,
+		Token:     t,
+		CreatedAt: now,
+		ExpiresAt: now.Add(Lifetime),
+	}
+
+	if err := m.store.Create(ctx, hashId(id), s); err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+func (m *Manager) Get(ctx context.Context, id string) (Session, error) {
+	if id == "" {
+		return Session{}, ErrNotFound
+	}
+
+	return m.store.Get(ctx, hashId(id))
+}
+
+// UpdateToken replaces the tokens of the session after a refresh.
+func (m *Manager) UpdateToken(ctx context.Context, id string, t auth.Token) error {
+	return m.store.UpdateToken(ctx, hashId(id), t, time.Now().Add(Lifetime))
+}
+
+func (m *Manager) End(ctx context.Context, id string) error {
+	return m.store.Delete(ctx, hashId(id))
+}
+
+// helpers
+func randomId() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashId(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,80 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/cativovo/go-demo-auth/pkg/auth"
+	postgres "github.com/cativovo/go-demo-auth/pkg/storage/postgres/sqlc_generated"
+)
+
+func (r *PostgresRepository) AddAPIToken(ctx context.Context, t auth.APIToken, tokenHash string) (auth.APIToken, error) {
+	p := postgres.AddAPITokenParams{
+		UserID:    t.UserId,
+		Name:      t.Name,
+		TokenHash: tokenHash,
+		Scopes:    t.Scopes,
+		ExpiresAt: t.ExpiresAt,
+	}
+
+	row, err := r.queries.AddAPIToken(ctx, p)
+	if err != nil {
+		return auth.APIToken{}, err
+	}
+
+	return toAPIToken(row), nil
+}
+
+func (r *PostgresRepository) GetAPITokenByHash(ctx context.Context, tokenHash string) (auth.APIToken, error) {
+	row, err := r.queries.GetAPITokenByHash(ctx, tokenHash)
+	if err != nil {
+		return auth.APIToken{}, err
+	}
+
+	return toAPIToken(row), nil
+}
+
+func (r *PostgresRepository) GetAPITokensByUserId(ctx context.Context, userId string) ([]auth.APIToken, error) {
+	rows, err := r.queries.GetAPITokensByUserId(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := make([]auth.APIToken, 0, len(rows))
+
+	for _, row := range rows {
+		tokens = append(tokens, toAPIToken(row))
+	}
+
+	return tokens, nil
+}
+
+func (r *PostgresRepository) UpdateAPITokenLastUsed(ctx context.Context, id string) error {
+	return r.queries.UpdateAPITokenLastUsed(ctx, id)
+}
+
+func (r *PostgresRepository) DeleteAPIToken(ctx context.Context, userId, id string) (bool, error) {
+	p := postgres.DeleteAPITokenParams{
+		ID:     id,
+		UserID: userId,
+	}
+
+	n, err := r.queries.DeleteAPIToken(ctx, p)
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+// helpers
+func toAPIToken(t postgres.ApiToken) auth.APIToken {
+	return auth.APIToken{
+		Id:         t.ID,
+		UserId:     t.UserID,
+		Name:       t.Name,
+		Scopes:     t.Scopes,
+		CreatedAt:  t.CreatedAt,
+		ExpiresAt:  t.ExpiresAt,
+		LastUsedAt: t.LastUsedAt,
+	}
+}
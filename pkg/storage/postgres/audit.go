@@ -0,0 +1,92 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/cativovo/go-demo-auth/pkg/audit"
+	postgres "github.com/cativovo/go-demo-auth/pkg/storage/postgres/sqlc_generated"
+)
+
+func (r *PostgresRepository) AddAuditEvent(ctx context.Context, e audit.Event) error {
+	p := postgres.AddAuditEventParams{
+		UserID:    e.UserId,
+		Email:     e.Email,
+		Action:    e.Action,
+		Outcome:   e.Outcome,
+		Detail:    e.Detail,
+		Ip:        e.IP,
+		UserAgent: e.UserAgent,
+	}
+
+	return r.queries.AddAuditEvent(ctx, p)
+}
+
+func (r *PostgresRepository) GetAuditEventsByUser(ctx context.Context, userId, email string, limit int) ([]audit.Event, error) {
+	p := postgres.GetAuditEventsByUserParams{
+		UserID:   userId,
+		Email:    email,
+		PageSize: int32(limit),
+	}
+
+	rows, err := r.queries.GetAuditEventsByUser(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	return toAuditEvents(rows), nil
+}
+
+func (r *PostgresRepository) SearchAuditEvents(ctx context.Context, f audit.Filter, limit, offset int) ([]audit.Event, int, error) {
+	p := postgres.SearchAuditEventsParams{
+		UserID:     f.UserId,
+		Email:      f.Email,
+		Action:     f.Action,
+		Outcome:    f.Outcome,
+		Ip:         f.IP,
+		Since:      f.Since,
+		Until:      f.Until,
+		PageSize:   int32(limit),
+		PageOffset: int32(offset),
+	}
+
+	rows, err := r.queries.SearchAuditEvents(ctx, p)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total, err := r.queries.CountAuditEvents(ctx, postgres.CountAuditEventsParams{
+		UserID:  f.UserId,
+		Email:   f.Email,
+		Action:  f.Action,
+		Outcome: f.Outcome,
+		Ip:      f.IP,
+		Since:   f.Since,
+		Until:   f.Until,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return toAuditEvents(rows), int(total), nil
+}
+
+// helpers
+func toAuditEvents(rows []postgres.AuditEvent) []audit.Event {
+	events := make([]audit.Event, 0, len(rows))
+
+	for _, row := range rows {
+		events = append(events, audit.Event{
+			Id:        row.ID,
+			UserId:    row.UserID,
+			Email:     row.Email,
+			Action:    row.Action,
+			Outcome:   row.Outcome,
+			Detail:    row.Detail,
+			IP:        row.Ip,
+			UserAgent: row.UserAgent,
+			CreatedAt: row.CreatedAt,
+		})
+	}
+
+	return events
+}
@@ -0,0 +1,116 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/cativovo/go-demo-auth/pkg/auth"
+	"github.com/cativovo/go-demo-auth/pkg/session"
+	postgres "github.com/cativovo/go-demo-auth/pkg/storage/postgres/sqlc_generated"
+	"github.com/jackc/pgx/v5"
+)
+
+// SessionStore shares the sessions behind the session cookie between
+// server instances and restarts.
+type SessionStore struct {
+	queries *postgres.Queries
+
+	mu      sync.Mutex
+	sweptAt time.Time
+}
+
+func NewSessionStore(r *PostgresRepository) *SessionStore {
+	return &SessionStore{
+		queries: r.queries,
+		sweptAt: time.Now(),
+	}
+}
+
+func (s *SessionStore) Create(ctx context.Context, idHash string, ss session.Session) error {
+	s.sweep(ctx)
+
+	token, err := json.Marshal(ss.Token)
+	if err != nil {
+		return err
+	}
+
+	p := postgres.AddBrowserSessionParams{
+		IDHash:    idHash,
+		UserID:    ss.UserId,
+		Token:     token,
+		CreatedAt: ss.CreatedAt,
+		ExpiresAt: ss.ExpiresAt,
+	}
+
+	return s.queries.AddBrowserSession(ctx, p)
+}
+
+func (s *SessionStore) Get(ctx context.Context, idHash string) (session.Session, error) {
+	row, err := s.queries.GetBrowserSession(ctx, idHash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return session.Session{}, session.ErrNotFound
+	}
+	if err != nil {
+		return session.Session{}, err
+	}
+
+	t := auth.Token{}
+	if err := json.Unmarshal(row.Token, &t); err != nil {
+		return session.Session{}, err
+	}
+
+	return session.Session{
+			UserId:    row.UserID,
+			Token:     t,
+			CreatedAt: row.CreatedAt,
+			ExpiresAt: row.ExpiresAt,
+		},
+		nil
+}
+
+func (s *SessionStore) UpdateToken(ctx context.Context, idHash string, t auth.Token, expiresAt time.Time) error {
+	token, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+
+	p := postgres.UpdateBrowserSessionTokenParams{
+		IDHash:    idHash,
+		Token:     token,
+		ExpiresAt: expiresAt,
+	}
+
+	n, err := s.queries.UpdateBrowserSessionToken(ctx, p)
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return session.ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *SessionStore) Delete(ctx context.Context, idHash string) error {
+	return s.queries.DeleteBrowserSession(ctx, idHash)
+}
+
+// helpers
+func (s *SessionStore) sweep(ctx context.Context) {
+	s.mu.Lock()
+	if time.Since(s.sweptAt) < time.Hour {
+		s.mu.Unlock()
+		return
+	}
+	s.sweptAt = time.Now()
+	s.mu.Unlock()
+
+	if err := s.queries.DeleteExpiredBrowserSessions(ctx); err != nil {
+		log.Println("SessionStore sweep DeleteExpiredBrowserSessions:", err)
+	}
+}
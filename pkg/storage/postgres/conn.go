@@ -0,0 +1,74 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// queryTimeout bounds every query on top of the deadline of the caller, so a
+// stuck query can't hold a request forever.
+const queryTimeout = 5 * time.Second
+
+// timeoutConn is the postgres.DBTX of the generated queries, it gives each
+// query its own deadline. The context of a query is only canceled once its
+// rows have been read.
+type timeoutConn struct {
+	conn    *pgx.Conn
+	timeout time.Duration
+}
+
+func newTimeoutConn(conn *pgx.Conn, timeout time.Duration) *timeoutConn {
+	return &timeoutConn{
+		conn:    conn,
+		timeout: timeout,
+	}
+}
+
+func (c *timeoutConn) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	return c.conn.Exec(ctx, sql, args...)
+}
+
+func (c *timeoutConn) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+
+	rows, err := c.conn.Query(ctx, sql, args...)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return &timeoutRows{rows, cancel}, nil
+}
+
+func (c *timeoutConn) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+
+	return &timeoutRow{c.conn.QueryRow(ctx, sql, args...), cancel}
+}
+
+type timeoutRows struct {
+	pgx.Rows
+	cancel context.CancelFunc
+}
+
+func (r *timeoutRows) Close() {
+	r.Rows.Close()
+	r.cancel()
+}
+
+type timeoutRow struct {
+	row    pgx.Row
+	cancel context.CancelFunc
+}
+
+func (r *timeoutRow) Scan(dest ...any) error {
+	defer r.cancel()
+
+	return r.row.Scan(dest...)
+}
@@ -0,0 +1,79 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/cativovo/go-demo-auth/pkg/idp"
+	postgres "github.com/cativovo/go-demo-auth/pkg/storage/postgres/sqlc_generated"
+)
+
+func (r *PostgresRepository) GetOAuthClient(ctx context.Context, id string) (idp.Client, error) {
+	c, err := r.queries.GetOAuthClient(ctx, id)
+	if err != nil {
+		return idp.Client{}, err
+	}
+
+	return idp.Client{
+		Id:           c.ID,
+		Name:         c.Name,
+		SecretHash:   c.SecretHash,
+		RedirectURIs: c.RedirectUris,
+	}, nil
+}
+
+func (r *PostgresRepository) AddAuthorizationCode(ctx context.Context, c idp.AuthorizationCode) error {
+	p := postgres.AddAuthorizationCodeParams{
+		CodeHash:      c.CodeHash,
+		ClientID:      c.ClientId,
+		UserID:        c.UserId,
+		RedirectUri:   c.RedirectURI,
+		Scope:         c.Scope,
+		Nonce:         c.Nonce,
+		CodeChallenge: c.CodeChallenge,
+		ExpiresAt:     c.ExpiresAt,
+	}
+
+	return r.queries.AddAuthorizationCode(ctx, p)
+}
+
+func (r *PostgresRepository) TakeAuthorizationCode(ctx context.Context, codeHash string) (idp.AuthorizationCode, error) {
+	c, err := r.queries.TakeAuthorizationCode(ctx, codeHash)
+	if err != nil {
+		return idp.AuthorizationCode{}, err
+	}
+
+	return idp.AuthorizationCode{
+		CodeHash:      c.CodeHash,
+		ClientId:      c.ClientID,
+		UserId:        c.UserID,
+		RedirectURI:   c.RedirectUri,
+		Scope:         c.Scope,
+		Nonce:         c.Nonce,
+		CodeChallenge: c.CodeChallenge,
+		ExpiresAt:     c.ExpiresAt,
+	}, nil
+}
+
+func (r *PostgresRepository) GetConsentScope(ctx context.Context, userId, clientId string) (string, error) {
+	p := postgres.GetConsentParams{
+		UserID:   userId,
+		ClientID: clientId,
+	}
+
+	c, err := r.queries.GetConsent(ctx, p)
+	if err != nil {
+		return "", err
+	}
+
+	return c.Scope, nil
+}
+
+func (r *PostgresRepository) SaveConsent(ctx context.Context, userId, clientId, scope string) error {
+	p := postgres.SaveConsentParams{
+		UserID:   userId,
+		ClientID: clientId,
+		Scope:    scope,
+	}
+
+	return r.queries.SaveConsent(ctx, p)
+}
@@ -0,0 +1,662 @@
+package postgres
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/cativovo/go-demo-auth/pkg/auth"
+	"github.com/cativovo/go-demo-auth/pkg/mail"
+	postgres "github.com/cativovo/go-demo-auth/pkg/storage/postgres/sqlc_generated"
+	"github.com/cativovo/go-demo-auth/pkg/user"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	accessTokenLifetime   = time.Hour
+	refreshTokenLifetime  = 30 * 24 * time.Hour
+	magicLinkLifetime     = 15 * time.Minute
+	passwordResetLifetime = time.Hour
+	verificationLifetime  = 24 * time.Hour
+	uniqueViolation       = "23505"
+
+	magicLinkPurpose     = "magic_link"
+	passwordResetPurpose = "password_reset"
+	verificationPurpose  = "email_verification"
+	emailChangePurpose   = "email_change"
+)
+
+// dummyHash is compared against when an email is unknown so that Login takes
+// as long as it does for a wrong password.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+// LocalAuthRepository is a first-party replacement for SupabaseRepository.
+// Passwords are stored as bcrypt hashes and access tokens are HS256 JWTs
+// bound to a row in local_sessions, so logging out revokes them immediately.
+type LocalAuthRepository struct {
+	queries   *postgres.Queries
+	mailer    mail.Mailer
+	appUrl    string
+	jwtSecret []byte
+	// requireVerification blocks logins until the email is confirmed,
+	// otherwise unverified users can log in and are reminded to confirm.
+	requireVerification bool
+}
+
+type localClaims struct {
+	SessionId string `json:"session_id"`
+	jwt.RegisteredClaims
+}
+
+func NewLocalAuthRepository(r *PostgresRepository, m mail.Mailer) *LocalAuthRepository {
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		log.Fatal("JWT_SECRET is required by the local auth provider")
+	}
+
+	appUrl := os.Getenv("APP_URL")
+	if appUrl == "" {
+		appUrl = "http://localhost:3000"
+	}
+
+	return &LocalAuthRepository{
+		queries:             r.queries,
+		mailer:              m,
+		appUrl:              appUrl,
+		jwtSecret:           []byte(secret),
+		requireVerification: os.Getenv("EMAIL_VERIFICATION") == "required",
+	}
+}
+
+func (r *LocalAuthRepository) Register(ctx context.Context, email, password string) (user.Registration, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Println("Local Register GenerateFromPassword:", err)
+		return user.Registration{}, auth.ErrSomethingWentWrong
+	}
+
+	p := postgres.AddLocalCredentialsParams{
+		Email:        email,
+		PasswordHash: string(hash),
+	}
+
+	c, err := r.queries.AddLocalCredentials(ctx, p)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return user.Registration{}, user.ErrEmailAlreadyUsed
+		}
+
+		log.Println("Local Register AddLocalCredentials:", err)
+		return user.Registration{}, auth.ErrSomethingWentWrong
+	}
+
+	if err := r.sendVerificationEmail(ctx, c.UserID, email); err != nil {
+		return user.Registration{}, err
+	}
+
+	registration := user.Registration{
+		UserId: c.UserID,
+	}
+
+	if r.requireVerification {
+		return registration, nil
+	}
+
+	registration.Token, err = r.newToken(ctx, c.UserID)
+	if err != nil {
+		return user.Registration{}, err
+	}
+
+	return registration, nil
+}
+
+// RegisterWithoutPassword creates credentials for a user who signed up
+// through an identity provider. The empty hash never matches a password,
+// one can be set later with a password reset.
+func (r *LocalAuthRepository) RegisterWithoutPassword(ctx context.Context, email string) (string, error) {
+	p := postgres.AddLocalCredentialsParams{
+		Email: email,
+	}
+
+	c, err := r.queries.AddLocalCredentials(ctx, p)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return "", user.ErrEmailAlreadyUsed
+		}
+
+		log.Println("Local RegisterWithoutPassword AddLocalCredentials:", err)
+		return "", auth.ErrSomethingWentWrong
+	}
+
+	return c.UserID, nil
+}
+
+func (r *LocalAuthRepository) Login(ctx context.Context, email, password string) (auth.Token, error) {
+	c, err := r.queries.GetLocalCredentialsByEmail(ctx, email)
+	if err != nil || c.PasswordHash == "" {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return auth.Token{}, auth.ErrInvalidCredentials
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(c.PasswordHash), []byte(password)); err != nil {
+		return auth.Token{}, auth.ErrInvalidCredentials
+	}
+
+	if r.requireVerification {
+		u, err := r.queries.GetUserById(ctx, c.UserID)
+		if err != nil {
+			log.Println("Local Login GetUserById:", err)
+			return auth.Token{}, auth.ErrSomethingWentWrong
+		}
+
+		if u.VerifiedAt == nil {
+			return auth.Token{}, auth.ErrEmailNotVerified
+		}
+	}
+
+	return r.newToken(ctx, c.UserID)
+}
+
+func (r *LocalAuthRepository) Logout(ctx context.Context, token string) error {
+	claims, err := r.parseAccessToken(token)
+	if err != nil {
+		return err
+	}
+
+	if err := r.queries.DeleteLocalSessionById(ctx, claims.SessionId); err != nil {
+		log.Println("Local Logout DeleteLocalSessionById:", err)
+		return auth.ErrSomethingWentWrong
+	}
+
+	return nil
+}
+
+func (r *LocalAuthRepository) LogoutSession(ctx context.Context, userId, sessionId string) error {
+	p := postgres.DeleteLocalSessionByIdAndUserIdParams{
+		ID:     sessionId,
+		UserID: userId,
+	}
+
+	if err := r.queries.DeleteLocalSessionByIdAndUserId(ctx, p); err != nil {
+		log.Println("Local LogoutSession DeleteLocalSessionByIdAndUserId:", err)
+		return auth.ErrSomethingWentWrong
+	}
+
+	return nil
+}
+
+func (r *LocalAuthRepository) LogoutOthers(ctx context.Context, token string) error {
+	claims, err := r.parseAccessToken(token)
+	if err != nil {
+		return err
+	}
+
+	p := postgres.DeleteOtherLocalSessionsParams{
+		UserID:    claims.Subject,
+		CurrentID: claims.SessionId,
+	}
+
+	if err := r.queries.DeleteOtherLocalSessions(ctx, p); err != nil {
+		log.Println("Local LogoutOthers DeleteOtherLocalSessions:", err)
+		return auth.ErrSomethingWentWrong
+	}
+
+	return nil
+}
+
+// LogoutAll ends every session of the user, their access tokens stay valid
+// until they expire but auth.Service.TouchSession rejects them once the
+// sessions are revoked.
+func (r *LocalAuthRepository) LogoutAll(ctx context.Context, userId string) error {
+	if err := r.queries.DeleteLocalSessionsByUserId(ctx, userId); err != nil {
+		log.Println("Local LogoutAll DeleteLocalSessionsByUserId:", err)
+		return auth.ErrSomethingWentWrong
+	}
+
+	return nil
+}
+
+// DeleteAccount removes the credentials of the user, the sessions go with
+// them.
+func (r *LocalAuthRepository) DeleteAccount(ctx context.Context, userId string) error {
+	if err := r.queries.DeleteOneTimeTokensByUserId(ctx, userId); err != nil {
+		log.Println("Local DeleteAccount DeleteOneTimeTokensByUserId:", err)
+		return auth.ErrSomethingWentWrong
+	}
+
+	if err := r.queries.DeleteLocalCredentials(ctx, userId); err != nil {
+		log.Println("Local DeleteAccount DeleteLocalCredentials:", err)
+		return auth.ErrSomethingWentWrong
+	}
+
+	return nil
+}
+
+func (r *LocalAuthRepository) GetUserId(ctx context.Context, token string) (string, error) {
+	claims, err := r.parseAccessToken(token)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := r.queries.GetLocalSessionById(ctx, claims.SessionId); err != nil {
+		return "", auth.ErrInvalidToken
+	}
+
+	return claims.Subject, nil
+}
+
+func (r *LocalAuthRepository) Refresh(ctx context.Context, refreshToken string) (auth.Token, error) {
+	newRefreshToken, err := randomToken()
+	if err != nil {
+		log.Println("Local Refresh randomToken:", err)
+		return auth.Token{}, auth.ErrSomethingWentWrong
+	}
+
+	p := postgres.RotateLocalSessionParams{
+		RefreshTokenHash:    hashToken(refreshToken),
+		NewRefreshTokenHash: hashToken(newRefreshToken),
+		ExpiresAt:           time.Now().Add(refreshTokenLifetime),
+	}
+
+	session, err := r.queries.RotateLocalSession(ctx, p)
+	if err != nil {
+		return auth.Token{}, auth.ErrInvalidToken
+	}
+
+	return r.signToken(session.UserID, session.ID, newRefreshToken)
+}
+
+func (r *LocalAuthRepository) IssueToken(ctx context.Context, userId string) (auth.Token, error) {
+	return r.newToken(ctx, userId)
+}
+
+func (r *LocalAuthRepository) SendMagicLink(ctx context.Context, email string) error {
+	c, err := r.queries.GetLocalCredentialsByEmail(ctx, email)
+	if err != nil {
+		// unknown emails are ignored so the form doesn't reveal who has an account
+		return nil
+	}
+
+	token, err := r.newOneTimeToken(ctx, c.UserID, email, magicLinkPurpose, magicLinkLifetime)
+	if err != nil {
+		return err
+	}
+
+	m := mail.Message{
+		To:      email,
+		Subject: "Your sign-in link",
+		Body: fmt.Sprintf(
+			"Follow this link to sign in. It works once and expires in %d minutes.\n\n%s/auth/magic-link?token=%s\n",
+			int(magicLinkLifetime.Minutes()),
+			r.appUrl,
+			token,
+		),
+	}
+
+	if err := r.mailer.Send(m); err != nil {
+		log.Println("Local SendMagicLink Send:", err)
+		return auth.ErrSomethingWentWrong
+	}
+
+	return nil
+}
+
+func (r *LocalAuthRepository) VerifyMagicLink(ctx context.Context, token string) (auth.Token, error) {
+	p := postgres.TakeOneTimeTokenParams{
+		TokenHash: hashToken(token),
+		Purpose:   magicLinkPurpose,
+	}
+
+	t, err := r.queries.TakeOneTimeToken(ctx, p)
+	if err != nil {
+		return auth.Token{}, auth.ErrInvalidToken
+	}
+
+	return r.newToken(ctx, t.UserID)
+}
+
+func (r *LocalAuthRepository) RequestPasswordReset(ctx context.Context, email string) error {
+	c, err := r.queries.GetLocalCredentialsByEmail(ctx, email)
+	if err != nil {
+		// unknown emails are ignored so the form doesn't reveal who has an account
+		return nil
+	}
+
+	token, err := r.newOneTimeToken(ctx, c.UserID, email, passwordResetPurpose, passwordResetLifetime)
+	if err != nil {
+		return err
+	}
+
+	m := mail.Message{
+		To:      email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Follow this link to choose a new password. It works once and expires in %d minutes.\n\n%s/auth-page/reset-password?token=%s\n\nIf you didn't ask for this, you can ignore this email.\n",
+			int(passwordResetLifetime.Minutes()),
+			r.appUrl,
+			token,
+		),
+	}
+
+	if err := r.mailer.Send(m); err != nil {
+		log.Println("Local RequestPasswordReset Send:", err)
+		return auth.ErrSomethingWentWrong
+	}
+
+	return nil
+}
+
+// ResetPassword also signs the user out everywhere since the old password
+// may have been compromised.
+func (r *LocalAuthRepository) ResetPassword(ctx context.Context, token, password string) (string, error) {
+	p := postgres.TakeOneTimeTokenParams{
+		TokenHash: hashToken(token),
+		Purpose:   passwordResetPurpose,
+	}
+
+	t, err := r.queries.TakeOneTimeToken(ctx, p)
+	if err != nil {
+		return "", auth.ErrInvalidToken
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Println("Local ResetPassword GenerateFromPassword:", err)
+		return "", auth.ErrSomethingWentWrong
+	}
+
+	updateParams := postgres.UpdateLocalPasswordParams{
+		UserID:       t.UserID,
+		PasswordHash: string(hash),
+	}
+
+	if err := r.queries.UpdateLocalPassword(ctx, updateParams); err != nil {
+		log.Println("Local ResetPassword UpdateLocalPassword:", err)
+		return "", auth.ErrSomethingWentWrong
+	}
+
+	if err := r.queries.DeleteLocalSessionsByUserId(ctx, t.UserID); err != nil {
+		log.Println("Local ResetPassword DeleteLocalSessionsByUserId:", err)
+		return "", auth.ErrSomethingWentWrong
+	}
+
+	return t.UserID, nil
+}
+
+func (r *LocalAuthRepository) VerifyEmail(ctx context.Context, token string) (auth.Token, error) {
+	p := postgres.TakeOneTimeTokenParams{
+		TokenHash: hashToken(token),
+		Purpose:   verificationPurpose,
+	}
+
+	t, err := r.queries.TakeOneTimeToken(ctx, p)
+	if err != nil {
+		return auth.Token{}, auth.ErrInvalidToken
+	}
+
+	return r.newToken(ctx, t.UserID)
+}
+
+func (r *LocalAuthRepository) ResendVerificationEmail(ctx context.Context, email string) error {
+	c, err := r.queries.GetLocalCredentialsByEmail(ctx, email)
+	if err != nil {
+		// unknown emails are ignored so the form doesn't reveal who has an account
+		return nil
+	}
+
+	u, err := r.queries.GetUserById(ctx, c.UserID)
+	if err == nil && u.VerifiedAt != nil {
+		return nil
+	}
+
+	return r.sendVerificationEmail(ctx, c.UserID, email)
+}
+
+// VerifyPassword returns auth.ErrInvalidCredentials when password isn't the
+// one of the user.
+func (r *LocalAuthRepository) VerifyPassword(ctx context.Context, userId, email, password string) error {
+	c, err := r.queries.GetLocalCredentialsByUserId(ctx, userId)
+	if err != nil {
+		log.Println("Local VerifyPassword GetLocalCredentialsByUserId:", err)
+		return auth.ErrSomethingWentWrong
+	}
+
+	// users who signed up with an identity provider have no password yet,
+	// they can set one with a password reset
+	if c.PasswordHash == "" || bcrypt.CompareHashAndPassword([]byte(c.PasswordHash), []byte(password)) != nil {
+		return auth.ErrInvalidCredentials
+	}
+
+	return nil
+}
+
+func (r *LocalAuthRepository) ChangePassword(ctx context.Context, userId, email, currentPassword, newPassword string) error {
+	if err := r.VerifyPassword(ctx, userId, email, currentPassword); err != nil {
+		return err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		log.Println("Local ChangePassword GenerateFromPassword:", err)
+		return auth.ErrSomethingWentWrong
+	}
+
+	p := postgres.UpdateLocalPasswordParams{
+		UserID:       userId,
+		PasswordHash: string(hash),
+	}
+
+	if err := r.queries.UpdateLocalPassword(ctx, p); err != nil {
+		log.Println("Local ChangePassword UpdateLocalPassword:", err)
+		return auth.ErrSomethingWentWrong
+	}
+
+	return nil
+}
+
+// RequestEmailChange emails the link confirming newEmail, the credentials
+// keep the old email until it's followed.
+func (r *LocalAuthRepository) RequestEmailChange(ctx context.Context, userId, accessToken, newEmail string) error {
+	if _, err := r.queries.GetLocalCredentialsByEmail(ctx, newEmail); err == nil {
+		return user.ErrEmailAlreadyUsed
+	}
+
+	token, err := r.newOneTimeToken(ctx, userId, newEmail, emailChangePurpose, verificationLifetime)
+	if err != nil {
+		return err
+	}
+
+	m := mail.Message{
+		To:      newEmail,
+		Subject: "Confirm your new email address",
+		Body: fmt.Sprintf(
+			"Follow this link to use this address for your account. It expires in %d hours.\n\n%s/auth/confirm-email?token=%s\n\nIf you didn't ask for this, you can ignore this email.\n",
+			int(verificationLifetime.Hours()),
+			r.appUrl,
+			token,
+		),
+	}
+
+	if err := r.mailer.Send(m); err != nil {
+		log.Println("Local RequestEmailChange Send:", err)
+		return auth.ErrSomethingWentWrong
+	}
+
+	return nil
+}
+
+func (r *LocalAuthRepository) ConfirmEmailChange(ctx context.Context, token string) (string, string, error) {
+	p := postgres.TakeOneTimeTokenParams{
+		TokenHash: hashToken(token),
+		Purpose:   emailChangePurpose,
+	}
+
+	t, err := r.queries.TakeOneTimeToken(ctx, p)
+	if err != nil {
+		return "", "", auth.ErrInvalidToken
+	}
+
+	updateParams := postgres.UpdateLocalEmailParams{
+		UserID: t.UserID,
+		Email:  t.Email,
+	}
+
+	if err := r.queries.UpdateLocalEmail(ctx, updateParams); err != nil {
+		// someone registered with the email in the meantime
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return "", "", user.ErrEmailAlreadyUsed
+		}
+
+		log.Println("Local ConfirmEmailChange UpdateLocalEmail:", err)
+		return "", "", auth.ErrSomethingWentWrong
+	}
+
+	return t.UserID, t.Email, nil
+}
+
+// helpers
+func (r *LocalAuthRepository) sendVerificationEmail(ctx context.Context, userId, email string) error {
+	token, err := r.newOneTimeToken(ctx, userId, email, verificationPurpose, verificationLifetime)
+	if err != nil {
+		return err
+	}
+
+	m := mail.Message{
+		To:      email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf(
+			"Follow this link to confirm your email address. It expires in %d hours.\n\n%s/auth/verify-email?token=%s\n",
+			int(verificationLifetime.Hours()),
+			r.appUrl,
+			token,
+		),
+	}
+
+	if err := r.mailer.Send(m); err != nil {
+		log.Println("Local sendVerificationEmail Send:", err)
+		return auth.ErrSomethingWentWrong
+	}
+
+	return nil
+}
+
+// newOneTimeToken returns the token of a link sent to email.
+func (r *LocalAuthRepository) newOneTimeToken(ctx context.Context, userId, email, purpose string, lifetime time.Duration) (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		log.Println("Local newOneTimeToken randomToken:", err)
+		return "", auth.ErrSomethingWentWrong
+	}
+
+	p := postgres.AddOneTimeTokenParams{
+		TokenHash: hashToken(token),
+		Purpose:   purpose,
+		UserID:    userId,
+		Email:     email,
+		ExpiresAt: time.Now().Add(lifetime),
+	}
+
+	if err := r.queries.AddOneTimeToken(ctx, p); err != nil {
+		log.Println("Local newOneTimeToken AddOneTimeToken:", err)
+		return "", auth.ErrSomethingWentWrong
+	}
+
+	return token, nil
+}
+
+func (r *LocalAuthRepository) newToken(ctx context.Context, userId string) (auth.Token, error) {
+	refreshToken, err := randomToken()
+	if err != nil {
+		log.Println("Local newToken randomToken:", err)
+		return auth.Token{}, auth.ErrSomethingWentWrong
+	}
+
+	p := postgres.AddLocalSessionParams{
+		UserID:           userId,
+		RefreshTokenHash: hashToken(refreshToken),
+		ExpiresAt:        time.Now().Add(refreshTokenLifetime),
+	}
+
+	session, err := r.queries.AddLocalSession(ctx, p)
+	if err != nil {
+		log.Println("Local newToken AddLocalSession:", err)
+		return auth.Token{}, auth.ErrSomethingWentWrong
+	}
+
+	return r.signToken(userId, session.ID, refreshToken)
+}
+
+func (r *LocalAuthRepository) signToken(userId, sessionId, refreshToken string) (auth.Token, error) {
+	now := time.Now()
+	expiresAt := now.Add(accessTokenLifetime)
+
+	claims := localClaims{
+		SessionId: sessionId,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   userId,
+			Audience:  jwt.ClaimStrings{"authenticated"},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	accessToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(r.jwtSecret)
+	if err != nil {
+		log.Println("Local signToken SignedString:", err)
+		return auth.Token{}, auth.ErrSomethingWentWrong
+	}
+
+	return auth.Token{
+			UserId:       userId,
+			AccessToken:  accessToken,
+			RefreshToken: refreshToken,
+			ExpiresIn:    int(accessTokenLifetime.Seconds()),
+			ExpiresAt:    int(expiresAt.Unix()),
+		},
+		nil
+}
+
+func (r *LocalAuthRepository) parseAccessToken(token string) (localClaims, error) {
+	claims := localClaims{}
+
+	_, err := jwt.ParseWithClaims(
+		token,
+		&claims,
+		func(t *jwt.Token) (any, error) {
+			return r.jwtSecret, nil
+		},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithAudience("authenticated"),
+	)
+	if err != nil {
+		return localClaims{}, auth.ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,84 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/cativovo/go-demo-auth/pkg/auth"
+	postgres "github.com/cativovo/go-demo-auth/pkg/storage/postgres/sqlc_generated"
+	"github.com/jackc/pgx/v5"
+)
+
+func (r *PostgresRepository) GetLoginFailures(ctx context.Context, key string) (auth.LoginFailures, error) {
+	f, err := r.queries.GetLoginFailures(ctx, key)
+	if err != nil {
+		return auth.LoginFailures{}, err
+	}
+
+	return toLoginFailures(f), nil
+}
+
+func (r *PostgresRepository) RecordLoginFailure(ctx context.Context, key string, resetBefore time.Time) (auth.LoginFailures, error) {
+	p := postgres.RecordLoginFailureParams{
+		Key:         key,
+		ResetBefore: resetBefore,
+	}
+
+	f, err := r.queries.RecordLoginFailure(ctx, p)
+	if err != nil {
+		return auth.LoginFailures{}, err
+	}
+
+	return toLoginFailures(f), nil
+}
+
+func (r *PostgresRepository) LockLogin(ctx context.Context, key string, until time.Time, unlockTokenHash string) error {
+	p := postgres.LockLoginParams{
+		Key:             key,
+		LockedUntil:     &until,
+		UnlockTokenHash: unlockTokenHash,
+	}
+
+	return r.queries.LockLogin(ctx, p)
+}
+
+func (r *PostgresRepository) ClearLoginFailures(ctx context.Context, key string) error {
+	return r.queries.DeleteLoginFailures(ctx, key)
+}
+
+func (r *PostgresRepository) UnlockLogin(ctx context.Context, unlockTokenHash string) error {
+	_, err := r.queries.UnlockLogin(ctx, unlockTokenHash)
+	return err
+}
+
+func (r *PostgresRepository) EmailExists(ctx context.Context, email string) (bool, error) {
+	_, err := r.queries.GetUserByEmail(ctx, email)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (r *PostgresRepository) GetUserEmail(ctx context.Context, id string) (string, error) {
+	u, err := r.queries.GetUserById(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	return u.Email, nil
+}
+
+// helpers
+func toLoginFailures(f postgres.LoginFailure) auth.LoginFailures {
+	return auth.LoginFailures{
+		Key:           f.Key,
+		Failures:      int(f.Failures),
+		LastFailureAt: f.LastFailureAt,
+		LockedUntil:   f.LockedUntil,
+	}
+}
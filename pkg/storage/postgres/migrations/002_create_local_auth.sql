@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE local_credentials (
+  user_id VARCHAR(36) PRIMARY KEY DEFAULT gen_random_uuid()::text,
+  email TEXT NOT NULL UNIQUE,
+  password_hash TEXT NOT NULL
+);
+
+CREATE TABLE local_sessions (
+  id VARCHAR(36) PRIMARY KEY DEFAULT gen_random_uuid()::text,
+  user_id VARCHAR(36) NOT NULL REFERENCES local_credentials (user_id) ON DELETE CASCADE,
+  refresh_token_hash TEXT NOT NULL UNIQUE,
+  expires_at TIMESTAMPTZ NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,19 @@
+-- +goose Up
+CREATE TABLE totp_secrets (
+  user_id VARCHAR(36) PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+  secret TEXT NOT NULL,
+  confirmed_at TIMESTAMPTZ,
+  last_used_step BIGINT NOT NULL DEFAULT 0,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE login_challenges (
+  id_hash TEXT PRIMARY KEY,
+  user_id VARCHAR(36) NOT NULL,
+  access_token TEXT NOT NULL,
+  refresh_token TEXT NOT NULL,
+  token_expires_in INTEGER NOT NULL,
+  token_expires_at BIGINT NOT NULL,
+  attempts INTEGER NOT NULL DEFAULT 0,
+  expires_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE webauthn_credentials (
+  id BYTEA PRIMARY KEY,
+  user_id VARCHAR(36) NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  credential JSONB NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  last_used_at TIMESTAMPTZ
+);
+
+CREATE INDEX webauthn_credentials_user_id_idx ON webauthn_credentials (user_id);
+
+CREATE TABLE webauthn_sessions (
+  id_hash TEXT PRIMARY KEY,
+  data JSONB NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL
+);
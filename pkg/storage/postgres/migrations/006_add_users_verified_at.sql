@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN verified_at TIMESTAMPTZ;
+
+-- accounts created before verification existed are trusted as they are
+UPDATE users SET verified_at = NOW();
@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE oidc_identities (
+  provider TEXT NOT NULL,
+  subject TEXT NOT NULL,
+  user_id VARCHAR(36) NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  email TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (provider, subject)
+);
+
+CREATE INDEX oidc_identities_user_id_idx ON oidc_identities (user_id);
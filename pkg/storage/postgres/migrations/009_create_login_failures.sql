@@ -0,0 +1,11 @@
+-- +goose Up
+-- key is "account:<email>" or "ip:<address>"
+CREATE TABLE login_failures (
+  key TEXT PRIMARY KEY,
+  failures INTEGER NOT NULL DEFAULT 0,
+  last_failure_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  locked_until TIMESTAMPTZ,
+  unlock_token_hash TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX login_failures_unlock_token_hash_idx ON login_failures (unlock_token_hash);
@@ -0,0 +1,11 @@
+-- +goose Up
+-- the sessions behind the session cookie, token holds the provider tokens
+CREATE TABLE browser_sessions (
+  id_hash TEXT PRIMARY KEY,
+  user_id VARCHAR(36) NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  token JSONB NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX browser_sessions_expires_at_idx ON browser_sessions (expires_at);
@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE TABLE api_tokens (
+  id VARCHAR(36) PRIMARY KEY DEFAULT gen_random_uuid()::text,
+  user_id VARCHAR(36) NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  token_hash TEXT NOT NULL UNIQUE,
+  scopes TEXT[] NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  expires_at TIMESTAMPTZ NOT NULL,
+  last_used_at TIMESTAMPTZ
+);
+
+CREATE INDEX api_tokens_user_id_idx ON api_tokens (user_id);
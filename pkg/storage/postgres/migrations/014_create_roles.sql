@@ -0,0 +1,41 @@
+-- +goose Up
+CREATE TABLE roles (
+  name TEXT PRIMARY KEY,
+  description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE permissions (
+  name TEXT PRIMARY KEY,
+  description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE role_permissions (
+  role TEXT NOT NULL REFERENCES roles (name) ON DELETE CASCADE,
+  permission TEXT NOT NULL REFERENCES permissions (name) ON DELETE CASCADE,
+  PRIMARY KEY (role, permission)
+);
+
+CREATE TABLE user_roles (
+  user_id VARCHAR(36) NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  role TEXT NOT NULL REFERENCES roles (name) ON DELETE CASCADE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (user_id, role)
+);
+
+CREATE INDEX user_roles_role_idx ON user_roles (role);
+
+INSERT INTO permissions (name, description) VALUES
+  ('users:read', 'See every user'),
+  ('users:manage', 'Edit, lock and delete users'),
+  ('roles:manage', 'Grant and revoke roles'),
+  ('oauth_clients:manage', 'Register the apps using the OpenID Connect provider');
+
+INSERT INTO roles (name, description) VALUES
+  ('admin', 'Can do everything'),
+  ('support', 'Can look users up');
+
+INSERT INTO role_permissions (role, permission)
+SELECT 'admin', name FROM permissions;
+
+INSERT INTO role_permissions (role, permission) VALUES
+  ('support', 'users:read');
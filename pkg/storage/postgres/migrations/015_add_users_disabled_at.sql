@@ -0,0 +1,3 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+ALTER TABLE users ADD COLUMN disabled_at TIMESTAMPTZ;
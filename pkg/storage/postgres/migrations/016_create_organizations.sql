@@ -0,0 +1,29 @@
+-- +goose Up
+CREATE TABLE organizations (
+  id VARCHAR(36) PRIMARY KEY DEFAULT gen_random_uuid()::text,
+  name TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE memberships (
+  org_id VARCHAR(36) NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+  user_id VARCHAR(36) NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  role TEXT NOT NULL CHECK (role IN ('owner', 'admin', 'member')),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (org_id, user_id)
+);
+
+CREATE INDEX memberships_user_id_idx ON memberships (user_id);
+
+CREATE TABLE invitations (
+  id VARCHAR(36) PRIMARY KEY DEFAULT gen_random_uuid()::text,
+  org_id VARCHAR(36) NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+  email TEXT NOT NULL,
+  role TEXT NOT NULL CHECK (role IN ('owner', 'admin', 'member')),
+  token_hash TEXT NOT NULL UNIQUE,
+  invited_by VARCHAR(36) NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX invitations_org_id_idx ON invitations (org_id);
@@ -0,0 +1,25 @@
+-- +goose Up
+-- user_id isn't a foreign key, the failed logins of unknown emails are
+-- recorded too and the events outlive the users
+CREATE TABLE audit_events (
+  id VARCHAR(36) PRIMARY KEY DEFAULT gen_random_uuid()::text,
+  user_id VARCHAR(36) NOT NULL DEFAULT '',
+  email TEXT NOT NULL DEFAULT '',
+  action TEXT NOT NULL,
+  outcome TEXT NOT NULL CHECK (outcome IN ('success', 'failure')),
+  detail TEXT NOT NULL DEFAULT '',
+  ip TEXT NOT NULL DEFAULT '',
+  user_agent TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX audit_events_user_id_idx ON audit_events (user_id, created_at DESC);
+CREATE INDEX audit_events_email_idx ON audit_events (lower(email), created_at DESC);
+CREATE INDEX audit_events_created_at_idx ON audit_events (created_at DESC);
+
+INSERT INTO permissions (name, description) VALUES
+  ('audit:read', 'See the security events of every user');
+
+INSERT INTO role_permissions (role, permission) VALUES
+  ('admin', 'audit:read'),
+  ('support', 'audit:read');
@@ -0,0 +1,3 @@
+-- +goose Up
+-- the address the link was sent to, email changes are applied from it
+ALTER TABLE one_time_tokens ADD COLUMN email TEXT NOT NULL DEFAULT '';
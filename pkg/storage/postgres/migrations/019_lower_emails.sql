@@ -0,0 +1,10 @@
+-- +goose Up
+-- emails are matched without case like the invitations and the bootstrap
+-- administrator, this fails on accounts only differing by the case of their
+-- email, which have to be merged by hand first
+UPDATE local_credentials SET email = lower(email);
+UPDATE users SET email = lower(email);
+
+ALTER TABLE local_credentials DROP CONSTRAINT local_credentials_email_key;
+CREATE UNIQUE INDEX local_credentials_email_idx ON local_credentials (lower(email));
+CREATE INDEX users_email_idx ON users (lower(email));
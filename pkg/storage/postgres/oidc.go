@@ -0,0 +1,38 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+
+	"github.com/cativovo/go-demo-auth/pkg/auth"
+	postgres "github.com/cativovo/go-demo-auth/pkg/storage/postgres/sqlc_generated"
+	"github.com/jackc/pgx/v5"
+)
+
+func (r *PostgresRepository) AddOIDCIdentity(ctx context.Context, i auth.OIDCIdentity, userId string) error {
+	p := postgres.AddOIDCIdentityParams{
+		Provider: i.Provider,
+		Subject:  i.Subject,
+		UserID:   userId,
+		Email:    i.Email,
+	}
+
+	return r.queries.AddOIDCIdentity(ctx, p)
+}
+
+func (r *PostgresRepository) GetOIDCIdentityUserId(ctx context.Context, provider, subject string) (string, error) {
+	p := postgres.GetOIDCIdentityParams{
+		Provider: provider,
+		Subject:  subject,
+	}
+
+	i, err := r.queries.GetOIDCIdentity(ctx, p)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", auth.ErrOIDCIdentityNotLinked
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return i.UserID, nil
+}
@@ -0,0 +1,194 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/cativovo/go-demo-auth/pkg/org"
+	postgres "github.com/cativovo/go-demo-auth/pkg/storage/postgres/sqlc_generated"
+)
+
+func (r *PostgresRepository) AddOrganization(ctx context.Context, name string) (org.Organization, error) {
+	o, err := r.queries.AddOrganization(ctx, name)
+	if err != nil {
+		return org.Organization{}, err
+	}
+
+	return toOrganization(o), nil
+}
+
+func (r *PostgresRepository) GetOrganizationById(ctx context.Context, id string) (org.Organization, error) {
+	o, err := r.queries.GetOrganizationById(ctx, id)
+	if err != nil {
+		return org.Organization{}, err
+	}
+
+	return toOrganization(o), nil
+}
+
+func (r *PostgresRepository) GetMembershipsByUserId(ctx context.Context, userId string) ([]org.Membership, error) {
+	rows, err := r.queries.GetMembershipsByUserId(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	memberships := make([]org.Membership, 0, len(rows))
+
+	for _, row := range rows {
+		memberships = append(memberships, org.Membership{
+			Organization: org.Organization{
+				Id:        row.ID,
+				Name:      row.Name,
+				CreatedAt: row.CreatedAt,
+			},
+			Role: row.Role,
+		})
+	}
+
+	return memberships, nil
+}
+
+func (r *PostgresRepository) GetMembers(ctx context.Context, orgId string) ([]org.Member, error) {
+	rows, err := r.queries.GetMembers(ctx, orgId)
+	if err != nil {
+		return nil, err
+	}
+
+	members := make([]org.Member, 0, len(rows))
+
+	for _, row := range rows {
+		members = append(members, org.Member{
+			UserId:   row.ID,
+			Email:    row.Email,
+			Name:     row.Name,
+			Role:     row.Role,
+			JoinedAt: row.CreatedAt,
+		})
+	}
+
+	return members, nil
+}
+
+func (r *PostgresRepository) AddMembership(ctx context.Context, orgId, userId, role string) error {
+	p := postgres.AddMembershipParams{
+		OrgID:  orgId,
+		UserID: userId,
+		Role:   role,
+	}
+
+	return r.queries.AddMembership(ctx, p)
+}
+
+func (r *PostgresRepository) UpdateMembershipRole(ctx context.Context, orgId, userId, role string) (bool, error) {
+	p := postgres.UpdateMembershipRoleParams{
+		OrgID:  orgId,
+		UserID: userId,
+		Role:   role,
+	}
+
+	n, err := r.queries.UpdateMembershipRole(ctx, p)
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+func (r *PostgresRepository) DeleteMembership(ctx context.Context, orgId, userId string) (bool, error) {
+	p := postgres.DeleteMembershipParams{
+		OrgID:  orgId,
+		UserID: userId,
+	}
+
+	n, err := r.queries.DeleteMembership(ctx, p)
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+func (r *PostgresRepository) CountOrganizationOwners(ctx context.Context, orgId string) (int, error) {
+	n, err := r.queries.CountOrganizationOwners(ctx, orgId)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(n), nil
+}
+
+func (r *PostgresRepository) AddInvitation(ctx context.Context, i org.Invitation, tokenHash string) (org.Invitation, error) {
+	p := postgres.AddInvitationParams{
+		OrgID:     i.OrgId,
+		Email:     i.Email,
+		Role:      i.Role,
+		TokenHash: tokenHash,
+		InvitedBy: i.InvitedBy,
+		ExpiresAt: i.ExpiresAt,
+	}
+
+	row, err := r.queries.AddInvitation(ctx, p)
+	if err != nil {
+		return org.Invitation{}, err
+	}
+
+	return toInvitation(row), nil
+}
+
+func (r *PostgresRepository) GetInvitationByHash(ctx context.Context, tokenHash string) (org.Invitation, error) {
+	row, err := r.queries.GetInvitationByHash(ctx, tokenHash)
+	if err != nil {
+		return org.Invitation{}, err
+	}
+
+	return toInvitation(row), nil
+}
+
+func (r *PostgresRepository) GetInvitationsByOrgId(ctx context.Context, orgId string) ([]org.Invitation, error) {
+	rows, err := r.queries.GetInvitationsByOrgId(ctx, orgId)
+	if err != nil {
+		return nil, err
+	}
+
+	invitations := make([]org.Invitation, 0, len(rows))
+
+	for _, row := range rows {
+		invitations = append(invitations, toInvitation(row))
+	}
+
+	return invitations, nil
+}
+
+func (r *PostgresRepository) DeleteInvitation(ctx context.Context, orgId, id string) (bool, error) {
+	p := postgres.DeleteInvitationParams{
+		ID:    id,
+		OrgID: orgId,
+	}
+
+	n, err := r.queries.DeleteInvitation(ctx, p)
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+// helpers
+func toOrganization(o postgres.Organization) org.Organization {
+	return org.Organization{
+		Id:        o.ID,
+		Name:      o.Name,
+		CreatedAt: o.CreatedAt,
+	}
+}
+
+func toInvitation(i postgres.Invitation) org.Invitation {
+	return org.Invitation{
+		Id:        i.ID,
+		OrgId:     i.OrgID,
+		Email:     i.Email,
+		Role:      i.Role,
+		InvitedBy: i.InvitedBy,
+		CreatedAt: i.CreatedAt,
+		ExpiresAt: i.ExpiresAt,
+	}
+}
@@ -0,0 +1,94 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/cativovo/go-demo-auth/pkg/auth"
+	postgres "github.com/cativovo/go-demo-auth/pkg/storage/postgres/sqlc_generated"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+func (r *PostgresRepository) AddPasskey(ctx context.Context, p auth.Passkey) error {
+	credential, err := json.Marshal(p.Credential)
+	if err != nil {
+		return err
+	}
+
+	params := postgres.AddWebAuthnCredentialParams{
+		ID:         p.Credential.ID,
+		UserID:     p.UserId,
+		Credential: credential,
+	}
+
+	return r.queries.AddWebAuthnCredential(ctx, params)
+}
+
+func (r *PostgresRepository) GetPasskeysByUserId(ctx context.Context, userId string) ([]auth.Passkey, error) {
+	rows, err := r.queries.GetWebAuthnCredentialsByUserId(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	passkeys := make([]auth.Passkey, 0, len(rows))
+
+	for _, row := range rows {
+		c := webauthn.Credential{}
+		if err := json.Unmarshal(row.Credential, &c); err != nil {
+			return nil, err
+		}
+
+		passkeys = append(passkeys, auth.Passkey{
+			UserId:     row.UserID,
+			Credential: c,
+			CreatedAt:  row.CreatedAt,
+			LastUsedAt: row.LastUsedAt,
+		})
+	}
+
+	return passkeys, nil
+}
+
+func (r *PostgresRepository) UpdatePasskey(ctx context.Context, c webauthn.Credential) error {
+	credential, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	p := postgres.UpdateWebAuthnCredentialParams{
+		ID:         c.ID,
+		Credential: credential,
+	}
+
+	return r.queries.UpdateWebAuthnCredential(ctx, p)
+}
+
+func (r *PostgresRepository) AddWebAuthnSession(ctx context.Context, idHash string, s webauthn.SessionData, expiresAt time.Time) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	p := postgres.AddWebAuthnSessionParams{
+		IDHash:    idHash,
+		Data:      data,
+		ExpiresAt: expiresAt,
+	}
+
+	return r.queries.AddWebAuthnSession(ctx, p)
+}
+
+func (r *PostgresRepository) TakeWebAuthnSession(ctx context.Context, idHash string) (webauthn.SessionData, error) {
+	data, err := r.queries.TakeWebAuthnSession(ctx, idHash)
+	if err != nil {
+		return webauthn.SessionData{}, err
+	}
+
+	s := webauthn.SessionData{}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return webauthn.SessionData{}, err
+	}
+
+	return s, nil
+}
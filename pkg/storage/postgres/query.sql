@@ -1,13 +1,455 @@
 -- name: AddUser :one
 INSERT INTO users (
-  id, email, name
+  id, email, name, verified_at
 ) VALUES (
-  $1, $2, $3
+  @id, lower(@email), @name, @verified_at
 )
 RETURNING *;
 
 -- name: GetUserByEmail :one
-SELECT * FROM users WHERE email=$1;
+SELECT * FROM users WHERE lower(email)=lower(@email);
 
 -- name: GetUserById :one
 SELECT * FROM users WHERE id=$1;
+
+-- name: MarkUserVerified :exec
+UPDATE users SET verified_at = now() WHERE id=$1 AND verified_at IS NULL;
+
+-- name: UpdateUserName :one
+UPDATE users SET name = @name WHERE id = @id RETURNING *;
+
+-- name: UpdateUserEmail :one
+UPDATE users SET email = lower(@email), verified_at = coalesce(verified_at, now()) WHERE id = @id RETURNING *;
+
+-- name: AddLocalCredentials :one
+INSERT INTO local_credentials (
+  email, password_hash
+) VALUES (
+  lower(@email), @password_hash
+)
+RETURNING *;
+
+-- name: GetLocalCredentialsByEmail :one
+SELECT * FROM local_credentials WHERE lower(email)=lower(@email);
+
+-- name: AddLocalSession :one
+INSERT INTO local_sessions (
+  user_id, refresh_token_hash, expires_at
+) VALUES (
+  $1, $2, $3
+)
+RETURNING *;
+
+-- name: GetLocalSessionById :one
+SELECT * FROM local_sessions WHERE id=$1 AND expires_at > now();
+
+-- name: DeleteLocalSessionById :exec
+DELETE FROM local_sessions WHERE id=$1;
+
+-- name: RotateLocalSession :one
+UPDATE local_sessions
+SET refresh_token_hash = @new_refresh_token_hash, expires_at = @expires_at
+WHERE refresh_token_hash = @refresh_token_hash AND expires_at > now()
+RETURNING *;
+
+-- name: SaveTOTPSecret :exec
+INSERT INTO totp_secrets (
+  user_id, secret
+) VALUES (
+  $1, $2
+)
+ON CONFLICT (user_id) DO UPDATE
+SET secret = EXCLUDED.secret, last_used_step = 0, created_at = now()
+WHERE totp_secrets.confirmed_at IS NULL;
+
+-- name: GetTOTPSecret :one
+SELECT * FROM totp_secrets WHERE user_id=$1;
+
+-- name: ConfirmTOTPSecret :exec
+UPDATE totp_secrets SET confirmed_at = now() WHERE user_id=$1;
+
+-- name: UpdateTOTPLastUsedStep :execrows
+UPDATE totp_secrets SET last_used_step = $2 WHERE user_id=$1 AND last_used_step < $2;
+
+-- name: DeleteTOTPSecret :exec
+DELETE FROM totp_secrets WHERE user_id=$1;
+
+-- name: AddLoginChallenge :exec
+INSERT INTO login_challenges (
+  id_hash, user_id, access_token, refresh_token, token_expires_in, token_expires_at, expires_at
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7
+);
+
+-- name: GetLoginChallenge :one
+SELECT * FROM login_challenges WHERE id_hash=$1;
+
+-- name: IncrementLoginChallengeAttempts :exec
+UPDATE login_challenges SET attempts = attempts + 1 WHERE id_hash=$1;
+
+-- name: DeleteLoginChallenge :exec
+DELETE FROM login_challenges WHERE id_hash=$1;
+
+-- name: AddWebAuthnCredential :exec
+INSERT INTO webauthn_credentials (
+  id, user_id, credential
+) VALUES (
+  $1, $2, $3
+);
+
+-- name: GetWebAuthnCredentialsByUserId :many
+SELECT * FROM webauthn_credentials WHERE user_id=$1 ORDER BY created_at;
+
+-- name: UpdateWebAuthnCredential :exec
+UPDATE webauthn_credentials SET credential = $2, last_used_at = now() WHERE id=$1;
+
+-- name: AddWebAuthnSession :exec
+INSERT INTO webauthn_sessions (
+  id_hash, data, expires_at
+) VALUES (
+  $1, $2, $3
+);
+
+-- name: TakeWebAuthnSession :one
+DELETE FROM webauthn_sessions WHERE id_hash=$1 AND expires_at > now() RETURNING data;
+
+-- name: AddOneTimeToken :exec
+INSERT INTO one_time_tokens (
+  token_hash, purpose, user_id, email, expires_at
+) VALUES (
+  $1, $2, $3, $4, $5
+);
+
+-- name: TakeOneTimeToken :one
+DELETE FROM one_time_tokens
+WHERE token_hash=$1 AND purpose=$2 AND expires_at > now()
+RETURNING *;
+
+-- name: UpdateLocalPassword :exec
+UPDATE local_credentials SET password_hash = $2 WHERE user_id=$1;
+
+-- name: UpdateLocalEmail :exec
+UPDATE local_credentials SET email = lower(@email) WHERE user_id = @user_id;
+
+-- name: DeleteLocalSessionsByUserId :exec
+DELETE FROM local_sessions WHERE user_id=$1;
+
+-- name: GetLocalCredentialsByUserId :one
+SELECT * FROM local_credentials WHERE user_id=$1;
+
+-- name: AddOIDCIdentity :exec
+INSERT INTO oidc_identities (
+  provider, subject, user_id, email
+) VALUES (
+  $1, $2, $3, $4
+);
+
+-- name: GetOIDCIdentity :one
+SELECT * FROM oidc_identities WHERE provider=$1 AND subject=$2;
+
+-- name: GetOAuthClient :one
+SELECT * FROM oauth_clients WHERE id=$1;
+
+-- name: AddAuthorizationCode :exec
+INSERT INTO oauth_authorization_codes (
+  code_hash, client_id, user_id, redirect_uri, scope, nonce, code_challenge, expires_at
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8
+);
+
+-- name: TakeAuthorizationCode :one
+DELETE FROM oauth_authorization_codes WHERE code_hash=$1 RETURNING *;
+
+-- name: GetConsent :one
+SELECT * FROM oauth_consents WHERE user_id=$1 AND client_id=$2;
+
+-- name: SaveConsent :exec
+INSERT INTO oauth_consents (
+  user_id, client_id, scope
+) VALUES (
+  $1, $2, $3
+)
+ON CONFLICT (user_id, client_id) DO UPDATE SET scope = EXCLUDED.scope;
+
+-- name: GetLoginFailures :one
+SELECT * FROM login_failures WHERE key=$1;
+
+-- name: RecordLoginFailure :one
+INSERT INTO login_failures (
+  key, failures, last_failure_at
+) VALUES (
+  @key, 1, now()
+)
+ON CONFLICT (key) DO UPDATE SET
+  failures = CASE
+    WHEN login_failures.last_failure_at < @reset_before THEN 1
+    ELSE login_failures.failures + 1
+  END,
+  last_failure_at = now()
+RETURNING *;
+
+-- name: LockLogin :exec
+UPDATE login_failures
+SET failures = 0, locked_until = @locked_until, unlock_token_hash = @unlock_token_hash
+WHERE key = @key;
+
+-- name: DeleteLoginFailures :exec
+DELETE FROM login_failures WHERE key=$1;
+
+-- name: UnlockLogin :one
+DELETE FROM login_failures
+WHERE unlock_token_hash=$1 AND locked_until > now()
+RETURNING key;
+
+-- name: TakeRateLimitToken :one
+INSERT INTO rate_limit_buckets (
+  key, tokens, updated_at
+) VALUES (
+  @key, (@burst::float8) - 1, now()
+)
+ON CONFLICT (key) DO UPDATE SET
+  tokens = LEAST(@burst::float8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM now() - rate_limit_buckets.updated_at)::float8 * @rate::float8) - 1,
+  updated_at = now()
+WHERE LEAST(@burst::float8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM now() - rate_limit_buckets.updated_at)::float8 * @rate::float8) >= 1
+RETURNING tokens;
+
+-- name: GetRateLimitTokens :one
+SELECT LEAST(@burst::float8, tokens + EXTRACT(EPOCH FROM now() - updated_at)::float8 * @rate::float8)::float8 AS tokens
+FROM rate_limit_buckets
+WHERE key = @key;
+
+-- name: DeleteStaleRateLimitBuckets :exec
+DELETE FROM rate_limit_buckets WHERE updated_at < @updated_before;
+
+-- name: TouchSession :one
+INSERT INTO sessions (
+  id, user_id, user_agent, ip
+) VALUES (
+  @id, @user_id, @user_agent, @ip
+)
+ON CONFLICT (id) DO UPDATE SET
+  user_agent = EXCLUDED.user_agent,
+  ip = EXCLUDED.ip,
+  last_seen_at = now()
+WHERE sessions.revoked_at IS NULL AND sessions.user_id = EXCLUDED.user_id
+RETURNING *;
+
+-- name: GetActiveSessionsByUserId :many
+SELECT * FROM sessions
+WHERE user_id = @user_id AND revoked_at IS NULL AND last_seen_at > @seen_after
+ORDER BY last_seen_at DESC;
+
+-- name: RevokeSession :execrows
+UPDATE sessions SET revoked_at = now()
+WHERE id = @id AND user_id = @user_id AND revoked_at IS NULL;
+
+-- name: RevokeOtherSessions :exec
+UPDATE sessions SET revoked_at = now()
+WHERE user_id = @user_id AND id <> @current_id AND revoked_at IS NULL;
+
+-- name: DeleteLocalSessionByIdAndUserId :exec
+DELETE FROM local_sessions WHERE id = @id AND user_id = @user_id;
+
+-- name: DeleteOtherLocalSessions :exec
+DELETE FROM local_sessions WHERE user_id = @user_id AND id <> @current_id;
+
+-- name: AddBrowserSession :exec
+INSERT INTO browser_sessions (
+  id_hash, user_id, token, created_at, expires_at
+) VALUES (
+  $1, $2, $3, $4, $5
+);
+
+-- name: GetBrowserSession :one
+SELECT * FROM browser_sessions WHERE id_hash=$1 AND expires_at > now();
+
+-- name: UpdateBrowserSessionToken :execrows
+UPDATE browser_sessions SET token = @token, expires_at = @expires_at
+WHERE id_hash = @id_hash;
+
+-- name: DeleteBrowserSession :exec
+DELETE FROM browser_sessions WHERE id_hash=$1;
+
+-- name: DeleteExpiredBrowserSessions :exec
+DELETE FROM browser_sessions WHERE expires_at <= now();
+
+-- name: AddAPIToken :one
+INSERT INTO api_tokens (
+  user_id, name, token_hash, scopes, expires_at
+) VALUES (
+  $1, $2, $3, $4, $5
+)
+RETURNING *;
+
+-- name: GetAPITokenByHash :one
+SELECT * FROM api_tokens WHERE token_hash=$1 AND expires_at > now();
+
+-- name: GetAPITokensByUserId :many
+SELECT * FROM api_tokens WHERE user_id=$1 ORDER BY created_at DESC;
+
+-- name: UpdateAPITokenLastUsed :exec
+UPDATE api_tokens SET last_used_at = now() WHERE id=$1;
+
+-- name: DeleteAPIToken :execrows
+DELETE FROM api_tokens WHERE id = @id AND user_id = @user_id;
+
+-- name: GetRoles :many
+SELECT * FROM roles ORDER BY name;
+
+-- name: GetRolePermissions :many
+SELECT * FROM role_permissions ORDER BY role, permission;
+
+-- name: GetUserRoles :many
+SELECT role FROM user_roles WHERE user_id=$1 ORDER BY role;
+
+-- name: GetUserPermissions :many
+SELECT DISTINCT rp.permission
+FROM user_roles ur
+JOIN role_permissions rp ON rp.role = ur.role
+WHERE ur.user_id = $1
+ORDER BY rp.permission;
+
+-- name: AddUserRole :exec
+INSERT INTO user_roles (
+  user_id, role
+) VALUES (
+  $1, $2
+)
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteUserRole :execrows
+DELETE FROM user_roles WHERE user_id = @user_id AND role = @role;
+
+-- name: CountUsersWithRole :one
+SELECT count(*) FROM user_roles WHERE role=$1;
+
+-- name: SearchUsers :many
+SELECT * FROM users
+WHERE @query::text = ''
+  -- the query is matched literally, its wildcards are escaped
+  OR email ILIKE '%' || replace(replace(replace(@query::text, '\', '\\'), '%', '\%'), '_', '\_') || '%' ESCAPE '\'
+  OR name ILIKE '%' || replace(replace(replace(@query::text, '\', '\\'), '%', '\%'), '_', '\_') || '%' ESCAPE '\'
+ORDER BY created_at DESC, id
+LIMIT @page_size OFFSET @page_offset;
+
+-- name: CountUsers :one
+SELECT count(*) FROM users
+WHERE @query::text = ''
+  -- the query is matched literally, its wildcards are escaped
+  OR email ILIKE '%' || replace(replace(replace(@query::text, '\', '\\'), '%', '\%'), '_', '\_') || '%' ESCAPE '\'
+  OR name ILIKE '%' || replace(replace(replace(@query::text, '\', '\\'), '%', '\%'), '_', '\_') || '%' ESCAPE '\';
+
+-- name: SetUserDisabled :execrows
+UPDATE users
+SET disabled_at = CASE WHEN @disabled::boolean THEN coalesce(disabled_at, now()) END
+WHERE id = @id;
+
+-- name: IsUserDisabled :one
+SELECT (disabled_at IS NOT NULL)::boolean AS disabled FROM users WHERE id=$1;
+
+-- name: DeleteUser :execrows
+DELETE FROM users WHERE id=$1;
+
+-- name: RevokeAllSessions :exec
+UPDATE sessions SET revoked_at = now() WHERE user_id=$1 AND revoked_at IS NULL;
+
+-- name: DeleteLocalCredentials :exec
+DELETE FROM local_credentials WHERE user_id=$1;
+
+-- name: DeleteOneTimeTokensByUserId :exec
+DELETE FROM one_time_tokens WHERE user_id=$1;
+
+-- name: AddOrganization :one
+INSERT INTO organizations (
+  name
+) VALUES (
+  $1
+)
+RETURNING *;
+
+-- name: GetOrganizationById :one
+SELECT * FROM organizations WHERE id=$1;
+
+-- name: GetMembershipsByUserId :many
+SELECT o.id, o.name, o.created_at, m.role
+FROM memberships m
+JOIN organizations o ON o.id = m.org_id
+WHERE m.user_id = $1
+ORDER BY o.name, o.id;
+
+-- name: GetMembers :many
+SELECT u.id, u.email, u.name, m.role, m.created_at
+FROM memberships m
+JOIN users u ON u.id = m.user_id
+WHERE m.org_id = $1
+ORDER BY u.email;
+
+-- name: AddMembership :exec
+INSERT INTO memberships (
+  org_id, user_id, role
+) VALUES (
+  $1, $2, $3
+)
+ON CONFLICT (org_id, user_id) DO NOTHING;
+
+-- name: UpdateMembershipRole :execrows
+UPDATE memberships SET role = @role WHERE org_id = @org_id AND user_id = @user_id;
+
+-- name: DeleteMembership :execrows
+DELETE FROM memberships WHERE org_id = @org_id AND user_id = @user_id;
+
+-- name: CountOrganizationOwners :one
+SELECT count(*) FROM memberships WHERE org_id=$1 AND role = 'owner';
+
+-- name: AddInvitation :one
+INSERT INTO invitations (
+  org_id, email, role, token_hash, invited_by, expires_at
+) VALUES (
+  $1, $2, $3, $4, $5, $6
+)
+RETURNING *;
+
+-- name: GetInvitationByHash :one
+SELECT * FROM invitations WHERE token_hash=$1 AND expires_at > now();
+
+-- name: GetInvitationsByOrgId :many
+SELECT * FROM invitations WHERE org_id=$1 AND expires_at > now() ORDER BY created_at DESC;
+
+-- name: DeleteInvitation :execrows
+DELETE FROM invitations WHERE id = @id AND org_id = @org_id;
+
+-- name: AddAuditEvent :exec
+INSERT INTO audit_events (
+  user_id, email, action, outcome, detail, ip, user_agent
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7
+);
+
+-- name: GetAuditEventsByUser :many
+SELECT * FROM audit_events
+WHERE user_id = @user_id
+  OR (user_id = '' AND @email::text <> '' AND lower(email) = lower(@email::text))
+ORDER BY created_at DESC
+LIMIT @page_size;
+
+-- name: SearchAuditEvents :many
+SELECT * FROM audit_events
+WHERE (@user_id::text = '' OR user_id = @user_id::text)
+  AND (@email::text = '' OR lower(email) = lower(@email::text))
+  AND (@action::text = '' OR action LIKE @action::text || '%')
+  AND (@outcome::text = '' OR outcome = @outcome::text)
+  AND (@ip::text = '' OR ip = @ip::text)
+  AND (sqlc.narg('since')::timestamptz IS NULL OR created_at >= sqlc.narg('since')::timestamptz)
+  AND (sqlc.narg('until')::timestamptz IS NULL OR created_at < sqlc.narg('until')::timestamptz)
+ORDER BY created_at DESC, id
+LIMIT @page_size OFFSET @page_offset;
+
+-- name: CountAuditEvents :one
+SELECT count(*) FROM audit_events
+WHERE (@user_id::text = '' OR user_id = @user_id::text)
+  AND (@email::text = '' OR lower(email) = lower(@email::text))
+  AND (@action::text = '' OR action LIKE @action::text || '%')
+  AND (@outcome::text = '' OR outcome = @outcome::text)
+  AND (@ip::text = '' OR ip = @ip::text)
+  AND (sqlc.narg('since')::timestamptz IS NULL OR created_at >= sqlc.narg('since')::timestamptz)
+  AND (sqlc.narg('until')::timestamptz IS NULL OR created_at < sqlc.narg('until')::timestamptz);
@@ -0,0 +1,76 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/cativovo/go-demo-auth/pkg/ratelimit"
+	postgres "github.com/cativovo/go-demo-auth/pkg/storage/postgres/sqlc_generated"
+	"github.com/jackc/pgx/v5"
+)
+
+// buckets untouched for that long are full again whatever their limit
+const staleRateLimitBucketAge = 24 * time.Hour
+
+// RateLimitStore shares the rate limit buckets between server instances.
+type RateLimitStore struct {
+	queries *postgres.Queries
+
+	mu      sync.Mutex
+	sweptAt time.Time
+}
+
+func NewRateLimitStore(r *PostgresRepository) *RateLimitStore {
+	return &RateLimitStore{
+		queries: r.queries,
+		sweptAt: time.Now(),
+	}
+}
+
+func (s *RateLimitStore) Take(ctx context.Context, key string, l ratelimit.Limit) (bool, time.Duration, error) {
+	s.sweep(ctx)
+
+	p := postgres.TakeRateLimitTokenParams{
+		Key:   key,
+		Burst: float64(l.Burst),
+		Rate:  l.Rate,
+	}
+
+	_, err := s.queries.TakeRateLimitToken(ctx, p)
+	if err == nil {
+		return true, 0, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return false, 0, err
+	}
+
+	// no row means the update was skipped because the bucket is empty
+	tokens, err := s.queries.GetRateLimitTokens(ctx, postgres.GetRateLimitTokensParams{
+		Key:   key,
+		Burst: float64(l.Burst),
+		Rate:  l.Rate,
+	})
+	if err != nil {
+		return false, 0, err
+	}
+
+	return false, ratelimit.RetryAfter(tokens, l), nil
+}
+
+// helpers
+func (s *RateLimitStore) sweep(ctx context.Context) {
+	s.mu.Lock()
+	if time.Since(s.sweptAt) < time.Hour {
+		s.mu.Unlock()
+		return
+	}
+	s.sweptAt = time.Now()
+	s.mu.Unlock()
+
+	if err := s.queries.DeleteStaleRateLimitBuckets(ctx, time.Now().Add(-staleRateLimitBucketAge)); err != nil {
+		log.Println("RateLimitStore sweep DeleteStaleRateLimitBuckets:", err)
+	}
+}
@@ -0,0 +1,77 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/cativovo/go-demo-auth/pkg/rbac"
+	postgres "github.com/cativovo/go-demo-auth/pkg/storage/postgres/sqlc_generated"
+)
+
+func (r *PostgresRepository) GetRoles(ctx context.Context) ([]rbac.Role, error) {
+	rows, err := r.queries.GetRoles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rolePermissions, err := r.queries.GetRolePermissions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	permissions := map[string][]string{}
+	for _, rp := range rolePermissions {
+		permissions[rp.Role] = append(permissions[rp.Role], rp.Permission)
+	}
+
+	roles := make([]rbac.Role, 0, len(rows))
+
+	for _, row := range rows {
+		roles = append(roles, rbac.Role{
+			Name:        row.Name,
+			Description: row.Description,
+			Permissions: permissions[row.Name],
+		})
+	}
+
+	return roles, nil
+}
+
+func (r *PostgresRepository) GetUserRoles(ctx context.Context, userId string) ([]string, error) {
+	return r.queries.GetUserRoles(ctx, userId)
+}
+
+func (r *PostgresRepository) GetUserPermissions(ctx context.Context, userId string) ([]string, error) {
+	return r.queries.GetUserPermissions(ctx, userId)
+}
+
+func (r *PostgresRepository) AddUserRole(ctx context.Context, userId, role string) error {
+	p := postgres.AddUserRoleParams{
+		UserID: userId,
+		Role:   role,
+	}
+
+	return r.queries.AddUserRole(ctx, p)
+}
+
+func (r *PostgresRepository) DeleteUserRole(ctx context.Context, userId, role string) (bool, error) {
+	p := postgres.DeleteUserRoleParams{
+		UserID: userId,
+		Role:   role,
+	}
+
+	n, err := r.queries.DeleteUserRole(ctx, p)
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+func (r *PostgresRepository) CountUsersWithRole(ctx context.Context, role string) (int, error) {
+	n, err := r.queries.CountUsersWithRole(ctx, role)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(n), nil
+}
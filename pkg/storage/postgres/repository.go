@@ -2,6 +2,7 @@ package postgres
 
 import (
 	"context"
+	"errors"
 	"log"
 	"os"
 
@@ -11,66 +12,163 @@ import (
 )
 
 type PostgresRepository struct {
-	ctx     context.Context
 	queries *postgres.Queries
 }
 
 func NewPostgresRepository() *PostgresRepository {
-	ctx := context.Background()
-	conn, err := pgx.Connect(ctx, os.Getenv("DATABASE_URL"))
+	conn, err := pgx.Connect(context.Background(), os.Getenv("DATABASE_URL"))
 	if err != nil {
 		log.Fatal("Can't connect to the database", err)
 	}
 
-	queries := postgres.New(conn)
+	queries := postgres.New(newTimeoutConn(conn, queryTimeout))
 
 	return &PostgresRepository{
-		ctx:     ctx,
 		queries: queries,
 	}
 }
 
-func (r *PostgresRepository) AddUser(u user.User) (user.User, error) {
+func (r *PostgresRepository) AddUser(ctx context.Context, u user.User) (user.User, error) {
 	p := postgres.AddUserParams{
-		ID:    u.Id,
-		Name:  u.Name,
-		Email: u.Email,
+		ID:         u.Id,
+		Name:       u.Name,
+		Email:      u.Email,
+		VerifiedAt: u.VerifiedAt,
 	}
 
-	newUser, err := r.queries.AddUser(r.ctx, p)
+	newUser, err := r.queries.AddUser(ctx, p)
 	if err != nil {
 		return user.User{}, err
 	}
 
-	return user.User{
-		Id:    newUser.ID,
-		Name:  newUser.Name,
-		Email: newUser.Email,
-	}, nil
+	return toUser(newUser), nil
 }
 
-func (r *PostgresRepository) GetUserByEmail(email string) (user.User, error) {
-	u, err := r.queries.GetUserByEmail(r.ctx, email)
+func (r *PostgresRepository) GetUserByEmail(ctx context.Context, email string) (user.User, error) {
+	u, err := r.queries.GetUserByEmail(ctx, email)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return user.User{}, user.ErrUserNotFound
+	}
 	if err != nil {
 		return user.User{}, err
 	}
 
-	return user.User{
-		Id:    u.ID,
-		Email: u.Email,
-		Name:  u.Name,
-	}, nil
+	return toUser(u), nil
+}
+
+func (r *PostgresRepository) GetUserById(ctx context.Context, id string) (user.User, error) {
+	u, err := r.queries.GetUserById(ctx, id)
+	if err != nil {
+		return user.User{}, err
+	}
+
+	return toUser(u), nil
+}
+
+func (r *PostgresRepository) MarkUserVerified(ctx context.Context, id string) error {
+	return r.queries.MarkUserVerified(ctx, id)
+}
+
+func (r *PostgresRepository) UpdateUserName(ctx context.Context, id, name string) (user.User, error) {
+	p := postgres.UpdateUserNameParams{
+		ID:   id,
+		Name: name,
+	}
+
+	u, err := r.queries.UpdateUserName(ctx, p)
+	if err != nil {
+		return user.User{}, err
+	}
+
+	return toUser(u), nil
 }
 
-func (r *PostgresRepository) GetUserById(id string) (user.User, error) {
-	u, err := r.queries.GetUserById(r.ctx, id)
+func (r *PostgresRepository) UpdateUserEmail(ctx context.Context, id, email string) (user.User, error) {
+	p := postgres.UpdateUserEmailParams{
+		ID:    id,
+		Email: email,
+	}
+
+	u, err := r.queries.UpdateUserEmail(ctx, p)
 	if err != nil {
 		return user.User{}, err
 	}
 
+	return toUser(u), nil
+}
+
+func (r *PostgresRepository) SearchUsers(ctx context.Context, query string, limit, offset int) ([]user.User, int, error) {
+	p := postgres.SearchUsersParams{
+		Query:      query,
+		PageSize:   int32(limit),
+		PageOffset: int32(offset),
+	}
+
+	rows, err := r.queries.SearchUsers(ctx, p)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total, err := r.queries.CountUsers(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	users := make([]user.User, 0, len(rows))
+
+	for _, row := range rows {
+		users = append(users, toUser(row))
+	}
+
+	return users, int(total), nil
+}
+
+func (r *PostgresRepository) SetUserDisabled(ctx context.Context, id string, disabled bool) (bool, error) {
+	p := postgres.SetUserDisabledParams{
+		ID:       id,
+		Disabled: disabled,
+	}
+
+	n, err := r.queries.SetUserDisabled(ctx, p)
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+// IsUserDisabled returns false for users that don't exist, e.g. a provider
+// account that was never added to users.
+func (r *PostgresRepository) IsUserDisabled(ctx context.Context, id string) (bool, error) {
+	disabled, err := r.queries.IsUserDisabled(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+
+	return disabled, err
+}
+
+func (r *PostgresRepository) DeleteUser(ctx context.Context, id string) (bool, error) {
+	n, err := r.queries.DeleteUser(ctx, id)
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+func (r *PostgresRepository) RevokeAllSessions(ctx context.Context, userId string) error {
+	return r.queries.RevokeAllSessions(ctx, userId)
+}
+
+// helpers
+func toUser(u postgres.User) user.User {
 	return user.User{
-		Id:    u.ID,
-		Email: u.Email,
-		Name:  u.Name,
-	}, nil
+		Id:         u.ID,
+		Email:      u.Email,
+		Name:       u.Name,
+		VerifiedAt: u.VerifiedAt,
+		CreatedAt:  u.CreatedAt,
+		DisabledAt: u.DisabledAt,
+	}
 }
@@ -0,0 +1,80 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/cativovo/go-demo-auth/pkg/auth"
+	postgres "github.com/cativovo/go-demo-auth/pkg/storage/postgres/sqlc_generated"
+	"github.com/jackc/pgx/v5"
+)
+
+func (r *PostgresRepository) TouchSession(ctx context.Context, s auth.Session) (bool, error) {
+	p := postgres.TouchSessionParams{
+		ID:        s.Id,
+		UserID:    s.UserId,
+		UserAgent: s.UserAgent,
+		Ip:        s.IP,
+	}
+
+	_, err := r.queries.TouchSession(ctx, p)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (r *PostgresRepository) GetActiveSessions(ctx context.Context, userId string, seenAfter time.Time) ([]auth.Session, error) {
+	p := postgres.GetActiveSessionsByUserIdParams{
+		UserID:    userId,
+		SeenAfter: seenAfter,
+	}
+
+	rows, err := r.queries.GetActiveSessionsByUserId(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]auth.Session, 0, len(rows))
+
+	for _, row := range rows {
+		sessions = append(sessions, auth.Session{
+			Id:         row.ID,
+			UserId:     row.UserID,
+			UserAgent:  row.UserAgent,
+			IP:         row.Ip,
+			CreatedAt:  row.CreatedAt,
+			LastSeenAt: row.LastSeenAt,
+		})
+	}
+
+	return sessions, nil
+}
+
+func (r *PostgresRepository) RevokeSession(ctx context.Context, userId, sessionId string) (bool, error) {
+	p := postgres.RevokeSessionParams{
+		ID:     sessionId,
+		UserID: userId,
+	}
+
+	n, err := r.queries.RevokeSession(ctx, p)
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+func (r *PostgresRepository) RevokeOtherSessions(ctx context.Context, userId, currentSessionId string) error {
+	p := postgres.RevokeOtherSessionsParams{
+		UserID:    userId,
+		CurrentID: currentSessionId,
+	}
+
+	return r.queries.RevokeOtherSessions(ctx, p)
+}
@@ -4,10 +4,205 @@
 
 package postgres
 
-import ()
+import (
+	"time"
+)
+
+type ApiToken struct {
+	ID         string
+	UserID     string
+	Name       string
+	TokenHash  string
+	Scopes     []string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	LastUsedAt *time.Time
+}
+
+type AuditEvent struct {
+	ID        string
+	UserID    string
+	Email     string
+	Action    string
+	Outcome   string
+	Detail    string
+	Ip        string
+	UserAgent string
+	CreatedAt time.Time
+}
+
+type BrowserSession struct {
+	IDHash    string
+	UserID    string
+	Token     []byte
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+type Invitation struct {
+	ID        string
+	OrgID     string
+	Email     string
+	Role      string
+	TokenHash string
+	InvitedBy string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+type LocalCredential struct {
+	UserID       string
+	Email        string
+	PasswordHash string
+}
+
+type LocalSession struct {
+	ID               string
+	UserID           string
+	RefreshTokenHash string
+	ExpiresAt        time.Time
+	CreatedAt        time.Time
+}
+
+type LoginChallenge struct {
+	IDHash         string
+	UserID         string
+	AccessToken    string
+	RefreshToken   string
+	TokenExpiresIn int32
+	TokenExpiresAt int64
+	Attempts       int32
+	ExpiresAt      time.Time
+}
+
+type LoginFailure struct {
+	Key             string
+	Failures        int32
+	LastFailureAt   time.Time
+	LockedUntil     *time.Time
+	UnlockTokenHash string
+}
+
+type Membership struct {
+	OrgID     string
+	UserID    string
+	Role      string
+	CreatedAt time.Time
+}
+
+type OauthAuthorizationCode struct {
+	CodeHash      string
+	ClientID      string
+	UserID        string
+	RedirectUri   string
+	Scope         string
+	Nonce         string
+	CodeChallenge string
+	ExpiresAt     time.Time
+}
+
+type OauthClient struct {
+	ID           string
+	Name         string
+	SecretHash   string
+	RedirectUris []string
+	CreatedAt    time.Time
+}
+
+type OauthConsent struct {
+	UserID    string
+	ClientID  string
+	Scope     string
+	CreatedAt time.Time
+}
+
+type OidcIdentity struct {
+	Provider  string
+	Subject   string
+	UserID    string
+	Email     string
+	CreatedAt time.Time
+}
+
+type OneTimeToken struct {
+	TokenHash string
+	Purpose   string
+	UserID    string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	Email     string
+}
+
+type Organization struct {
+	ID        string
+	Name      string
+	CreatedAt time.Time
+}
+
+type Permission struct {
+	Name        string
+	Description string
+}
+
+type RateLimitBucket struct {
+	Key       string
+	Tokens    float64
+	UpdatedAt time.Time
+}
+
+type Role struct {
+	Name        string
+	Description string
+}
+
+type RolePermission struct {
+	Role       string
+	Permission string
+}
+
+type Session struct {
+	ID         string
+	UserID     string
+	UserAgent  string
+	Ip         string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	RevokedAt  *time.Time
+}
+
+type TotpSecret struct {
+	UserID       string
+	Secret       string
+	ConfirmedAt  *time.Time
+	LastUsedStep int64
+	CreatedAt    time.Time
+}
 
 type User struct {
-	ID    string
-	Email string
-	Name  string
+	ID         string
+	Email      string
+	Name       string
+	VerifiedAt *time.Time
+	CreatedAt  time.Time
+	DisabledAt *time.Time
+}
+
+type UserRole struct {
+	UserID    string
+	Role      string
+	CreatedAt time.Time
+}
+
+type WebauthnCredential struct {
+	ID         []byte
+	UserID     string
+	Credential []byte
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+}
+
+type WebauthnSession struct {
+	IDHash    string
+	Data      []byte
+	ExpiresAt time.Time
 }
@@ -7,48 +7,1955 @@ package postgres
 
 import (
 	"context"
+	"time"
 )
 
+const addAPIToken = `-- name: AddAPIToken :one
+INSERT INTO api_tokens (
+  user_id, name, token_hash, scopes, expires_at
+) VALUES (
+  $1, $2, $3, $4, $5
+)
+RETURNING id, user_id, name, token_hash, scopes, created_at, expires_at, last_used_at
+`
+
+type AddAPITokenParams struct {
+	UserID    string
+	Name      string
+	TokenHash string
+	Scopes    []string
+	ExpiresAt time.Time
+}
+
+func (q *Queries) AddAPIToken(ctx context.Context, arg AddAPITokenParams) (ApiToken, error) {
+	row := q.db.QueryRow(ctx, addAPIToken,
+		arg.UserID,
+		arg.Name,
+		arg.TokenHash,
+		arg.Scopes,
+		arg.ExpiresAt,
+	)
+	var i ApiToken
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Name,
+		&i.TokenHash,
+		&i.Scopes,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.LastUsedAt,
+	)
+	return i, err
+}
+
+const addAuditEvent = `-- name: AddAuditEvent :exec
+INSERT INTO audit_events (
+  user_id, email, action, outcome, detail, ip, user_agent
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7
+)
+`
+
+type AddAuditEventParams struct {
+	UserID    string
+	Email     string
+	Action    string
+	Outcome   string
+	Detail    string
+	Ip        string
+	UserAgent string
+}
+
+func (q *Queries) AddAuditEvent(ctx context.Context, arg AddAuditEventParams) error {
+	_, err := q.db.Exec(ctx, addAuditEvent,
+		arg.UserID,
+		arg.Email,
+		arg.Action,
+		arg.Outcome,
+		arg.Detail,
+		arg.Ip,
+		arg.UserAgent,
+	)
+	return err
+}
+
+const addAuthorizationCode = `-- name: AddAuthorizationCode :exec
+INSERT INTO oauth_authorization_codes (
+  code_hash, client_id, user_id, redirect_uri, scope, nonce, code_challenge, expires_at
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8
+)
+`
+
+type AddAuthorizationCodeParams struct {
+	CodeHash      string
+	ClientID      string
+	UserID        string
+	RedirectUri   string
+	Scope         string
+	Nonce         string
+	CodeChallenge string
+	ExpiresAt     time.Time
+}
+
+func (q *Queries) AddAuthorizationCode(ctx context.Context, arg AddAuthorizationCodeParams) error {
+	_, err := q.db.Exec(ctx, addAuthorizationCode,
+		arg.CodeHash,
+		arg.ClientID,
+		arg.UserID,
+		arg.RedirectUri,
+		arg.Scope,
+		arg.Nonce,
+		arg.CodeChallenge,
+		arg.ExpiresAt,
+	)
+	return err
+}
+
+const addBrowserSession = `-- name: AddBrowserSession :exec
+INSERT INTO browser_sessions (
+  id_hash, user_id, token, created_at, expires_at
+) VALUES (
+  $1, $2, $3, $4, $5
+)
+`
+
+type AddBrowserSessionParams struct {
+	IDHash    string
+	UserID    string
+	Token     []byte
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+func (q *Queries) AddBrowserSession(ctx context.Context, arg AddBrowserSessionParams) error {
+	_, err := q.db.Exec(ctx, addBrowserSession,
+		arg.IDHash,
+		arg.UserID,
+		arg.Token,
+		arg.CreatedAt,
+		arg.ExpiresAt,
+	)
+	return err
+}
+
+const addInvitation = `-- name: AddInvitation :one
+INSERT INTO invitations (
+  org_id, email, role, token_hash, invited_by, expires_at
+) VALUES (
+  $1, $2, $3, $4, $5, $6
+)
+RETURNING id, org_id, email, role, token_hash, invited_by, created_at, expires_at
+`
+
+type AddInvitationParams struct {
+	OrgID     string
+	Email     string
+	Role      string
+	TokenHash string
+	InvitedBy string
+	ExpiresAt time.Time
+}
+
+func (q *Queries) AddInvitation(ctx context.Context, arg AddInvitationParams) (Invitation, error) {
+	row := q.db.QueryRow(ctx, addInvitation,
+		arg.OrgID,
+		arg.Email,
+		arg.Role,
+		arg.TokenHash,
+		arg.InvitedBy,
+		arg.ExpiresAt,
+	)
+	var i Invitation
+	err := row.Scan(
+		&i.ID,
+		&i.OrgID,
+		&i.Email,
+		&i.Role,
+		&i.TokenHash,
+		&i.InvitedBy,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
+
+const addLocalCredentials = `-- name: AddLocalCredentials :one
+INSERT INTO local_credentials (
+  email, password_hash
+) VALUES (
+  lower($1), $2
+)
+RETURNING user_id, email, password_hash
+`
+
+type AddLocalCredentialsParams struct {
+	Email        string
+	PasswordHash string
+}
+
+func (q *Queries) AddLocalCredentials(ctx context.Context, arg AddLocalCredentialsParams) (LocalCredential, error) {
+	row := q.db.QueryRow(ctx, addLocalCredentials, arg.Email, arg.PasswordHash)
+	var i LocalCredential
+	err := row.Scan(&i.UserID, &i.Email, &i.PasswordHash)
+	return i, err
+}
+
+const addLocalSession = `-- name: AddLocalSession :one
+INSERT INTO local_sessions (
+  user_id, refresh_token_hash, expires_at
+) VALUES (
+  $1, $2, $3
+)
+RETURNING id, user_id, refresh_token_hash, expires_at, created_at
+`
+
+type AddLocalSessionParams struct {
+	UserID           string
+	RefreshTokenHash string
+	ExpiresAt        time.Time
+}
+
+func (q *Queries) AddLocalSession(ctx context.Context, arg AddLocalSessionParams) (LocalSession, error) {
+	row := q.db.QueryRow(ctx, addLocalSession, arg.UserID, arg.RefreshTokenHash, arg.ExpiresAt)
+	var i LocalSession
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.RefreshTokenHash,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const addLoginChallenge = `-- name: AddLoginChallenge :exec
+INSERT INTO login_challenges (
+  id_hash, user_id, access_token, refresh_token, token_expires_in, token_expires_at, expires_at
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7
+)
+`
+
+type AddLoginChallengeParams struct {
+	IDHash         string
+	UserID         string
+	AccessToken    string
+	RefreshToken   string
+	TokenExpiresIn int32
+	TokenExpiresAt int64
+	ExpiresAt      time.Time
+}
+
+func (q *Queries) AddLoginChallenge(ctx context.Context, arg AddLoginChallengeParams) error {
+	_, err := q.db.Exec(ctx, addLoginChallenge,
+		arg.IDHash,
+		arg.UserID,
+		arg.AccessToken,
+		arg.RefreshToken,
+		arg.TokenExpiresIn,
+		arg.TokenExpiresAt,
+		arg.ExpiresAt,
+	)
+	return err
+}
+
+const addMembership = `-- name: AddMembership :exec
+INSERT INTO memberships (
+  org_id, user_id, role
+) VALUES (
+  $1, $2, $3
+)
+ON CONFLICT (org_id, user_id) DO NOTHING
+`
+
+type AddMembershipParams struct {
+	OrgID  string
+	UserID string
+	Role   string
+}
+
+func (q *Queries) AddMembership(ctx context.Context, arg AddMembershipParams) error {
+	_, err := q.db.Exec(ctx, addMembership, arg.OrgID, arg.UserID, arg.Role)
+	return err
+}
+
+const addOIDCIdentity = `-- name: AddOIDCIdentity :exec
+INSERT INTO oidc_identities (
+  provider, subject, user_id, email
+) VALUES (
+  $1, $2, $3, $4
+)
+`
+
+type AddOIDCIdentityParams struct {
+	Provider string
+	Subject  string
+	UserID   string
+	Email    string
+}
+
+func (q *Queries) AddOIDCIdentity(ctx context.Context, arg AddOIDCIdentityParams) error {
+	_, err := q.db.Exec(ctx, addOIDCIdentity,
+		arg.Provider,
+		arg.Subject,
+		arg.UserID,
+		arg.Email,
+	)
+	return err
+}
+
+const addOneTimeToken = `-- name: AddOneTimeToken :exec
+INSERT INTO one_time_tokens (
+  token_hash, purpose, user_id, email, expires_at
+) VALUES (
+  $1, $2, $3, $4, $5
+)
+`
+
+type AddOneTimeTokenParams struct {
+	TokenHash string
+	Purpose   string
+	UserID    string
+	Email     string
+	ExpiresAt time.Time
+}
+
+func (q *Queries) AddOneTimeToken(ctx context.Context, arg AddOneTimeTokenParams) error {
+	_, err := q.db.Exec(ctx, addOneTimeToken,
+		arg.TokenHash,
+		arg.Purpose,
+		arg.UserID,
+		arg.Email,
+		arg.ExpiresAt,
+	)
+	return err
+}
+
+const addOrganization = `-- name: AddOrganization :one
+INSERT INTO organizations (
+  name
+) VALUES (
+  $1
+)
+RETURNING id, name, created_at
+`
+
+func (q *Queries) AddOrganization(ctx context.Context, name string) (Organization, error) {
+	row := q.db.QueryRow(ctx, addOrganization, name)
+	var i Organization
+	err := row.Scan(&i.ID, &i.Name, &i.CreatedAt)
+	return i, err
+}
+
 const addUser = `-- name: AddUser :one
 INSERT INTO users (
-  id, email, name
+  id, email, name, verified_at
+) VALUES (
+  $1, lower($2), $3, $4
+)
+RETURNING id, email, name, verified_at, created_at, disabled_at
+`
+
+type AddUserParams struct {
+	ID         string
+	Email      string
+	Name       string
+	VerifiedAt *time.Time
+}
+
+func (q *Queries) AddUser(ctx context.Context, arg AddUserParams) (User, error) {
+	row := q.db.QueryRow(ctx, addUser,
+		arg.ID,
+		arg.Email,
+		arg.Name,
+		arg.VerifiedAt,
+	)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.Name,
+		&i.VerifiedAt,
+		&i.CreatedAt,
+		&i.DisabledAt,
+	)
+	return i, err
+}
+
+const addUserRole = `-- name: AddUserRole :exec
+INSERT INTO user_roles (
+  user_id, role
+) VALUES (
+  $1, $2
+)
+ON CONFLICT DO NOTHING
+`
+
+type AddUserRoleParams struct {
+	UserID string
+	Role   string
+}
+
+func (q *Queries) AddUserRole(ctx context.Context, arg AddUserRoleParams) error {
+	_, err := q.db.Exec(ctx, addUserRole, arg.UserID, arg.Role)
+	return err
+}
+
+const addWebAuthnCredential = `-- name: AddWebAuthnCredential :exec
+INSERT INTO webauthn_credentials (
+  id, user_id, credential
+) VALUES (
+  $1, $2, $3
+)
+`
+
+type AddWebAuthnCredentialParams struct {
+	ID         []byte
+	UserID     string
+	Credential []byte
+}
+
+func (q *Queries) AddWebAuthnCredential(ctx context.Context, arg AddWebAuthnCredentialParams) error {
+	_, err := q.db.Exec(ctx, addWebAuthnCredential, arg.ID, arg.UserID, arg.Credential)
+	return err
+}
+
+const addWebAuthnSession = `-- name: AddWebAuthnSession :exec
+INSERT INTO webauthn_sessions (
+  id_hash, data, expires_at
 ) VALUES (
   $1, $2, $3
 )
-RETURNING id, email, name
 `
 
-type AddUserParams struct {
-	ID    string
-	Email string
-	Name  string
+type AddWebAuthnSessionParams struct {
+	IDHash    string
+	Data      []byte
+	ExpiresAt time.Time
+}
+
+func (q *Queries) AddWebAuthnSession(ctx context.Context, arg AddWebAuthnSessionParams) error {
+	_, err := q.db.Exec(ctx, addWebAuthnSession, arg.IDHash, arg.Data, arg.ExpiresAt)
+	return err
+}
+
+const confirmTOTPSecret = `-- name: ConfirmTOTPSecret :exec
+UPDATE totp_secrets SET confirmed_at = now() WHERE user_id=$1
+`
+
+func (q *Queries) ConfirmTOTPSecret(ctx context.Context, userID string) error {
+	_, err := q.db.Exec(ctx, confirmTOTPSecret, userID)
+	return err
+}
+
+const countAuditEvents = `-- name: CountAuditEvents :one
+SELECT count(*) FROM audit_events
+WHERE ($1::text = '' OR user_id = $1::text)
+  AND ($2::text = '' OR lower(email) = lower($2::text))
+  AND ($3::text = '' OR action LIKE $3::text || '%')
+  AND ($4::text = '' OR outcome = $4::text)
+  AND ($5::text = '' OR ip = $5::text)
+  AND ($6::timestamptz IS NULL OR created_at >= $6::timestamptz)
+  AND ($7::timestamptz IS NULL OR created_at < $7::timestamptz)
+`
+
+type CountAuditEventsParams struct {
+	UserID  string
+	Email   string
+	Action  string
+	Outcome string
+	Ip      string
+	Since   *time.Time
+	Until   *time.Time
+}
+
+func (q *Queries) CountAuditEvents(ctx context.Context, arg CountAuditEventsParams) (int64, error) {
+	row := q.db.QueryRow(ctx, countAuditEvents,
+		arg.UserID,
+		arg.Email,
+		arg.Action,
+		arg.Outcome,
+		arg.Ip,
+		arg.Since,
+		arg.Until,
+	)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countOrganizationOwners = `-- name: CountOrganizationOwners :one
+SELECT count(*) FROM memberships WHERE org_id=$1 AND role = 'owner'
+`
+
+func (q *Queries) CountOrganizationOwners(ctx context.Context, orgID string) (int64, error) {
+	row := q.db.QueryRow(ctx, countOrganizationOwners, orgID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countUsers = `-- name: CountUsers :one
+SELECT count(*) FROM users
+WHERE $1::text = ''
+  -- the query is matched literally, its wildcards are escaped
+  OR email ILIKE '%' || replace(replace(replace($1::text, '\', '\\'), '%', '\%'), '_', '\_') || '%' ESCAPE '\'
+  OR name ILIKE '%' || replace(replace(replace($1::text, '\', '\\'), '%', '\%'), '_', '\_') || '%' ESCAPE '\'
+`
+
+func (q *Queries) CountUsers(ctx context.Context, query string) (int64, error) {
+	row := q.db.QueryRow(ctx, countUsers, query)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countUsersWithRole = `-- name: CountUsersWithRole :one
+SELECT count(*) FROM user_roles WHERE role=$1
+`
+
+func (q *Queries) CountUsersWithRole(ctx context.Context, role string) (int64, error) {
+	row := q.db.QueryRow(ctx, countUsersWithRole, role)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const deleteAPIToken = `-- name: DeleteAPIToken :execrows
+DELETE FROM api_tokens WHERE id = $1 AND user_id = $2
+`
+
+type DeleteAPITokenParams struct {
+	ID     string
+	UserID string
+}
+
+func (q *Queries) DeleteAPIToken(ctx context.Context, arg DeleteAPITokenParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteAPIToken, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteBrowserSession = `-- name: DeleteBrowserSession :exec
+DELETE FROM browser_sessions WHERE id_hash=$1
+`
+
+func (q *Queries) DeleteBrowserSession(ctx context.Context, idHash string) error {
+	_, err := q.db.Exec(ctx, deleteBrowserSession, idHash)
+	return err
+}
+
+const deleteExpiredBrowserSessions = `-- name: DeleteExpiredBrowserSessions :exec
+DELETE FROM browser_sessions WHERE expires_at <= now()
+`
+
+func (q *Queries) DeleteExpiredBrowserSessions(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, deleteExpiredBrowserSessions)
+	return err
+}
+
+const deleteInvitation = `-- name: DeleteInvitation :execrows
+DELETE FROM invitations WHERE id = $1 AND org_id = $2
+`
+
+type DeleteInvitationParams struct {
+	ID    string
+	OrgID string
+}
+
+func (q *Queries) DeleteInvitation(ctx context.Context, arg DeleteInvitationParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteInvitation, arg.ID, arg.OrgID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteLocalCredentials = `-- name: DeleteLocalCredentials :exec
+DELETE FROM local_credentials WHERE user_id=$1
+`
+
+func (q *Queries) DeleteLocalCredentials(ctx context.Context, userID string) error {
+	_, err := q.db.Exec(ctx, deleteLocalCredentials, userID)
+	return err
+}
+
+const deleteLocalSessionById = `-- name: DeleteLocalSessionById :exec
+DELETE FROM local_sessions WHERE id=$1
+`
+
+func (q *Queries) DeleteLocalSessionById(ctx context.Context, id string) error {
+	_, err := q.db.Exec(ctx, deleteLocalSessionById, id)
+	return err
+}
+
+const deleteLocalSessionByIdAndUserId = `-- name: DeleteLocalSessionByIdAndUserId :exec
+DELETE FROM local_sessions WHERE id = $1 AND user_id = $2
+`
+
+type DeleteLocalSessionByIdAndUserIdParams struct {
+	ID     string
+	UserID string
+}
+
+func (q *Queries) DeleteLocalSessionByIdAndUserId(ctx context.Context, arg DeleteLocalSessionByIdAndUserIdParams) error {
+	_, err := q.db.Exec(ctx, deleteLocalSessionByIdAndUserId, arg.ID, arg.UserID)
+	return err
+}
+
+const deleteLocalSessionsByUserId = `-- name: DeleteLocalSessionsByUserId :exec
+DELETE FROM local_sessions WHERE user_id=$1
+`
+
+func (q *Queries) DeleteLocalSessionsByUserId(ctx context.Context, userID string) error {
+	_, err := q.db.Exec(ctx, deleteLocalSessionsByUserId, userID)
+	return err
+}
+
+const deleteLoginChallenge = `-- name: DeleteLoginChallenge :exec
+DELETE FROM login_challenges WHERE id_hash=$1
+`
+
+func (q *Queries) DeleteLoginChallenge(ctx context.Context, idHash string) error {
+	_, err := q.db.Exec(ctx, deleteLoginChallenge, idHash)
+	return err
+}
+
+const deleteLoginFailures = `-- name: DeleteLoginFailures :exec
+DELETE FROM login_failures WHERE key=$1
+`
+
+func (q *Queries) DeleteLoginFailures(ctx context.Context, key string) error {
+	_, err := q.db.Exec(ctx, deleteLoginFailures, key)
+	return err
+}
+
+const deleteMembership = `-- name: DeleteMembership :execrows
+DELETE FROM memberships WHERE org_id = $1 AND user_id = $2
+`
+
+type DeleteMembershipParams struct {
+	OrgID  string
+	UserID string
+}
+
+func (q *Queries) DeleteMembership(ctx context.Context, arg DeleteMembershipParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteMembership, arg.OrgID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteOneTimeTokensByUserId = `-- name: DeleteOneTimeTokensByUserId :exec
+DELETE FROM one_time_tokens WHERE user_id=$1
+`
+
+func (q *Queries) DeleteOneTimeTokensByUserId(ctx context.Context, userID string) error {
+	_, err := q.db.Exec(ctx, deleteOneTimeTokensByUserId, userID)
+	return err
+}
+
+const deleteOtherLocalSessions = `-- name: DeleteOtherLocalSessions :exec
+DELETE FROM local_sessions WHERE user_id = $1 AND id <> $2
+`
+
+type DeleteOtherLocalSessionsParams struct {
+	UserID    string
+	CurrentID string
+}
+
+func (q *Queries) DeleteOtherLocalSessions(ctx context.Context, arg DeleteOtherLocalSessionsParams) error {
+	_, err := q.db.Exec(ctx, deleteOtherLocalSessions, arg.UserID, arg.CurrentID)
+	return err
+}
+
+const deleteStaleRateLimitBuckets = `-- name: DeleteStaleRateLimitBuckets :exec
+DELETE FROM rate_limit_buckets WHERE updated_at < $1
+`
+
+func (q *Queries) DeleteStaleRateLimitBuckets(ctx context.Context, updatedBefore time.Time) error {
+	_, err := q.db.Exec(ctx, deleteStaleRateLimitBuckets, updatedBefore)
+	return err
+}
+
+const deleteTOTPSecret = `-- name: DeleteTOTPSecret :exec
+DELETE FROM totp_secrets WHERE user_id=$1
+`
+
+func (q *Queries) DeleteTOTPSecret(ctx context.Context, userID string) error {
+	_, err := q.db.Exec(ctx, deleteTOTPSecret, userID)
+	return err
+}
+
+const deleteUser = `-- name: DeleteUser :execrows
+DELETE FROM users WHERE id=$1
+`
+
+func (q *Queries) DeleteUser(ctx context.Context, id string) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteUser, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteUserRole = `-- name: DeleteUserRole :execrows
+DELETE FROM user_roles WHERE user_id = $1 AND role = $2
+`
+
+type DeleteUserRoleParams struct {
+	UserID string
+	Role   string
+}
+
+func (q *Queries) DeleteUserRole(ctx context.Context, arg DeleteUserRoleParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteUserRole, arg.UserID, arg.Role)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const getAPITokenByHash = `-- name: GetAPITokenByHash :one
+SELECT id, user_id, name, token_hash, scopes, created_at, expires_at, last_used_at FROM api_tokens WHERE token_hash=$1 AND expires_at > now()
+`
+
+func (q *Queries) GetAPITokenByHash(ctx context.Context, tokenHash string) (ApiToken, error) {
+	row := q.db.QueryRow(ctx, getAPITokenByHash, tokenHash)
+	var i ApiToken
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Name,
+		&i.TokenHash,
+		&i.Scopes,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.LastUsedAt,
+	)
+	return i, err
+}
+
+const getAPITokensByUserId = `-- name: GetAPITokensByUserId :many
+SELECT id, user_id, name, token_hash, scopes, created_at, expires_at, last_used_at FROM api_tokens WHERE user_id=$1 ORDER BY created_at DESC
+`
+
+func (q *Queries) GetAPITokensByUserId(ctx context.Context, userID string) ([]ApiToken, error) {
+	rows, err := q.db.Query(ctx, getAPITokensByUserId, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ApiToken
+	for rows.Next() {
+		var i ApiToken
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Name,
+			&i.TokenHash,
+			&i.Scopes,
+			&i.CreatedAt,
+			&i.ExpiresAt,
+			&i.LastUsedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getActiveSessionsByUserId = `-- name: GetActiveSessionsByUserId :many
+SELECT id, user_id, user_agent, ip, created_at, last_seen_at, revoked_at FROM sessions
+WHERE user_id = $1 AND revoked_at IS NULL AND last_seen_at > $2
+ORDER BY last_seen_at DESC
+`
+
+type GetActiveSessionsByUserIdParams struct {
+	UserID    string
+	SeenAfter time.Time
+}
+
+func (q *Queries) GetActiveSessionsByUserId(ctx context.Context, arg GetActiveSessionsByUserIdParams) ([]Session, error) {
+	rows, err := q.db.Query(ctx, getActiveSessionsByUserId, arg.UserID, arg.SeenAfter)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Session
+	for rows.Next() {
+		var i Session
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.UserAgent,
+			&i.Ip,
+			&i.CreatedAt,
+			&i.LastSeenAt,
+			&i.RevokedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getAuditEventsByUser = `-- name: GetAuditEventsByUser :many
+SELECT id, user_id, email, action, outcome, detail, ip, user_agent, created_at FROM audit_events
+WHERE user_id = $1
+  OR (user_id = '' AND $2::text <> '' AND lower(email) = lower($2::text))
+ORDER BY created_at DESC
+LIMIT $3
+`
+
+type GetAuditEventsByUserParams struct {
+	UserID   string
+	Email    string
+	PageSize int32
+}
+
+func (q *Queries) GetAuditEventsByUser(ctx context.Context, arg GetAuditEventsByUserParams) ([]AuditEvent, error) {
+	rows, err := q.db.Query(ctx, getAuditEventsByUser, arg.UserID, arg.Email, arg.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AuditEvent
+	for rows.Next() {
+		var i AuditEvent
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Email,
+			&i.Action,
+			&i.Outcome,
+			&i.Detail,
+			&i.Ip,
+			&i.UserAgent,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getBrowserSession = `-- name: GetBrowserSession :one
+SELECT id_hash, user_id, token, created_at, expires_at FROM browser_sessions WHERE id_hash=$1 AND expires_at > now()
+`
+
+func (q *Queries) GetBrowserSession(ctx context.Context, idHash string) (BrowserSession, error) {
+	row := q.db.QueryRow(ctx, getBrowserSession, idHash)
+	var i BrowserSession
+	err := row.Scan(
+		&i.IDHash,
+		&i.UserID,
+		&i.Token,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
+
+const getConsent = `-- name: GetConsent :one
+SELECT user_id, client_id, scope, created_at FROM oauth_consents WHERE user_id=$1 AND client_id=$2
+`
+
+type GetConsentParams struct {
+	UserID   string
+	ClientID string
+}
+
+func (q *Queries) GetConsent(ctx context.Context, arg GetConsentParams) (OauthConsent, error) {
+	row := q.db.QueryRow(ctx, getConsent, arg.UserID, arg.ClientID)
+	var i OauthConsent
+	err := row.Scan(
+		&i.UserID,
+		&i.ClientID,
+		&i.Scope,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getInvitationByHash = `-- name: GetInvitationByHash :one
+SELECT id, org_id, email, role, token_hash, invited_by, created_at, expires_at FROM invitations WHERE token_hash=$1 AND expires_at > now()
+`
+
+func (q *Queries) GetInvitationByHash(ctx context.Context, tokenHash string) (Invitation, error) {
+	row := q.db.QueryRow(ctx, getInvitationByHash, tokenHash)
+	var i Invitation
+	err := row.Scan(
+		&i.ID,
+		&i.OrgID,
+		&i.Email,
+		&i.Role,
+		&i.TokenHash,
+		&i.InvitedBy,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
+
+const getInvitationsByOrgId = `-- name: GetInvitationsByOrgId :many
+SELECT id, org_id, email, role, token_hash, invited_by, created_at, expires_at FROM invitations WHERE org_id=$1 AND expires_at > now() ORDER BY created_at DESC
+`
+
+func (q *Queries) GetInvitationsByOrgId(ctx context.Context, orgID string) ([]Invitation, error) {
+	rows, err := q.db.Query(ctx, getInvitationsByOrgId, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Invitation
+	for rows.Next() {
+		var i Invitation
+		if err := rows.Scan(
+			&i.ID,
+			&i.OrgID,
+			&i.Email,
+			&i.Role,
+			&i.TokenHash,
+			&i.InvitedBy,
+			&i.CreatedAt,
+			&i.ExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getLocalCredentialsByEmail = `-- name: GetLocalCredentialsByEmail :one
+SELECT user_id, email, password_hash FROM local_credentials WHERE lower(email)=lower($1)
+`
+
+func (q *Queries) GetLocalCredentialsByEmail(ctx context.Context, email string) (LocalCredential, error) {
+	row := q.db.QueryRow(ctx, getLocalCredentialsByEmail, email)
+	var i LocalCredential
+	err := row.Scan(&i.UserID, &i.Email, &i.PasswordHash)
+	return i, err
+}
+
+const getLocalCredentialsByUserId = `-- name: GetLocalCredentialsByUserId :one
+SELECT user_id, email, password_hash FROM local_credentials WHERE user_id=$1
+`
+
+func (q *Queries) GetLocalCredentialsByUserId(ctx context.Context, userID string) (LocalCredential, error) {
+	row := q.db.QueryRow(ctx, getLocalCredentialsByUserId, userID)
+	var i LocalCredential
+	err := row.Scan(&i.UserID, &i.Email, &i.PasswordHash)
+	return i, err
+}
+
+const getLocalSessionById = `-- name: GetLocalSessionById :one
+SELECT id, user_id, refresh_token_hash, expires_at, created_at FROM local_sessions WHERE id=$1 AND expires_at > now()
+`
+
+func (q *Queries) GetLocalSessionById(ctx context.Context, id string) (LocalSession, error) {
+	row := q.db.QueryRow(ctx, getLocalSessionById, id)
+	var i LocalSession
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.RefreshTokenHash,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+	return i, err
 }
 
-func (q *Queries) AddUser(ctx context.Context, arg AddUserParams) (User, error) {
-	row := q.db.QueryRow(ctx, addUser, arg.ID, arg.Email, arg.Name)
-	var i User
-	err := row.Scan(&i.ID, &i.Email, &i.Name)
+const getLoginChallenge = `-- name: GetLoginChallenge :one
+SELECT id_hash, user_id, access_token, refresh_token, token_expires_in, token_expires_at, attempts, expires_at FROM login_challenges WHERE id_hash=$1
+`
+
+func (q *Queries) GetLoginChallenge(ctx context.Context, idHash string) (LoginChallenge, error) {
+	row := q.db.QueryRow(ctx, getLoginChallenge, idHash)
+	var i LoginChallenge
+	err := row.Scan(
+		&i.IDHash,
+		&i.UserID,
+		&i.AccessToken,
+		&i.RefreshToken,
+		&i.TokenExpiresIn,
+		&i.TokenExpiresAt,
+		&i.Attempts,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
+
+const getLoginFailures = `-- name: GetLoginFailures :one
+SELECT key, failures, last_failure_at, locked_until, unlock_token_hash FROM login_failures WHERE key=$1
+`
+
+func (q *Queries) GetLoginFailures(ctx context.Context, key string) (LoginFailure, error) {
+	row := q.db.QueryRow(ctx, getLoginFailures, key)
+	var i LoginFailure
+	err := row.Scan(
+		&i.Key,
+		&i.Failures,
+		&i.LastFailureAt,
+		&i.LockedUntil,
+		&i.UnlockTokenHash,
+	)
+	return i, err
+}
+
+const getMembers = `-- name: GetMembers :many
+SELECT u.id, u.email, u.name, m.role, m.created_at
+FROM memberships m
+JOIN users u ON u.id = m.user_id
+WHERE m.org_id = $1
+ORDER BY u.email
+`
+
+type GetMembersRow struct {
+	ID        string
+	Email     string
+	Name      string
+	Role      string
+	CreatedAt time.Time
+}
+
+func (q *Queries) GetMembers(ctx context.Context, orgID string) ([]GetMembersRow, error) {
+	rows, err := q.db.Query(ctx, getMembers, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetMembersRow
+	for rows.Next() {
+		var i GetMembersRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Email,
+			&i.Name,
+			&i.Role,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getMembershipsByUserId = `-- name: GetMembershipsByUserId :many
+SELECT o.id, o.name, o.created_at, m.role
+FROM memberships m
+JOIN organizations o ON o.id = m.org_id
+WHERE m.user_id = $1
+ORDER BY o.name, o.id
+`
+
+type GetMembershipsByUserIdRow struct {
+	ID        string
+	Name      string
+	CreatedAt time.Time
+	Role      string
+}
+
+func (q *Queries) GetMembershipsByUserId(ctx context.Context, userID string) ([]GetMembershipsByUserIdRow, error) {
+	rows, err := q.db.Query(ctx, getMembershipsByUserId, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetMembershipsByUserIdRow
+	for rows.Next() {
+		var i GetMembershipsByUserIdRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.CreatedAt,
+			&i.Role,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getOAuthClient = `-- name: GetOAuthClient :one
+SELECT id, name, secret_hash, redirect_uris, created_at FROM oauth_clients WHERE id=$1
+`
+
+func (q *Queries) GetOAuthClient(ctx context.Context, id string) (OauthClient, error) {
+	row := q.db.QueryRow(ctx, getOAuthClient, id)
+	var i OauthClient
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.SecretHash,
+		&i.RedirectUris,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getOIDCIdentity = `-- name: GetOIDCIdentity :one
+SELECT provider, subject, user_id, email, created_at FROM oidc_identities WHERE provider=$1 AND subject=$2
+`
+
+type GetOIDCIdentityParams struct {
+	Provider string
+	Subject  string
+}
+
+func (q *Queries) GetOIDCIdentity(ctx context.Context, arg GetOIDCIdentityParams) (OidcIdentity, error) {
+	row := q.db.QueryRow(ctx, getOIDCIdentity, arg.Provider, arg.Subject)
+	var i OidcIdentity
+	err := row.Scan(
+		&i.Provider,
+		&i.Subject,
+		&i.UserID,
+		&i.Email,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getOrganizationById = `-- name: GetOrganizationById :one
+SELECT id, name, created_at FROM organizations WHERE id=$1
+`
+
+func (q *Queries) GetOrganizationById(ctx context.Context, id string) (Organization, error) {
+	row := q.db.QueryRow(ctx, getOrganizationById, id)
+	var i Organization
+	err := row.Scan(&i.ID, &i.Name, &i.CreatedAt)
+	return i, err
+}
+
+const getRateLimitTokens = `-- name: GetRateLimitTokens :one
+SELECT LEAST($1::float8, tokens + EXTRACT(EPOCH FROM now() - updated_at)::float8 * $2::float8)::float8 AS tokens
+FROM rate_limit_buckets
+WHERE key = $3
+`
+
+type GetRateLimitTokensParams struct {
+	Burst float64
+	Rate  float64
+	Key   string
+}
+
+func (q *Queries) GetRateLimitTokens(ctx context.Context, arg GetRateLimitTokensParams) (float64, error) {
+	row := q.db.QueryRow(ctx, getRateLimitTokens, arg.Burst, arg.Rate, arg.Key)
+	var tokens float64
+	err := row.Scan(&tokens)
+	return tokens, err
+}
+
+const getRolePermissions = `-- name: GetRolePermissions :many
+SELECT role, permission FROM role_permissions ORDER BY role, permission
+`
+
+func (q *Queries) GetRolePermissions(ctx context.Context) ([]RolePermission, error) {
+	rows, err := q.db.Query(ctx, getRolePermissions)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RolePermission
+	for rows.Next() {
+		var i RolePermission
+		if err := rows.Scan(&i.Role, &i.Permission); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRoles = `-- name: GetRoles :many
+SELECT name, description FROM roles ORDER BY name
+`
+
+func (q *Queries) GetRoles(ctx context.Context) ([]Role, error) {
+	rows, err := q.db.Query(ctx, getRoles)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Role
+	for rows.Next() {
+		var i Role
+		if err := rows.Scan(&i.Name, &i.Description); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getTOTPSecret = `-- name: GetTOTPSecret :one
+SELECT user_id, secret, confirmed_at, last_used_step, created_at FROM totp_secrets WHERE user_id=$1
+`
+
+func (q *Queries) GetTOTPSecret(ctx context.Context, userID string) (TotpSecret, error) {
+	row := q.db.QueryRow(ctx, getTOTPSecret, userID)
+	var i TotpSecret
+	err := row.Scan(
+		&i.UserID,
+		&i.Secret,
+		&i.ConfirmedAt,
+		&i.LastUsedStep,
+		&i.CreatedAt,
+	)
 	return i, err
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, email, name FROM users WHERE email=$1
+SELECT id, email, name, verified_at, created_at, disabled_at FROM users WHERE lower(email)=lower($1)
 `
 
 func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
 	row := q.db.QueryRow(ctx, getUserByEmail, email)
 	var i User
-	err := row.Scan(&i.ID, &i.Email, &i.Name)
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.Name,
+		&i.VerifiedAt,
+		&i.CreatedAt,
+		&i.DisabledAt,
+	)
 	return i, err
 }
 
 const getUserById = `-- name: GetUserById :one
-SELECT id, email, name FROM users WHERE id=$1
+SELECT id, email, name, verified_at, created_at, disabled_at FROM users WHERE id=$1
 `
 
 func (q *Queries) GetUserById(ctx context.Context, id string) (User, error) {
 	row := q.db.QueryRow(ctx, getUserById, id)
 	var i User
-	err := row.Scan(&i.ID, &i.Email, &i.Name)
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.Name,
+		&i.VerifiedAt,
+		&i.CreatedAt,
+		&i.DisabledAt,
+	)
+	return i, err
+}
+
+const getUserPermissions = `-- name: GetUserPermissions :many
+SELECT DISTINCT rp.permission
+FROM user_roles ur
+JOIN role_permissions rp ON rp.role = ur.role
+WHERE ur.user_id = $1
+ORDER BY rp.permission
+`
+
+func (q *Queries) GetUserPermissions(ctx context.Context, userID string) ([]string, error) {
+	rows, err := q.db.Query(ctx, getUserPermissions, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var permission string
+		if err := rows.Scan(&permission); err != nil {
+			return nil, err
+		}
+		items = append(items, permission)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUserRoles = `-- name: GetUserRoles :many
+SELECT role FROM user_roles WHERE user_id=$1 ORDER BY role
+`
+
+func (q *Queries) GetUserRoles(ctx context.Context, userID string) ([]string, error) {
+	rows, err := q.db.Query(ctx, getUserRoles, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			return nil, err
+		}
+		items = append(items, role)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getWebAuthnCredentialsByUserId = `-- name: GetWebAuthnCredentialsByUserId :many
+SELECT id, user_id, credential, created_at, last_used_at FROM webauthn_credentials WHERE user_id=$1 ORDER BY created_at
+`
+
+func (q *Queries) GetWebAuthnCredentialsByUserId(ctx context.Context, userID string) ([]WebauthnCredential, error) {
+	rows, err := q.db.Query(ctx, getWebAuthnCredentialsByUserId, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebauthnCredential
+	for rows.Next() {
+		var i WebauthnCredential
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Credential,
+			&i.CreatedAt,
+			&i.LastUsedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const incrementLoginChallengeAttempts = `-- name: IncrementLoginChallengeAttempts :exec
+UPDATE login_challenges SET attempts = attempts + 1 WHERE id_hash=$1
+`
+
+func (q *Queries) IncrementLoginChallengeAttempts(ctx context.Context, idHash string) error {
+	_, err := q.db.Exec(ctx, incrementLoginChallengeAttempts, idHash)
+	return err
+}
+
+const isUserDisabled = `-- name: IsUserDisabled :one
+SELECT (disabled_at IS NOT NULL)::boolean AS disabled FROM users WHERE id=$1
+`
+
+func (q *Queries) IsUserDisabled(ctx context.Context, id string) (bool, error) {
+	row := q.db.QueryRow(ctx, isUserDisabled, id)
+	var disabled bool
+	err := row.Scan(&disabled)
+	return disabled, err
+}
+
+const lockLogin = `-- name: LockLogin :exec
+UPDATE login_failures
+SET failures = 0, locked_until = $1, unlock_token_hash = $2
+WHERE key = $3
+`
+
+type LockLoginParams struct {
+	LockedUntil     *time.Time
+	UnlockTokenHash string
+	Key             string
+}
+
+func (q *Queries) LockLogin(ctx context.Context, arg LockLoginParams) error {
+	_, err := q.db.Exec(ctx, lockLogin, arg.LockedUntil, arg.UnlockTokenHash, arg.Key)
+	return err
+}
+
+const markUserVerified = `-- name: MarkUserVerified :exec
+UPDATE users SET verified_at = now() WHERE id=$1 AND verified_at IS NULL
+`
+
+func (q *Queries) MarkUserVerified(ctx context.Context, id string) error {
+	_, err := q.db.Exec(ctx, markUserVerified, id)
+	return err
+}
+
+const recordLoginFailure = `-- name: RecordLoginFailure :one
+INSERT INTO login_failures (
+  key, failures, last_failure_at
+) VALUES (
+  $1, 1, now()
+)
+ON CONFLICT (key) DO UPDATE SET
+  failures = CASE
+    WHEN login_failures.last_failure_at < $2 THEN 1
+    ELSE login_failures.failures + 1
+  END,
+  last_failure_at = now()
+RETURNING key, failures, last_failure_at, locked_until, unlock_token_hash
+`
+
+type RecordLoginFailureParams struct {
+	Key         string
+	ResetBefore time.Time
+}
+
+func (q *Queries) RecordLoginFailure(ctx context.Context, arg RecordLoginFailureParams) (LoginFailure, error) {
+	row := q.db.QueryRow(ctx, recordLoginFailure, arg.Key, arg.ResetBefore)
+	var i LoginFailure
+	err := row.Scan(
+		&i.Key,
+		&i.Failures,
+		&i.LastFailureAt,
+		&i.LockedUntil,
+		&i.UnlockTokenHash,
+	)
+	return i, err
+}
+
+const revokeAllSessions = `-- name: RevokeAllSessions :exec
+UPDATE sessions SET revoked_at = now() WHERE user_id=$1 AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeAllSessions(ctx context.Context, userID string) error {
+	_, err := q.db.Exec(ctx, revokeAllSessions, userID)
+	return err
+}
+
+const revokeOtherSessions = `-- name: RevokeOtherSessions :exec
+UPDATE sessions SET revoked_at = now()
+WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL
+`
+
+type RevokeOtherSessionsParams struct {
+	UserID    string
+	CurrentID string
+}
+
+func (q *Queries) RevokeOtherSessions(ctx context.Context, arg RevokeOtherSessionsParams) error {
+	_, err := q.db.Exec(ctx, revokeOtherSessions, arg.UserID, arg.CurrentID)
+	return err
+}
+
+const revokeSession = `-- name: RevokeSession :execrows
+UPDATE sessions SET revoked_at = now()
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+`
+
+type RevokeSessionParams struct {
+	ID     string
+	UserID string
+}
+
+func (q *Queries) RevokeSession(ctx context.Context, arg RevokeSessionParams) (int64, error) {
+	result, err := q.db.Exec(ctx, revokeSession, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const rotateLocalSession = `-- name: RotateLocalSession :one
+UPDATE local_sessions
+SET refresh_token_hash = $1, expires_at = $2
+WHERE refresh_token_hash = $3 AND expires_at > now()
+RETURNING id, user_id, refresh_token_hash, expires_at, created_at
+`
+
+type RotateLocalSessionParams struct {
+	NewRefreshTokenHash string
+	ExpiresAt           time.Time
+	RefreshTokenHash    string
+}
+
+func (q *Queries) RotateLocalSession(ctx context.Context, arg RotateLocalSessionParams) (LocalSession, error) {
+	row := q.db.QueryRow(ctx, rotateLocalSession, arg.NewRefreshTokenHash, arg.ExpiresAt, arg.RefreshTokenHash)
+	var i LocalSession
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.RefreshTokenHash,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const saveConsent = `-- name: SaveConsent :exec
+INSERT INTO oauth_consents (
+  user_id, client_id, scope
+) VALUES (
+  $1, $2, $3
+)
+ON CONFLICT (user_id, client_id) DO UPDATE SET scope = EXCLUDED.scope
+`
+
+type SaveConsentParams struct {
+	UserID   string
+	ClientID string
+	Scope    string
+}
+
+func (q *Queries) SaveConsent(ctx context.Context, arg SaveConsentParams) error {
+	_, err := q.db.Exec(ctx, saveConsent, arg.UserID, arg.ClientID, arg.Scope)
+	return err
+}
+
+const saveTOTPSecret = `-- name: SaveTOTPSecret :exec
+INSERT INTO totp_secrets (
+  user_id, secret
+) VALUES (
+  $1, $2
+)
+ON CONFLICT (user_id) DO UPDATE
+SET secret = EXCLUDED.secret, last_used_step = 0, created_at = now()
+WHERE totp_secrets.confirmed_at IS NULL
+`
+
+type SaveTOTPSecretParams struct {
+	UserID string
+	Secret string
+}
+
+func (q *Queries) SaveTOTPSecret(ctx context.Context, arg SaveTOTPSecretParams) error {
+	_, err := q.db.Exec(ctx, saveTOTPSecret, arg.UserID, arg.Secret)
+	return err
+}
+
+const searchAuditEvents = `-- name: SearchAuditEvents :many
+SELECT id, user_id, email, action, outcome, detail, ip, user_agent, created_at FROM audit_events
+WHERE ($1::text = '' OR user_id = $1::text)
+  AND ($2::text = '' OR lower(email) = lower($2::text))
+  AND ($3::text = '' OR action LIKE $3::text || '%')
+  AND ($4::text = '' OR outcome = $4::text)
+  AND ($5::text = '' OR ip = $5::text)
+  AND ($6::timestamptz IS NULL OR created_at >= $6::timestamptz)
+  AND ($7::timestamptz IS NULL OR created_at < $7::timestamptz)
+ORDER BY created_at DESC, id
+LIMIT $9 OFFSET $8
+`
+
+type SearchAuditEventsParams struct {
+	UserID     string
+	Email      string
+	Action     string
+	Outcome    string
+	Ip         string
+	Since      *time.Time
+	Until      *time.Time
+	PageOffset int32
+	PageSize   int32
+}
+
+func (q *Queries) SearchAuditEvents(ctx context.Context, arg SearchAuditEventsParams) ([]AuditEvent, error) {
+	rows, err := q.db.Query(ctx, searchAuditEvents,
+		arg.UserID,
+		arg.Email,
+		arg.Action,
+		arg.Outcome,
+		arg.Ip,
+		arg.Since,
+		arg.Until,
+		arg.PageOffset,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AuditEvent
+	for rows.Next() {
+		var i AuditEvent
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Email,
+			&i.Action,
+			&i.Outcome,
+			&i.Detail,
+			&i.Ip,
+			&i.UserAgent,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const searchUsers = `-- name: SearchUsers :many
+SELECT id, email, name, verified_at, created_at, disabled_at FROM users
+WHERE $1::text = ''
+  -- the query is matched literally, its wildcards are escaped
+  OR email ILIKE '%' || replace(replace(replace($1::text, '\', '\\'), '%', '\%'), '_', '\_') || '%' ESCAPE '\'
+  OR name ILIKE '%' || replace(replace(replace($1::text, '\', '\\'), '%', '\%'), '_', '\_') || '%' ESCAPE '\'
+ORDER BY created_at DESC, id
+LIMIT $3 OFFSET $2
+`
+
+type SearchUsersParams struct {
+	Query      string
+	PageOffset int32
+	PageSize   int32
+}
+
+func (q *Queries) SearchUsers(ctx context.Context, arg SearchUsersParams) ([]User, error) {
+	rows, err := q.db.Query(ctx, searchUsers, arg.Query, arg.PageOffset, arg.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.Email,
+			&i.Name,
+			&i.VerifiedAt,
+			&i.CreatedAt,
+			&i.DisabledAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setUserDisabled = `-- name: SetUserDisabled :execrows
+UPDATE users
+SET disabled_at = CASE WHEN $1::boolean THEN coalesce(disabled_at, now()) END
+WHERE id = $2
+`
+
+type SetUserDisabledParams struct {
+	Disabled bool
+	ID       string
+}
+
+func (q *Queries) SetUserDisabled(ctx context.Context, arg SetUserDisabledParams) (int64, error) {
+	result, err := q.db.Exec(ctx, setUserDisabled, arg.Disabled, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const takeAuthorizationCode = `-- name: TakeAuthorizationCode :one
+DELETE FROM oauth_authorization_codes WHERE code_hash=$1 RETURNING code_hash, client_id, user_id, redirect_uri, scope, nonce, code_challenge, expires_at
+`
+
+func (q *Queries) TakeAuthorizationCode(ctx context.Context, codeHash string) (OauthAuthorizationCode, error) {
+	row := q.db.QueryRow(ctx, takeAuthorizationCode, codeHash)
+	var i OauthAuthorizationCode
+	err := row.Scan(
+		&i.CodeHash,
+		&i.ClientID,
+		&i.UserID,
+		&i.RedirectUri,
+		&i.Scope,
+		&i.Nonce,
+		&i.CodeChallenge,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
+
+const takeOneTimeToken = `-- name: TakeOneTimeToken :one
+DELETE FROM one_time_tokens
+WHERE token_hash=$1 AND purpose=$2 AND expires_at > now()
+RETURNING token_hash, purpose, user_id, expires_at, created_at, email
+`
+
+type TakeOneTimeTokenParams struct {
+	TokenHash string
+	Purpose   string
+}
+
+func (q *Queries) TakeOneTimeToken(ctx context.Context, arg TakeOneTimeTokenParams) (OneTimeToken, error) {
+	row := q.db.QueryRow(ctx, takeOneTimeToken, arg.TokenHash, arg.Purpose)
+	var i OneTimeToken
+	err := row.Scan(
+		&i.TokenHash,
+		&i.Purpose,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+		&i.Email,
+	)
+	return i, err
+}
+
+const takeRateLimitToken = `-- name: TakeRateLimitToken :one
+INSERT INTO rate_limit_buckets (
+  key, tokens, updated_at
+) VALUES (
+  $1, ($2::float8) - 1, now()
+)
+ON CONFLICT (key) DO UPDATE SET
+  tokens = LEAST($2::float8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM now() - rate_limit_buckets.updated_at)::float8 * $3::float8) - 1,
+  updated_at = now()
+WHERE LEAST($2::float8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM now() - rate_limit_buckets.updated_at)::float8 * $3::float8) >= 1
+RETURNING tokens
+`
+
+type TakeRateLimitTokenParams struct {
+	Key   string
+	Burst float64
+	Rate  float64
+}
+
+func (q *Queries) TakeRateLimitToken(ctx context.Context, arg TakeRateLimitTokenParams) (float64, error) {
+	row := q.db.QueryRow(ctx, takeRateLimitToken, arg.Key, arg.Burst, arg.Rate)
+	var tokens float64
+	err := row.Scan(&tokens)
+	return tokens, err
+}
+
+const takeWebAuthnSession = `-- name: TakeWebAuthnSession :one
+DELETE FROM webauthn_sessions WHERE id_hash=$1 AND expires_at > now() RETURNING data
+`
+
+func (q *Queries) TakeWebAuthnSession(ctx context.Context, idHash string) ([]byte, error) {
+	row := q.db.QueryRow(ctx, takeWebAuthnSession, idHash)
+	var data []byte
+	err := row.Scan(&data)
+	return data, err
+}
+
+const touchSession = `-- name: TouchSession :one
+INSERT INTO sessions (
+  id, user_id, user_agent, ip
+) VALUES (
+  $1, $2, $3, $4
+)
+ON CONFLICT (id) DO UPDATE SET
+  user_agent = EXCLUDED.user_agent,
+  ip = EXCLUDED.ip,
+  last_seen_at = now()
+WHERE sessions.revoked_at IS NULL AND sessions.user_id = EXCLUDED.user_id
+RETURNING id, user_id, user_agent, ip, created_at, last_seen_at, revoked_at
+`
+
+type TouchSessionParams struct {
+	ID        string
+	UserID    string
+	UserAgent string
+	Ip        string
+}
+
+func (q *Queries) TouchSession(ctx context.Context, arg TouchSessionParams) (Session, error) {
+	row := q.db.QueryRow(ctx, touchSession,
+		arg.ID,
+		arg.UserID,
+		arg.UserAgent,
+		arg.Ip,
+	)
+	var i Session
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.UserAgent,
+		&i.Ip,
+		&i.CreatedAt,
+		&i.LastSeenAt,
+		&i.RevokedAt,
+	)
+	return i, err
+}
+
+const unlockLogin = `-- name: UnlockLogin :one
+DELETE FROM login_failures
+WHERE unlock_token_hash=$1 AND locked_until > now()
+RETURNING key
+`
+
+func (q *Queries) UnlockLogin(ctx context.Context, unlockTokenHash string) (string, error) {
+	row := q.db.QueryRow(ctx, unlockLogin, unlockTokenHash)
+	var key string
+	err := row.Scan(&key)
+	return key, err
+}
+
+const updateAPITokenLastUsed = `-- name: UpdateAPITokenLastUsed :exec
+UPDATE api_tokens SET last_used_at = now() WHERE id=$1
+`
+
+func (q *Queries) UpdateAPITokenLastUsed(ctx context.Context, id string) error {
+	_, err := q.db.Exec(ctx, updateAPITokenLastUsed, id)
+	return err
+}
+
+const updateBrowserSessionToken = `-- name: UpdateBrowserSessionToken :execrows
+UPDATE browser_sessions SET token = $1, expires_at = $2
+WHERE id_hash = $3
+`
+
+type UpdateBrowserSessionTokenParams struct {
+	Token     []byte
+	ExpiresAt time.Time
+	IDHash    string
+}
+
+func (q *Queries) UpdateBrowserSessionToken(ctx context.Context, arg UpdateBrowserSessionTokenParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateBrowserSessionToken, arg.Token, arg.ExpiresAt, arg.IDHash)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updateLocalEmail = `-- name: UpdateLocalEmail :exec
+UPDATE local_credentials SET email = lower($1) WHERE user_id = $2
+`
+
+type UpdateLocalEmailParams struct {
+	Email  string
+	UserID string
+}
+
+func (q *Queries) UpdateLocalEmail(ctx context.Context, arg UpdateLocalEmailParams) error {
+	_, err := q.db.Exec(ctx, updateLocalEmail, arg.Email, arg.UserID)
+	return err
+}
+
+const updateLocalPassword = `-- name: UpdateLocalPassword :exec
+UPDATE local_credentials SET password_hash = $2 WHERE user_id=$1
+`
+
+type UpdateLocalPasswordParams struct {
+	UserID       string
+	PasswordHash string
+}
+
+func (q *Queries) UpdateLocalPassword(ctx context.Context, arg UpdateLocalPasswordParams) error {
+	_, err := q.db.Exec(ctx, updateLocalPassword, arg.UserID, arg.PasswordHash)
+	return err
+}
+
+const updateMembershipRole = `-- name: UpdateMembershipRole :execrows
+UPDATE memberships SET role = $1 WHERE org_id = $2 AND user_id = $3
+`
+
+type UpdateMembershipRoleParams struct {
+	Role   string
+	OrgID  string
+	UserID string
+}
+
+func (q *Queries) UpdateMembershipRole(ctx context.Context, arg UpdateMembershipRoleParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateMembershipRole, arg.Role, arg.OrgID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updateTOTPLastUsedStep = `-- name: UpdateTOTPLastUsedStep :execrows
+UPDATE totp_secrets SET last_used_step = $2 WHERE user_id=$1 AND last_used_step < $2
+`
+
+type UpdateTOTPLastUsedStepParams struct {
+	UserID       string
+	LastUsedStep int64
+}
+
+func (q *Queries) UpdateTOTPLastUsedStep(ctx context.Context, arg UpdateTOTPLastUsedStepParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateTOTPLastUsedStep, arg.UserID, arg.LastUsedStep)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updateUserEmail = `-- name: UpdateUserEmail :one
+UPDATE users SET email = lower($1), verified_at = coalesce(verified_at, now()) WHERE id = $2 RETURNING id, email, name, verified_at, created_at, disabled_at
+`
+
+type UpdateUserEmailParams struct {
+	Email string
+	ID    string
+}
+
+func (q *Queries) UpdateUserEmail(ctx context.Context, arg UpdateUserEmailParams) (User, error) {
+	row := q.db.QueryRow(ctx, updateUserEmail, arg.Email, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.Name,
+		&i.VerifiedAt,
+		&i.CreatedAt,
+		&i.DisabledAt,
+	)
+	return i, err
+}
+
+const updateUserName = `-- name: UpdateUserName :one
+UPDATE users SET name = $1 WHERE id = $2 RETURNING id, email, name, verified_at, created_at, disabled_at
+`
+
+type UpdateUserNameParams struct {
+	Name string
+	ID   string
+}
+
+func (q *Queries) UpdateUserName(ctx context.Context, arg UpdateUserNameParams) (User, error) {
+	row := q.db.QueryRow(ctx, updateUserName, arg.Name, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.Name,
+		&i.VerifiedAt,
+		&i.CreatedAt,
+		&i.DisabledAt,
+	)
 	return i, err
 }
+
+const updateWebAuthnCredential = `-- name: UpdateWebAuthnCredential :exec
+UPDATE webauthn_credentials SET credential = $2, last_used_at = now() WHERE id=$1
+`
+
+type UpdateWebAuthnCredentialParams struct {
+	ID         []byte
+	Credential []byte
+}
+
+func (q *Queries) UpdateWebAuthnCredential(ctx context.Context, arg UpdateWebAuthnCredentialParams) error {
+	_, err := q.db.Exec(ctx, updateWebAuthnCredential, arg.ID, arg.Credential)
+	return err
+}
@@ -0,0 +1,95 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/cativovo/go-demo-auth/pkg/auth"
+	postgres "github.com/cativovo/go-demo-auth/pkg/storage/postgres/sqlc_generated"
+)
+
+func (r *PostgresRepository) SaveTOTPSecret(ctx context.Context, userId, secret string) error {
+	p := postgres.SaveTOTPSecretParams{
+		UserID: userId,
+		Secret: secret,
+	}
+
+	return r.queries.SaveTOTPSecret(ctx, p)
+}
+
+func (r *PostgresRepository) GetTOTPSecret(ctx context.Context, userId string) (auth.TOTPSecret, error) {
+	s, err := r.queries.GetTOTPSecret(ctx, userId)
+	if err != nil {
+		return auth.TOTPSecret{}, err
+	}
+
+	return auth.TOTPSecret{
+		UserId:       s.UserID,
+		Secret:       s.Secret,
+		Confirmed:    s.ConfirmedAt != nil,
+		LastUsedStep: s.LastUsedStep,
+	}, nil
+}
+
+func (r *PostgresRepository) ConfirmTOTPSecret(ctx context.Context, userId string) error {
+	return r.queries.ConfirmTOTPSecret(ctx, userId)
+}
+
+func (r *PostgresRepository) UpdateTOTPLastUsedStep(ctx context.Context, userId string, step int64) (bool, error) {
+	p := postgres.UpdateTOTPLastUsedStepParams{
+		UserID:       userId,
+		LastUsedStep: step,
+	}
+
+	n, err := r.queries.UpdateTOTPLastUsedStep(ctx, p)
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+func (r *PostgresRepository) DeleteTOTPSecret(ctx context.Context, userId string) error {
+	return r.queries.DeleteTOTPSecret(ctx, userId)
+}
+
+func (r *PostgresRepository) AddLoginChallenge(ctx context.Context, c auth.LoginChallenge) error {
+	p := postgres.AddLoginChallengeParams{
+		IDHash:         c.IdHash,
+		UserID:         c.Token.UserId,
+		AccessToken:    c.Token.AccessToken,
+		RefreshToken:   c.Token.RefreshToken,
+		TokenExpiresIn: int32(c.Token.ExpiresIn),
+		TokenExpiresAt: int64(c.Token.ExpiresAt),
+		ExpiresAt:      c.ExpiresAt,
+	}
+
+	return r.queries.AddLoginChallenge(ctx, p)
+}
+
+func (r *PostgresRepository) GetLoginChallenge(ctx context.Context, idHash string) (auth.LoginChallenge, error) {
+	c, err := r.queries.GetLoginChallenge(ctx, idHash)
+	if err != nil {
+		return auth.LoginChallenge{}, err
+	}
+
+	return auth.LoginChallenge{
+		IdHash: c.IDHash,
+		Token: auth.Token{
+			UserId:       c.UserID,
+			AccessToken:  c.AccessToken,
+			RefreshToken: c.RefreshToken,
+			ExpiresIn:    int(c.TokenExpiresIn),
+			ExpiresAt:    int(c.TokenExpiresAt),
+		},
+		Attempts:  int(c.Attempts),
+		ExpiresAt: c.ExpiresAt,
+	}, nil
+}
+
+func (r *PostgresRepository) IncrementLoginChallengeAttempts(ctx context.Context, idHash string) error {
+	return r.queries.IncrementLoginChallengeAttempts(ctx, idHash)
+}
+
+func (r *PostgresRepository) DeleteLoginChallenge(ctx context.Context, idHash string) error {
+	return r.queries.DeleteLoginChallenge(ctx, idHash)
+}
@@ -2,25 +2,59 @@ package supabase
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"time"
 
 	"github.com/cativovo/go-demo-auth/pkg/auth"
 	userService "github.com/cativovo/go-demo-auth/pkg/user"
 )
 
+// requestTimeout bounds every call to the Supabase API, reading the response
+// included, on top of the deadline of the caller.
+const requestTimeout = 10 * time.Second
+
 type SupabaseRepository struct {
-	httpClient *http.Client
-	apiKey     string
-	baseUrl    string
+	httpClient     *http.Client
+	apiKey         string
+	serviceRoleKey string
+	baseUrl        string
 }
 
 type user struct {
-	Id string `json:"id"`
+	Id               string  `json:"id"`
+	Email            string  `json:"email"`
+	EmailConfirmedAt *string `json:"email_confirmed_at"`
+}
+
+// signupResponse is a session when email confirmation is off, or just the
+// user when Supabase is waiting for the email to be confirmed.
+type signupResponse struct {
+	token
+	user
+}
+
+type errorResponse struct {
+	ErrorCode        string `json:"error_code"`
+	ErrorDescription string `json:"error_description"`
+	Msg              string `json:"msg"`
+}
+
+type createUserPayload struct {
+	Email        string `json:"email"`
+	EmailConfirm bool   `json:"email_confirm"`
+}
+
+type resendPayload struct {
+	Type  string `json:"type"`
+	Email string `json:"email"`
 }
 
 type token struct {
@@ -31,6 +65,38 @@ type token struct {
 	ExpiresAt    int    `json:"expires_at"`
 }
 
+type refreshTokenPayload struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type generateLinkPayload struct {
+	Type  string `json:"type"`
+	Email string `json:"email"`
+}
+
+type generatedLink struct {
+	HashedToken string `json:"hashed_token"`
+}
+
+type verifyPayload struct {
+	Type      string `json:"type"`
+	TokenHash string `json:"token_hash"`
+}
+
+type otpPayload struct {
+	Email      string `json:"email"`
+	CreateUser bool   `json:"create_user"`
+}
+
+type recoverPayload struct {
+	Email string `json:"email"`
+}
+
+type updateUserPayload struct {
+	Email    string `json:"email,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
 type credentials struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
@@ -38,13 +104,14 @@ type credentials struct {
 
 func NewSupabaseRepository() *SupabaseRepository {
 	return &SupabaseRepository{
-		apiKey:     os.Getenv("SUPABASE_API_KEY"),
-		baseUrl:    fmt.Sprintf("https://%s.supabase.co/auth/v1", os.Getenv("SUPABASE_PROJECT")),
-		httpClient: &http.Client{},
+		apiKey:         os.Getenv("SUPABASE_API_KEY"),
+		serviceRoleKey: os.Getenv("SUPABASE_SERVICE_ROLE_KEY"),
+		baseUrl:        fmt.Sprintf("https://%s.supabase.co/auth/v1", os.Getenv("SUPABASE_PROJECT")),
+		httpClient:     &http.Client{Timeout: requestTimeout},
 	}
 }
 
-func (s *SupabaseRepository) Register(email, password string) (auth.Token, error) {
+func (s *SupabaseRepository) Register(ctx context.Context, email, password string) (userService.Registration, error) {
 	c := credentials{
 		Email:    email,
 		Password: password,
@@ -53,43 +120,97 @@ func (s *SupabaseRepository) Register(email, password string) (auth.Token, error
 	payload, err := json.Marshal(c)
 	if err != nil {
 		log.Println("Supabase Register:", err)
-		return auth.Token{}, auth.ErrSomethingWentWrong
+		return userService.Registration{}, auth.ErrSomethingWentWrong
 	}
 
-	req, err := s.newRequest("POST", "/signup", bytes.NewBuffer(payload))
+	req, err := s.newRequest(ctx, "POST", "/signup", bytes.NewBuffer(payload))
 	if err != nil {
 		log.Println("Supabase Register newRequest:", err)
-		return auth.Token{}, auth.ErrSomethingWentWrong
+		return userService.Registration{}, auth.ErrSomethingWentWrong
 	}
 
 	res, err := s.httpClient.Do(req)
 	if err != nil {
 		log.Println("Supabase Register Do:", err)
-		return auth.Token{}, auth.ErrSomethingWentWrong
+		return userService.Registration{}, auth.ErrSomethingWentWrong
 	}
+	defer res.Body.Close()
 
 	if res.StatusCode == http.StatusBadRequest {
-		return auth.Token{}, userService.ErrEmailAlreadyUsed
+		return userService.Registration{}, userService.ErrEmailAlreadyUsed
 	}
 
-	t := token{}
+	r := signupResponse{}
 
-	if err := json.NewDecoder(res.Body).Decode(&t); err != nil {
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
 		log.Println("Supabase Register Decode:", err)
-		return auth.Token{}, auth.ErrSomethingWentWrong
+		return userService.Registration{}, auth.ErrSomethingWentWrong
 	}
 
-	return auth.Token{
-			UserId:       t.User.Id,
-			AccessToken:  t.AccessToken,
-			RefreshToken: t.RefreshToken,
-			ExpiresIn:    t.ExpiresIn,
-			ExpiresAt:    t.ExpiresAt,
+	if r.AccessToken == "" {
+		return userService.Registration{
+				UserId:        r.user.Id,
+				EmailVerified: r.user.EmailConfirmedAt != nil,
+			},
+			nil
+	}
+
+	return userService.Registration{
+			UserId: r.token.User.Id,
+			Token: auth.Token{
+				UserId:       r.token.User.Id,
+				AccessToken:  r.AccessToken,
+				RefreshToken: r.RefreshToken,
+				ExpiresIn:    r.ExpiresIn,
+				ExpiresAt:    r.ExpiresAt,
+			},
+			EmailVerified: r.token.User.EmailConfirmedAt != nil,
 		},
 		nil
 }
 
-func (s *SupabaseRepository) Login(email, password string) (auth.Token, error) {
+// RegisterWithoutPassword creates an already confirmed user through the
+// admin API for someone who signed up with an identity provider.
+func (s *SupabaseRepository) RegisterWithoutPassword(ctx context.Context, email string) (string, error) {
+	payload, err := json.Marshal(createUserPayload{Email: email, EmailConfirm: true})
+	if err != nil {
+		log.Println("Supabase RegisterWithoutPassword:", err)
+		return "", auth.ErrSomethingWentWrong
+	}
+
+	req, err := s.newAdminRequest(ctx, "POST", "/admin/users", bytes.NewBuffer(payload))
+	if err != nil {
+		log.Println("Supabase RegisterWithoutPassword newAdminRequest:", err)
+		return "", auth.ErrSomethingWentWrong
+	}
+
+	res, err := s.httpClient.Do(req)
+	if err != nil {
+		log.Println("Supabase RegisterWithoutPassword Do:", err)
+		return "", auth.ErrSomethingWentWrong
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusUnprocessableEntity {
+		return "", userService.ErrEmailAlreadyUsed
+	}
+
+	if res.StatusCode != http.StatusOK {
+		log.Println("Supabase RegisterWithoutPassword:", res.Status)
+		return "", auth.ErrSomethingWentWrong
+	}
+
+	u := user{}
+
+	if err := json.NewDecoder(res.Body).Decode(&u); err != nil {
+		log.Println("Supabase RegisterWithoutPassword Decode:", err)
+		return "", auth.ErrSomethingWentWrong
+	}
+
+	return u.Id, nil
+}
+
+func (s *SupabaseRepository) Login(ctx context.Context, email, password string) (auth.Token, error) {
 	c := credentials{
 		Email:    email,
 		Password: password,
@@ -101,7 +222,7 @@ func (s *SupabaseRepository) Login(email, password string) (auth.Token, error) {
 		return auth.Token{}, auth.ErrSomethingWentWrong
 	}
 
-	req, err := s.newRequest("POST", "/token?grant_type=password", bytes.NewBuffer(payload))
+	req, err := s.newRequest(ctx, "POST", "/token?grant_type=password", bytes.NewBuffer(payload))
 	if err != nil {
 		log.Println("Supabase Login newRequest:", err)
 		return auth.Token{}, auth.ErrSomethingWentWrong
@@ -112,8 +233,17 @@ func (s *SupabaseRepository) Login(email, password string) (auth.Token, error) {
 		log.Println("Supabase Login Do:", err)
 		return auth.Token{}, auth.ErrSomethingWentWrong
 	}
+	defer res.Body.Close()
 
 	if res.StatusCode == http.StatusBadRequest {
+		e := errorResponse{}
+		json.NewDecoder(res.Body).Decode(&e)
+
+		// older GoTrue versions only set the description
+		if e.ErrorCode == "email_not_confirmed" || e.ErrorDescription == "Email not confirmed" {
+			return auth.Token{}, auth.ErrEmailNotVerified
+		}
+
 		return auth.Token{}, auth.ErrInvalidCredentials
 	}
 
@@ -134,19 +264,332 @@ func (s *SupabaseRepository) Login(email, password string) (auth.Token, error) {
 		nil
 }
 
-func (s *SupabaseRepository) Logout(token string) error {
-	req, err := s.newRequest("POST", "/logout?scope=local", nil)
+func (s *SupabaseRepository) Logout(ctx context.Context, token string) error {
+	return s.logout(ctx, token, "local")
+}
+
+// LogoutSession is a no-op, GoTrue can't end a session by id. Its refresh
+// token keeps working there but the revoked session is rejected by
+// auth.Service.TouchSession.
+func (s *SupabaseRepository) LogoutSession(ctx context.Context, userId, sessionId string) error {
+	return nil
+}
+
+func (s *SupabaseRepository) LogoutOthers(ctx context.Context, token string) error {
+	return s.logout(ctx, token, "others")
+}
+
+// LogoutAll is a no-op for the same reason as LogoutSession, the sessions
+// of the user are revoked on our side.
+func (s *SupabaseRepository) LogoutAll(ctx context.Context, userId string) error {
+	return nil
+}
+
+// DeleteAccount needs SUPABASE_SERVICE_ROLE_KEY.
+func (s *SupabaseRepository) DeleteAccount(ctx context.Context, userId string) error {
+	req, err := s.newAdminRequest(ctx, "DELETE", "/admin/users/"+url.PathEscape(userId), nil)
+	if err != nil {
+		log.Println("Supabase DeleteAccount newAdminRequest:", err)
+		return auth.ErrSomethingWentWrong
+	}
+
+	res, err := s.httpClient.Do(req)
 	if err != nil {
-		log.Println("Supabase Logout newRequest", err)
+		log.Println("Supabase DeleteAccount Do:", err)
+		return auth.ErrSomethingWentWrong
+	}
+	defer res.Body.Close()
+
+	// the account may already be gone if a previous attempt failed after it
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusNotFound {
+		log.Println("Supabase DeleteAccount:", res.Status)
+		return auth.ErrSomethingWentWrong
+	}
+
+	return nil
+}
+
+func (s *SupabaseRepository) GetUserId(ctx context.Context, token string) (string, error) {
+	u, err := s.getUser(ctx, token)
+	if err != nil {
+		return "", err
+	}
+
+	return u.Id, nil
+}
+
+func (s *SupabaseRepository) Refresh(ctx context.Context, refreshToken string) (auth.Token, error) {
+	payload, err := json.Marshal(refreshTokenPayload{RefreshToken: refreshToken})
+	if err != nil {
+		log.Println("Supabase Refresh:", err)
+		return auth.Token{}, auth.ErrSomethingWentWrong
+	}
+
+	req, err := s.newRequest(ctx, "POST", "/token?grant_type=refresh_token", bytes.NewBuffer(payload))
+	if err != nil {
+		log.Println("Supabase Refresh newRequest:", err)
+		return auth.Token{}, auth.ErrSomethingWentWrong
+	}
+
+	res, err := s.httpClient.Do(req)
+	if err != nil {
+		log.Println("Supabase Refresh Do:", err)
+		return auth.Token{}, auth.ErrSomethingWentWrong
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusBadRequest || res.StatusCode == http.StatusUnauthorized {
+		return auth.Token{}, auth.ErrInvalidToken
+	}
+
+	t := token{}
+
+	if err := json.NewDecoder(res.Body).Decode(&t); err != nil {
+		log.Println("Supabase Refresh Decode:", err)
+		return auth.Token{}, auth.ErrSomethingWentWrong
+	}
+
+	return auth.Token{
+			UserId:       t.User.Id,
+			AccessToken:  t.AccessToken,
+			RefreshToken: t.RefreshToken,
+			ExpiresIn:    t.ExpiresIn,
+			ExpiresAt:    t.ExpiresAt,
+		},
+		nil
+}
+
+// IssueToken needs SUPABASE_SERVICE_ROLE_KEY: it generates a magic link for
+// the user through the admin API and redeems it right away.
+func (s *SupabaseRepository) IssueToken(ctx context.Context, userId string) (auth.Token, error) {
+	u, err := s.getAdminUser(ctx, userId)
+	if err != nil {
+		return auth.Token{}, err
+	}
+
+	payload, err := json.Marshal(generateLinkPayload{Type: "magiclink", Email: u.Email})
+	if err != nil {
+		log.Println("Supabase IssueToken:", err)
+		return auth.Token{}, auth.ErrSomethingWentWrong
+	}
+
+	req, err := s.newAdminRequest(ctx, "POST", "/admin/generate_link", bytes.NewBuffer(payload))
+	if err != nil {
+		log.Println("Supabase IssueToken newAdminRequest:", err)
+		return auth.Token{}, auth.ErrSomethingWentWrong
+	}
+
+	res, err := s.httpClient.Do(req)
+	if err != nil {
+		log.Println("Supabase IssueToken Do:", err)
+		return auth.Token{}, auth.ErrSomethingWentWrong
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		log.Println("Supabase IssueToken generate_link:", res.Status)
+		return auth.Token{}, auth.ErrSomethingWentWrong
+	}
+
+	link := generatedLink{}
+
+	if err := json.NewDecoder(res.Body).Decode(&link); err != nil {
+		log.Println("Supabase IssueToken Decode:", err)
+		return auth.Token{}, auth.ErrSomethingWentWrong
+	}
+
+	return s.verify(ctx, "magiclink", link.HashedToken)
+}
+
+// SendMagicLink relies on the Magic Link email template pointing back at
+// the app: {{ .SiteURL }}/auth/magic-link?token={{ .TokenHash }}
+func (s *SupabaseRepository) SendMagicLink(ctx context.Context, email string) error {
+	payload, err := json.Marshal(otpPayload{Email: email, CreateUser: false})
+	if err != nil {
+		log.Println("Supabase SendMagicLink:", err)
+		return auth.ErrSomethingWentWrong
+	}
+
+	req, err := s.newRequest(ctx, "POST", "/otp", bytes.NewBuffer(payload))
+	if err != nil {
+		log.Println("Supabase SendMagicLink newRequest:", err)
+		return auth.ErrSomethingWentWrong
+	}
+
+	res, err := s.httpClient.Do(req)
+	if err != nil {
+		log.Println("Supabase SendMagicLink Do:", err)
+		return auth.ErrSomethingWentWrong
+	}
+	defer res.Body.Close()
+
+	// unknown emails are rejected because create_user is false, they are
+	// ignored so the form doesn't reveal who has an account
+	if res.StatusCode >= http.StatusInternalServerError || res.StatusCode == http.StatusTooManyRequests {
+		log.Println("Supabase SendMagicLink:", res.Status)
+		return auth.ErrSomethingWentWrong
+	}
+
+	return nil
+}
+
+func (s *SupabaseRepository) VerifyMagicLink(ctx context.Context, token string) (auth.Token, error) {
+	return s.verify(ctx, "magiclink", token)
+}
+
+// RequestPasswordReset relies on the Reset Password email template pointing
+// back at the app: {{ .SiteURL }}/auth-page/reset-password?token={{ .TokenHash }}
+func (s *SupabaseRepository) RequestPasswordReset(ctx context.Context, email string) error {
+	payload, err := json.Marshal(recoverPayload{Email: email})
+	if err != nil {
+		log.Println("Supabase RequestPasswordReset:", err)
+		return auth.ErrSomethingWentWrong
+	}
+
+	req, err := s.newRequest(ctx, "POST", "/recover", bytes.NewBuffer(payload))
+	if err != nil {
+		log.Println("Supabase RequestPasswordReset newRequest:", err)
+		return auth.ErrSomethingWentWrong
+	}
+
+	res, err := s.httpClient.Do(req)
+	if err != nil {
+		log.Println("Supabase RequestPasswordReset Do:", err)
+		return auth.ErrSomethingWentWrong
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		log.Println("Supabase RequestPasswordReset:", res.Status)
+		return auth.ErrSomethingWentWrong
+	}
+
+	return nil
+}
+
+// ResetPassword redeems the recovery token, sets the new password with the
+// session it yields and then signs the user out of every session.
+func (s *SupabaseRepository) ResetPassword(ctx context.Context, tokenHash, password string) (string, error) {
+	t, err := s.verify(ctx, "recovery", tokenHash)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.updateUser(ctx, t.AccessToken, updateUserPayload{Password: password}); err != nil {
+		return "", err
+	}
+
+	return t.UserId, s.logout(ctx, t.AccessToken, "global")
+}
+
+// VerifyPassword logs in with password and ends the session right away.
+func (s *SupabaseRepository) VerifyPassword(ctx context.Context, userId, email, password string) error {
+	t, err := s.Login(ctx, email, password)
+	if err != nil {
+		return err
+	}
+
+	return s.logout(ctx, t.AccessToken, "local")
+}
+
+// ChangePassword checks currentPassword by logging in with it, the session
+// this starts is only used to set the new password.
+func (s *SupabaseRepository) ChangePassword(ctx context.Context, userId, email, currentPassword, newPassword string) error {
+	t, err := s.Login(ctx, email, currentPassword)
+	if err != nil {
+		return err
+	}
+
+	if err := s.updateUser(ctx, t.AccessToken, updateUserPayload{Password: newPassword}); err != nil {
+		return err
+	}
+
+	return s.logout(ctx, t.AccessToken, "local")
+}
+
+// RequestEmailChange relies on the Change Email Address email template
+// pointing back at the app: {{ .SiteURL }}/auth/confirm-email?token={{ .TokenHash }}
+func (s *SupabaseRepository) RequestEmailChange(ctx context.Context, userId, accessToken, newEmail string) error {
+	return s.updateUser(ctx, accessToken, updateUserPayload{Email: newEmail})
+}
+
+// ConfirmEmailChange returns userService.ErrEmailChangePending when "Secure
+// email change" is on and only one of the links sent to the old and the new
+// email has been followed.
+func (s *SupabaseRepository) ConfirmEmailChange(ctx context.Context, tokenHash string) (string, string, error) {
+	t, err := s.verify(ctx, "email_change", tokenHash)
+	if err != nil {
+		return "", "", err
+	}
+
+	if t.AccessToken == "" {
+		return "", "", userService.ErrEmailChangePending
+	}
+
+	u, err := s.getUser(ctx, t.AccessToken)
+	if err != nil {
+		return "", "", err
+	}
+
+	// the session started by the link isn't needed
+	if err := s.logout(ctx, t.AccessToken, "local"); err != nil {
+		log.Println("Supabase ConfirmEmailChange logout:", err)
+	}
+
+	return u.Id, u.Email, nil
+}
+
+// VerifyEmail relies on the Confirm Signup email template pointing back at
+// the app: {{ .SiteURL }}/auth/verify-email?token={{ .TokenHash }}
+func (s *SupabaseRepository) VerifyEmail(ctx context.Context, tokenHash string) (auth.Token, error) {
+	return s.verify(ctx, "signup", tokenHash)
+}
+
+func (s *SupabaseRepository) ResendVerificationEmail(ctx context.Context, email string) error {
+	payload, err := json.Marshal(resendPayload{Type: "signup", Email: email})
+	if err != nil {
+		log.Println("Supabase ResendVerificationEmail:", err)
+		return auth.ErrSomethingWentWrong
+	}
+
+	req, err := s.newRequest(ctx, "POST", "/resend", bytes.NewBuffer(payload))
+	if err != nil {
+		log.Println("Supabase ResendVerificationEmail newRequest:", err)
+		return auth.ErrSomethingWentWrong
+	}
+
+	res, err := s.httpClient.Do(req)
+	if err != nil {
+		log.Println("Supabase ResendVerificationEmail Do:", err)
+		return auth.ErrSomethingWentWrong
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= http.StatusInternalServerError || res.StatusCode == http.StatusTooManyRequests {
+		log.Println("Supabase ResendVerificationEmail:", res.Status)
+		return auth.ErrSomethingWentWrong
+	}
+
+	return nil
+}
+
+// helpers
+
+// logout revokes the session of token, others or every session depending on scope.
+func (s *SupabaseRepository) logout(ctx context.Context, token, scope string) error {
+	req, err := s.newRequest(ctx, "POST", "/logout?scope="+scope, nil)
+	if err != nil {
+		log.Println("Supabase logout newRequest", err)
 		return auth.ErrSomethingWentWrong
 	}
 	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
 
 	res, err := s.httpClient.Do(req)
 	if err != nil {
-		log.Println("Supabase Logout Do", err)
+		log.Println("Supabase logout Do", err)
 		return auth.ErrSomethingWentWrong
 	}
+	defer res.Body.Close()
 
 	if res.StatusCode != http.StatusNoContent {
 		return auth.ErrSomethingWentWrong
@@ -155,34 +598,163 @@ func (s *SupabaseRepository) Logout(token string) error {
 	return nil
 }
 
-func (s *SupabaseRepository) GetUserId(token string) (string, error) {
-	req, err := s.newRequest("GET", "/user", nil)
+func (s *SupabaseRepository) verify(ctx context.Context, verificationType, tokenHash string) (auth.Token, error) {
+	payload, err := json.Marshal(verifyPayload{Type: verificationType, TokenHash: tokenHash})
+	if err != nil {
+		log.Println("Supabase verify:", err)
+		return auth.Token{}, auth.ErrSomethingWentWrong
+	}
+
+	req, err := s.newRequest(ctx, "POST", "/verify", bytes.NewBuffer(payload))
+	if err != nil {
+		log.Println("Supabase verify newRequest:", err)
+		return auth.Token{}, auth.ErrSomethingWentWrong
+	}
+
+	res, err := s.httpClient.Do(req)
+	if err != nil {
+		log.Println("Supabase verify Do:", err)
+		return auth.Token{}, auth.ErrSomethingWentWrong
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return auth.Token{}, auth.ErrInvalidToken
+	}
+
+	t := token{}
+
+	if err := json.NewDecoder(res.Body).Decode(&t); err != nil {
+		log.Println("Supabase verify Decode:", err)
+		return auth.Token{}, auth.ErrSomethingWentWrong
+	}
+
+	return auth.Token{
+			UserId:       t.User.Id,
+			AccessToken:  t.AccessToken,
+			RefreshToken: t.RefreshToken,
+			ExpiresIn:    t.ExpiresIn,
+			ExpiresAt:    t.ExpiresAt,
+		},
+		nil
+}
+
+func (s *SupabaseRepository) getUser(ctx context.Context, token string) (user, error) {
+	req, err := s.newRequest(ctx, "GET", "/user", nil)
+	if err != nil {
+		log.Println("Supabase getUser newRequest", err)
+		return user{}, auth.ErrSomethingWentWrong
+	}
 	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
 
+	res, err := s.httpClient.Do(req)
 	if err != nil {
-		log.Println("Supabase GetUserId newRequest", err)
-		return "", auth.ErrSomethingWentWrong
+		log.Println("Supabase getUser Do", err)
+		return user{}, auth.ErrSomethingWentWrong
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden {
+		return user{}, auth.ErrInvalidToken
+	}
+
+	u := user{}
+
+	if err := json.NewDecoder(res.Body).Decode(&u); err != nil {
+		log.Println("Supabase getUser Decode", err)
+		return user{}, auth.ErrSomethingWentWrong
+	}
+
+	return u, nil
+}
+
+// updateUser changes the user of the session of token with PUT /user.
+func (s *SupabaseRepository) updateUser(ctx context.Context, token string, p updateUserPayload) error {
+	payload, err := json.Marshal(p)
+	if err != nil {
+		log.Println("Supabase updateUser:", err)
+		return auth.ErrSomethingWentWrong
 	}
 
+	req, err := s.newRequest(ctx, "PUT", "/user", bytes.NewBuffer(payload))
+	if err != nil {
+		log.Println("Supabase updateUser newRequest:", err)
+		return auth.ErrSomethingWentWrong
+	}
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+
 	res, err := s.httpClient.Do(req)
 	if err != nil {
-		log.Println("Supabase GetUserId Do", err)
-		return "", auth.ErrSomethingWentWrong
+		log.Println("Supabase updateUser Do:", err)
+		return auth.ErrSomethingWentWrong
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusUnprocessableEntity {
+		e := errorResponse{}
+		json.NewDecoder(res.Body).Decode(&e)
+
+		if e.ErrorCode == "email_exists" {
+			return userService.ErrEmailAlreadyUsed
+		}
+	}
+
+	if res.StatusCode != http.StatusOK {
+		log.Println("Supabase updateUser:", res.Status)
+		return auth.ErrSomethingWentWrong
+	}
+
+	return nil
+}
+
+func (s *SupabaseRepository) getAdminUser(ctx context.Context, userId string) (user, error) {
+	req, err := s.newAdminRequest(ctx, "GET", "/admin/users/"+url.PathEscape(userId), nil)
+	if err != nil {
+		log.Println("Supabase getAdminUser newAdminRequest:", err)
+		return user{}, auth.ErrSomethingWentWrong
+	}
+
+	res, err := s.httpClient.Do(req)
+	if err != nil {
+		log.Println("Supabase getAdminUser Do:", err)
+		return user{}, auth.ErrSomethingWentWrong
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		log.Println("Supabase getAdminUser:", res.Status)
+		return user{}, auth.ErrSomethingWentWrong
 	}
 
 	u := user{}
 
 	if err := json.NewDecoder(res.Body).Decode(&u); err != nil {
-		log.Println("Supabase GetUserId Do", err)
-		return "", auth.ErrSomethingWentWrong
+		log.Println("Supabase getAdminUser Decode:", err)
+		return user{}, auth.ErrSomethingWentWrong
 	}
 
-	return u.Id, nil
+	return u, nil
 }
 
-// helpers
-func (s *SupabaseRepository) newRequest(method string, path string, body io.Reader) (*http.Request, error) {
-	req, err := http.NewRequest(method, s.baseUrl+path, body)
+func (s *SupabaseRepository) newAdminRequest(ctx context.Context, method string, path string, body io.Reader) (*http.Request, error) {
+	if s.serviceRoleKey == "" {
+		return nil, errors.New("SUPABASE_SERVICE_ROLE_KEY is not set")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, s.baseUrl+path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("apiKey", s.serviceRoleKey)
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", s.serviceRoleKey))
+
+	return req, nil
+}
+
+func (s *SupabaseRepository) newRequest(ctx context.Context, method string, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.baseUrl+path, body)
 	if err != nil {
 		return nil, err
 	}
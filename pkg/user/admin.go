@@ -0,0 +1,114 @@
+package user
+
+import (
+	"context"
+	"log"
+
+	"github.com/cativovo/go-demo-auth/pkg/auth"
+)
+
+const usersPageSize = 20
+
+// UserPage is a page of the users listed in the admin console.
+type UserPage struct {
+	Users []User
+	Query string
+	Page  int
+	Total int
+}
+
+func (p UserPage) TotalPages() int {
+	return max(1, (p.Total+usersPageSize-1)/usersPageSize)
+}
+
+func (p UserPage) HasPrevious() bool {
+	return p.Page > 1
+}
+
+func (p UserPage) HasNext() bool {
+	return p.Page < p.TotalPages()
+}
+
+func (s *service) SearchUsers(ctx context.Context, query string, page int) (UserPage, error) {
+	page = max(1, page)
+
+	users, total, err := s.repository.SearchUsers(ctx, query, usersPageSize, (page-1)*usersPageSize)
+	if err != nil {
+		log.Println("UserService SearchUsers SearchUsers:", err)
+		return UserPage{}, auth.ErrSomethingWentWrong
+	}
+
+	return UserPage{
+			Users: users,
+			Query: query,
+			Page:  page,
+			Total: total,
+		},
+		nil
+}
+
+func (s *service) DisableUser(ctx context.Context, id string) error {
+	if err := s.setDisabled(ctx, id, true); err != nil {
+		return err
+	}
+
+	return s.ForceLogout(ctx, id)
+}
+
+func (s *service) EnableUser(ctx context.Context, id string) error {
+	return s.setDisabled(ctx, id, false)
+}
+
+// ForceLogout signs the user out of every device, the browser sessions end
+// on their next request when auth.Service.TouchSession rejects them.
+func (s *service) ForceLogout(ctx context.Context, id string) error {
+	if err := s.repository.RevokeAllSessions(ctx, id); err != nil {
+		log.Println("UserService ForceLogout RevokeAllSessions:", err)
+		return auth.ErrSomethingWentWrong
+	}
+
+	return s.repository.LogoutAll(ctx, id)
+}
+
+// SendPasswordReset emails the user the same link as the forgot password
+// page.
+func (s *service) SendPasswordReset(ctx context.Context, id string) error {
+	u, err := s.GetUserById(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return s.repository.RequestPasswordReset(ctx, u.Email)
+}
+
+func (s *service) DeleteUser(ctx context.Context, id string) error {
+	if _, err := s.GetUserById(ctx, id); err != nil {
+		return err
+	}
+
+	if err := s.repository.DeleteAccount(ctx, id); err != nil {
+		return err
+	}
+
+	if _, err := s.repository.DeleteUser(ctx, id); err != nil {
+		log.Println("UserService DeleteUser DeleteUser:", err)
+		return auth.ErrSomethingWentWrong
+	}
+
+	return nil
+}
+
+// helpers
+func (s *service) setDisabled(ctx context.Context, id string, disabled bool) error {
+	updated, err := s.repository.SetUserDisabled(ctx, id, disabled)
+	if err != nil {
+		log.Println("UserService setDisabled SetUserDisabled:", err)
+		return auth.ErrSomethingWentWrong
+	}
+
+	if !updated {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
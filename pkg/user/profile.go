@@ -0,0 +1,144 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cativovo/go-demo-auth/pkg/audit"
+	"github.com/cativovo/go-demo-auth/pkg/auth"
+)
+
+const maxNameLength = 100
+
+func (s *service) UpdateName(ctx context.Context, id, name string) (User, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxNameLength {
+		return User{}, ErrInvalidName
+	}
+
+	u, err := s.repository.UpdateUserName(ctx, id, name)
+	if err != nil {
+		log.Println("UserService UpdateName UpdateUserName:", err)
+		return User{}, ErrUserNotFound
+	}
+
+	return u, nil
+}
+
+func (s *service) ChangePassword(ctx context.Context, id, currentPassword, newPassword string, c audit.Client) error {
+	u, err := s.GetUserById(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.policy.Check(newPassword, u.Email, u.Name); err != nil {
+		return err
+	}
+
+	err = s.checkPassword(ctx, u, currentPassword, c)
+	if err == nil {
+		err = s.repository.ChangePassword(ctx, u.Id, u.Email, currentPassword, newPassword)
+	}
+	s.record(ctx, audit.NewEvent(audit.ActionPasswordChange, u.Id, u.Email, c, err))
+
+	if err != nil && !isPasswordError(err) {
+		log.Println("UserService ChangePassword ChangePassword:", err)
+		return auth.ErrSomethingWentWrong
+	}
+
+	return err
+}
+
+// DeleteOwnAccount signs the user out everywhere before deleting them at
+// the provider and from users, the rest of their data goes with it.
+func (s *service) DeleteOwnAccount(ctx context.Context, id, password string, c audit.Client) error {
+	u, err := s.GetUserById(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.checkPassword(ctx, u, password, c); err != nil {
+		s.record(ctx, audit.NewEvent(audit.ActionAccountDelete, u.Id, u.Email, c, err))
+
+		if !isPasswordError(err) {
+			log.Println("UserService DeleteOwnAccount checkPassword:", err)
+			return auth.ErrSomethingWentWrong
+		}
+
+		return err
+	}
+
+	if err := s.ForceLogout(ctx, u.Id); err != nil {
+		return err
+	}
+
+	if err := s.DeleteUser(ctx, u.Id); err != nil {
+		return err
+	}
+
+	s.record(ctx, audit.NewEvent(audit.ActionAccountDelete, u.Id, u.Email, c, nil))
+
+	return nil
+}
+
+func (s *service) RequestEmailChange(ctx context.Context, id, accessToken, newEmail string) error {
+	newEmail = strings.TrimSpace(newEmail)
+	if err := s.validate.Var(newEmail, "required,email"); err != nil {
+		return ErrInvalidEmail
+	}
+
+	// also covers the current email of the user
+	if _, err := s.repository.GetUserByEmail(ctx, newEmail); err == nil {
+		return ErrEmailAlreadyUsed
+	}
+
+	if err := s.repository.RequestEmailChange(ctx, id, accessToken, newEmail); err != nil {
+		if errors.Is(err, ErrEmailAlreadyUsed) {
+			return err
+		}
+
+		log.Println("UserService RequestEmailChange RequestEmailChange:", err)
+		return auth.ErrSomethingWentWrong
+	}
+
+	return nil
+}
+
+// ConfirmEmailChange applies the change to the users table once the
+// provider confirmed it, so the two stay the same.
+func (s *service) ConfirmEmailChange(ctx context.Context, token string, c audit.Client) (User, error) {
+	id, email, err := s.repository.ConfirmEmailChange(ctx, token)
+	if err != nil {
+		return User{}, err
+	}
+
+	u, err := s.repository.UpdateUserEmail(ctx, id, email)
+	if err != nil {
+		log.Println("UserService ConfirmEmailChange UpdateUserEmail:", err)
+		return User{}, auth.ErrSomethingWentWrong
+	}
+
+	s.record(ctx, audit.NewEvent(audit.ActionEmailChange, u.Id, u.Email, c, nil))
+
+	return u, nil
+}
+
+// helpers
+// checkPassword goes through the PasswordChecker when there is one.
+func (s *service) checkPassword(ctx context.Context, u User, password string, c audit.Client) error {
+	if s.passwords != nil {
+		return s.passwords.CheckPassword(ctx, u.Id, u.Email, password, c)
+	}
+
+	return s.repository.VerifyPassword(ctx, u.Id, u.Email, password)
+}
+
+// isPasswordError tells the wrong passwords and the refused checks apart
+// from the failures.
+func isPasswordError(err error) bool {
+	var throttled *auth.ThrottledError
+	return errors.Is(err, auth.ErrInvalidCredentials) || errors.As(err, &throttled)
+}
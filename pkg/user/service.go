@@ -1,63 +1,191 @@
 package user
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
+	"time"
 
+	"github.com/cativovo/go-demo-auth/pkg/audit"
 	"github.com/cativovo/go-demo-auth/pkg/auth"
+	"github.com/cativovo/go-demo-auth/pkg/password"
 	"github.com/go-playground/validator/v10"
 )
 
 var (
 	ErrEmailAlreadyUsed = errors.New("email is already used")
 	ErrFieldRequired    = errors.New("required")
-	ErrPasswordTooShort = errors.New("password is too short")
+	ErrPasswordTooShort = password.ErrTooShort
 	ErrInvalidEmail     = errors.New("invalid email")
 	ErrUserNotFound     = errors.New("user not found")
+	ErrInvalidName      = errors.New("name is required and must be at most 100 characters")
+	// ErrEmailChangePending is returned when the provider also wants the
+	// change confirmed from the old email.
+	ErrEmailChangePending = errors.New("email change must also be confirmed from the other email")
 )
 
 type User struct {
-	Id    string
-	Email string
-	Name  string
+	Id         string
+	Email      string
+	Name       string
+	VerifiedAt *time.Time
+	CreatedAt  time.Time
+	DisabledAt *time.Time
 }
 
+// Registration is what the identity provider returns on sign up. Token is
+// empty when the provider wants the email confirmed before the first login.
+type Registration struct {
+	UserId        string
+	Token         auth.Token
+	EmailVerified bool
+}
+
+// Credentials are what users register with, Password is also checked
+// against the password policy by Service.ValidatePassword.
 type Credentials struct {
 	Email    string `validate:"required,email"`
 	Name     string `validate:"required"`
-	Password string `validate:"required,min=6"`
+	Password string `validate:"required"`
 }
 
 type Service interface {
-	Register(u Credentials) (auth.Token, []error)
+	// Register returns auth.ErrEmailNotVerified when the account was created
+	// but can't be logged into before the email is confirmed.
+	Register(ctx context.Context, u Credentials, c audit.Client) (auth.Token, []error)
 	ValidateCredentials(c Credentials) validator.ValidationErrors
-	GetUserByEmail(email string) (User, error)
-	GetUserById(id string) (User, error)
+	// ValidatePassword returns a *password.PolicyError when c.Password
+	// breaks the password policy, the email and name of c are banned from
+	// it.
+	ValidatePassword(c Credentials) error
+	GetUserByEmail(ctx context.Context, email string) (User, error)
+	GetUserById(ctx context.Context, id string) (User, error)
+	VerifyEmail(ctx context.Context, token string) (auth.Token, error)
+	ResendVerificationEmail(ctx context.Context, email string) error
+	// RegisterWithOIDC creates the user behind an identity that isn't linked
+	// yet, or links it to the user with the same verified email when the
+	// provider is trusted with emails. It returns ErrEmailAlreadyUsed
+	// otherwise.
+	RegisterWithOIDC(ctx context.Context, i auth.OIDCIdentity, c audit.Client) (auth.Token, error)
+	// SearchUsers returns the page of the users whose email or name
+	// contains query, pages start at 1.
+	SearchUsers(ctx context.Context, query string, page int) (UserPage, error)
+	// DisableUser also signs the user out everywhere.
+	DisableUser(ctx context.Context, id string) error
+	EnableUser(ctx context.Context, id string) error
+	ForceLogout(ctx context.Context, id string) error
+	SendPasswordReset(ctx context.Context, id string) error
+	DeleteUser(ctx context.Context, id string) error
+	// DeleteOwnAccount is DeleteUser for the user themselves, it returns
+	// auth.ErrInvalidCredentials when password is wrong.
+	DeleteOwnAccount(ctx context.Context, id, password string, c audit.Client) error
+	UpdateName(ctx context.Context, id, name string) (User, error)
+	// ChangePassword returns auth.ErrInvalidCredentials when currentPassword
+	// is wrong.
+	ChangePassword(ctx context.Context, id, currentPassword, newPassword string, c audit.Client) error
+	// RequestEmailChange emails a confirmation link to newEmail, the email
+	// only changes once it's followed. accessToken is the one of the
+	// session of the user.
+	RequestEmailChange(ctx context.Context, id, accessToken, newEmail string) error
+	ConfirmEmailChange(ctx context.Context, token string, c audit.Client) (User, error)
 }
 
 type Repository interface {
-	AddUser(u User) (User, error)
-	Register(email, password string) (auth.Token, error)
-	GetUserByEmail(email string) (User, error)
-	GetUserById(id string) (User, error)
+	AddUser(ctx context.Context, u User) (User, error)
+	Register(ctx context.Context, email, password string) (Registration, error)
+	RegisterWithoutPassword(ctx context.Context, email string) (string, error)
+	IssueToken(ctx context.Context, userId string) (auth.Token, error)
+	AddOIDCIdentity(ctx context.Context, i auth.OIDCIdentity, userId string) error
+	// GetUserByEmail returns ErrUserNotFound for an email nobody uses.
+	GetUserByEmail(ctx context.Context, email string) (User, error)
+	GetUserById(ctx context.Context, id string) (User, error)
+	VerifyEmail(ctx context.Context, token string) (auth.Token, error)
+	ResendVerificationEmail(ctx context.Context, email string) error
+	MarkUserVerified(ctx context.Context, id string) error
+	RequestPasswordReset(ctx context.Context, email string) error
+	SearchUsers(ctx context.Context, query string, limit, offset int) ([]User, int, error)
+	SetUserDisabled(ctx context.Context, id string, disabled bool) (bool, error)
+	RevokeAllSessions(ctx context.Context, userId string) error
+	// LogoutAll ends every session of the user at the provider.
+	LogoutAll(ctx context.Context, userId string) error
+	Logout(ctx context.Context, token string) error
+	// DeleteAccount deletes the user at the provider, DeleteUser deletes
+	// what we store about them.
+	DeleteAccount(ctx context.Context, userId string) error
+	DeleteUser(ctx context.Context, id string) (bool, error)
+	UpdateUserName(ctx context.Context, id, name string) (User, error)
+	// UpdateUserEmail also marks the user verified, the new email was
+	// confirmed.
+	UpdateUserEmail(ctx context.Context, id, email string) (User, error)
+	// ChangePassword returns auth.ErrInvalidCredentials when currentPassword
+	// is wrong.
+	ChangePassword(ctx context.Context, userId, email, currentPassword, newPassword string) error
+	// VerifyPassword returns auth.ErrInvalidCredentials when password isn't
+	// the one of the user.
+	VerifyPassword(ctx context.Context, userId, email, password string) error
+	RequestEmailChange(ctx context.Context, userId, accessToken, newEmail string) error
+	// ConfirmEmailChange returns the id of the user and their new email.
+	ConfirmEmailChange(ctx context.Context, token string) (string, string, error)
 }
 
 type service struct {
 	repository Repository
 	validate   *validator.Validate
+	auditor    audit.Auditor
+	policy     password.Policy
+	passwords  PasswordChecker
 }
 
-func NewUserService(r Repository) Service {
+// PasswordChecker checks the password of a signed in user with the lockout
+// of the logins, auth.Service is one.
+type PasswordChecker interface {
+	CheckPassword(ctx context.Context, userId, email, password string, c audit.Client) error
+}
+
+type Option func(*service)
+
+// WithAuditor records the registrations.
+func WithAuditor(a audit.Auditor) Option {
+	return func(s *service) {
+		s.auditor = a
+	}
+}
+
+// WithPasswordPolicy replaces password.DefaultPolicy for the registrations
+// and password changes.
+func WithPasswordPolicy(p password.Policy) Option {
+	return func(s *service) {
+		s.policy = p
+	}
+}
+
+// WithPasswordChecker makes the password confirming a password change or
+// the deletion of the account count towards the lockout of the logins,
+// otherwise a stolen session could guess it without limits.
+func WithPasswordChecker(p PasswordChecker) Option {
+	return func(s *service) {
+		s.passwords = p
+	}
+}
+
+func NewUserService(r Repository, opts ...Option) Service {
 	v := validator.New(validator.WithRequiredStructEnabled())
 
-	return &service{
+	s := &service{
 		repository: r,
 		validate:   v,
+		policy:     password.DefaultPolicy(),
+	}
+
+	for _, opt := range opts {
+		opt(s)
 	}
+
+	return s
 }
 
-func (s *service) Register(c Credentials) (auth.Token, []error) {
+func (s *service) Register(ctx context.Context, c Credentials, client audit.Client) (auth.Token, []error) {
 	var errors []error
 
 	if err := s.validate.Struct(c); err != nil {
@@ -76,28 +204,46 @@ func (s *service) Register(c Credentials) (auth.Token, []error) {
 		}
 	}
 
+	if errors == nil {
+		if err := s.ValidatePassword(c); err != nil {
+			errors = append(errors, err)
+		}
+	}
+
 	if errors != nil {
 		return auth.Token{}, errors
 	}
 
-	token, err := s.repository.Register(c.Email, c.Password)
+	registration, err := s.repository.Register(ctx, c.Email, c.Password)
 	if err != nil {
 		log.Println("UserService Register repository.Register:", err)
+		s.record(ctx, audit.NewEvent(audit.ActionRegister, "", c.Email, client, err))
 		return auth.Token{}, append(errors, err)
 	}
 
 	user := User{
-		Id:    token.UserId,
+		Id:    registration.UserId,
 		Email: c.Email,
 		Name:  c.Name,
 	}
 
-	if _, err := s.repository.AddUser(user); err != nil {
+	if registration.EmailVerified {
+		now := time.Now()
+		user.VerifiedAt = &now
+	}
+
+	if _, err := s.repository.AddUser(ctx, user); err != nil {
 		log.Println("UserService Register AddUser:", err)
 		return auth.Token{}, append(errors, err)
 	}
 
-	return token, nil
+	s.record(ctx, audit.NewEvent(audit.ActionRegister, user.Id, user.Email, client, nil))
+
+	if registration.Token.AccessToken == "" {
+		return auth.Token{}, append(errors, auth.ErrEmailNotVerified)
+	}
+
+	return registration.Token, nil
 }
 
 func (s *service) ValidateCredentials(c Credentials) validator.ValidationErrors {
@@ -109,8 +255,12 @@ func (s *service) ValidateCredentials(c Credentials) validator.ValidationErrors
 	return nil
 }
 
-func (s *service) GetUserByEmail(email string) (User, error) {
-	u, err := s.repository.GetUserByEmail(email)
+func (s *service) ValidatePassword(c Credentials) error {
+	return s.policy.Check(c.Password, c.Email, c.Name)
+}
+
+func (s *service) GetUserByEmail(ctx context.Context, email string) (User, error) {
+	u, err := s.repository.GetUserByEmail(ctx, email)
 	if err != nil {
 		return User{}, ErrUserNotFound
 	}
@@ -118,11 +268,116 @@ func (s *service) GetUserByEmail(email string) (User, error) {
 	return u, nil
 }
 
-func (s *service) GetUserById(id string) (User, error) {
-	u, err := s.repository.GetUserById(id)
+func (s *service) GetUserById(ctx context.Context, id string) (User, error) {
+	u, err := s.repository.GetUserById(ctx, id)
 	if err != nil {
 		return User{}, ErrUserNotFound
 	}
 
 	return u, nil
 }
+
+// VerifyEmail confirms the address the token was sent to and returns a
+// session for the user, disabled users are only verified.
+func (s *service) VerifyEmail(ctx context.Context, token string) (auth.Token, error) {
+	t, err := s.repository.VerifyEmail(ctx, token)
+	if err != nil {
+		return auth.Token{}, err
+	}
+
+	if err := s.repository.MarkUserVerified(ctx, t.UserId); err != nil {
+		log.Println("UserService VerifyEmail MarkUserVerified:", err)
+		return auth.Token{}, auth.ErrSomethingWentWrong
+	}
+
+	u, err := s.GetUserById(ctx, t.UserId)
+	if err == nil && u.DisabledAt != nil {
+		err = auth.ErrAccountDisabled
+	}
+	if err != nil {
+		if err := s.repository.Logout(ctx, t.AccessToken); err != nil {
+			log.Println("UserService VerifyEmail Logout:", err)
+		}
+		return auth.Token{}, err
+	}
+
+	return t, nil
+}
+
+func (s *service) ResendVerificationEmail(ctx context.Context, email string) error {
+	return s.repository.ResendVerificationEmail(ctx, email)
+}
+
+func (s *service) RegisterWithOIDC(ctx context.Context, i auth.OIDCIdentity, c audit.Client) (auth.Token, error) {
+	// an unverified email could belong to anyone, linking on it would let
+	// them take over the account
+	if i.Email == "" || !i.EmailVerified {
+		return auth.Token{}, auth.ErrEmailNotVerified
+	}
+
+	var userId string
+
+	existing, err := s.repository.GetUserByEmail(ctx, i.Email)
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		log.Println("UserService RegisterWithOIDC GetUserByEmail:", err)
+		return auth.Token{}, auth.ErrSomethingWentWrong
+	}
+
+	if err == nil {
+		// the provider asserting the email isn't enough unless it's trusted
+		// to, see auth.OIDCProvider.TrustEmail
+		if existing.VerifiedAt == nil || !i.EmailTrusted {
+			return auth.Token{}, ErrEmailAlreadyUsed
+		}
+
+		if existing.DisabledAt != nil {
+			return auth.Token{}, auth.ErrAccountDisabled
+		}
+
+		userId = existing.Id
+	} else {
+		id, err := s.repository.RegisterWithoutPassword(ctx, i.Email)
+		if err != nil {
+			log.Println("UserService RegisterWithOIDC RegisterWithoutPassword:", err)
+			return auth.Token{}, err
+		}
+
+		name := i.Name
+		if name == "" {
+			name = i.Email
+		}
+
+		now := time.Now()
+		user := User{
+			Id:         id,
+			Email:      i.Email,
+			Name:       name,
+			VerifiedAt: &now,
+		}
+
+		if _, err := s.repository.AddUser(ctx, user); err != nil {
+			log.Println("UserService RegisterWithOIDC AddUser:", err)
+			return auth.Token{}, auth.ErrSomethingWentWrong
+		}
+
+		userId = id
+	}
+
+	if err := s.repository.AddOIDCIdentity(ctx, i, userId); err != nil {
+		log.Println("UserService RegisterWithOIDC AddOIDCIdentity:", err)
+		return auth.Token{}, auth.ErrSomethingWentWrong
+	}
+
+	// linking an identity to an existing account is recorded too, it's a
+	// new way to log into it
+	s.record(ctx, audit.NewEvent(audit.ActionRegisterOIDC, userId, i.Email, c, nil))
+
+	return s.repository.IssueToken(ctx, userId)
+}
+
+// helpers
+func (s *service) record(ctx context.Context, e audit.Event) {
+	if s.auditor != nil {
+		s.auditor.Record(ctx, e)
+	}
+}